@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"github.com/csby/gwsf/gcloud"
 	"github.com/csby/gwsf/gnode"
 	"github.com/csby/gwsf/gtype"
@@ -32,6 +33,15 @@ func (s *Handler) InitRouting(router gtype.Router) {
 		s.apiController.Hello, s.apiController.HelloDoc)
 }
 
+func (s *Handler) Shutdown(ctx context.Context) {
+	components := []interface{}{s.cloudHandler, s.nodeHandler}
+	for _, component := range components {
+		if h, ok := component.(gtype.ShutdownHandler); ok {
+			h.Shutdown(ctx)
+		}
+	}
+}
+
 func (s *Handler) BeforeRouting(ctx gtype.Context) {
 	method := ctx.Method()
 	// enable across access
@@ -0,0 +1,304 @@
+package gcert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/csby/gsecurity/gcrt"
+	"github.com/csby/gwsf/gcfg"
+	"github.com/csby/gwsf/gtype"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	checkInterval = time.Second
+)
+
+// Store 证书存储，握手时检查证书文件(路径、修改时间及大小)，发生变化时重新加载，用于证书热更新
+type Store struct {
+	gtype.Base
+
+	name   string
+	source func() *gcfg.Crt
+
+	// 从文件加载证书及CA证书
+	loadPfx func(file, password string) (*gcrt.Pfx, error)
+	loadCa  func(file string) (*gcrt.Crt, error)
+
+	mutex     sync.RWMutex
+	ca        *gcrt.Crt
+	pfx       *gcrt.Pfx
+	caStamp   stamp
+	pfxStamp  stamp
+	lastCheck time.Time
+}
+
+// NewStore 创建证书存储，name用于日志，source返回当前配置的证书(配置重新加载后路径可能改变)
+func NewStore(log gtype.Log, name string, source func() *gcfg.Crt) *Store {
+	instance := &Store{
+		name:    name,
+		source:  source,
+		loadPfx: loadPfx,
+		loadCa:  loadCa,
+	}
+	instance.SetLog(log)
+
+	return instance
+}
+
+// Load 立即加载证书及CA证书(未配置时忽略)，返回第一个加载错误
+func (s *Store) Load() error {
+	cfg := s.config()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastCheck = time.Now()
+
+	var result error
+	s.LogInfo(s.name, " pfx file: ", cfg.Server.File)
+	pfxStamp := newStamp(cfg.Server.File)
+	pfxStamp.password = cfg.Server.Password
+	pfx, err := s.loadPfx(cfg.Server.File, cfg.Server.Password)
+	if err != nil {
+		s.pfx = nil
+		result = fmt.Errorf("load %s pfx file fail: %v", s.name, err)
+	} else {
+		s.pfx = pfx
+		s.pfxStamp = pfxStamp
+	}
+
+	s.ca = nil
+	s.caStamp = stamp{}
+	if len(cfg.Ca.File) > 0 {
+		s.LogInfo(s.name, " ca file: ", cfg.Ca.File)
+		caStamp := newStamp(cfg.Ca.File)
+		ca, err := s.loadCa(cfg.Ca.File)
+		if err != nil {
+			if result == nil {
+				result = fmt.Errorf("load %s ca file fail: %v", s.name, err)
+			}
+		} else {
+			s.ca = ca
+			s.caStamp = caStamp
+		}
+	}
+
+	return result
+}
+
+// Ca 返回当前的CA证书，未配置时返回nil
+func (s *Store) Ca() *gcrt.Crt {
+	s.check()
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.ca
+}
+
+// Pfx 返回当前的证书，加载失败时返回nil
+func (s *Store) Pfx() *gcrt.Pfx {
+	s.check()
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.pfx
+}
+
+// ServerTlsConfig 返回服务端TLS配置，每次握手时使用当前的证书及CA证书
+func (s *Store) ServerTlsConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	base := &tls.Config{
+		ClientAuth: clientAuth,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	cfg := base.Clone()
+	cfg.GetCertificate = func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return s.certificate()
+	}
+	cfg.GetConfigForClient = func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+		c := base.Clone()
+		crt, err := s.certificate()
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{*crt}
+		ca := s.Ca()
+		if ca != nil {
+			c.ClientCAs = ca.Pool()
+		}
+
+		return c, nil
+	}
+
+	return cfg
+}
+
+// ClientTlsConfig 返回客户端TLS配置，每次握手时使用当前的证书及CA证书验证服务器证书；
+// 未配置CA证书时，skipVerify为true则不验证服务器证书，否则使用系统根证书验证
+func (s *Store) ClientTlsConfig(skipVerify bool) *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			crt, err := s.certificate()
+			if err != nil {
+				// 不发送客户端证书
+				return &tls.Certificate{}, nil
+			}
+			return crt, nil
+		},
+		VerifyConnection: func(state tls.ConnectionState) error {
+			return s.verify(state, skipVerify)
+		},
+	}
+}
+
+func (s *Store) certificate() (*tls.Certificate, error) {
+	pfx := s.Pfx()
+	if pfx == nil {
+		return nil, fmt.Errorf("%s certificate not loaded", s.name)
+	}
+	items := pfx.TlsCertificates()
+	if len(items) < 1 {
+		return nil, fmt.Errorf("%s certificate is empty", s.name)
+	}
+
+	return &items[0], nil
+}
+
+func (s *Store) verify(state tls.ConnectionState, skipVerify bool) error {
+	var roots *x509.CertPool
+	ca := s.Ca()
+	if ca != nil {
+		roots = ca.Pool()
+	} else if skipVerify {
+		return nil
+	}
+
+	return verifyServer(s.name, state, roots)
+}
+
+// verifyServer 使用根证书(为nil时使用系统根证书)验证服务器证书链及主机名
+func verifyServer(name string, state tls.ConnectionState, roots *x509.CertPool) error {
+	certs := state.PeerCertificates
+	if len(certs) < 1 {
+		return fmt.Errorf("%s: server certificate not provided", name)
+	}
+	opts := x509.VerifyOptions{
+		DNSName:       state.ServerName,
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(opts)
+
+	return err
+}
+
+// check 距离上次检查超过checkInterval时检查证书文件，发生变化则重新加载；加载失败时保留原证书
+func (s *Store) check() {
+	now := time.Now()
+	s.mutex.RLock()
+	checked := now.Sub(s.lastCheck) < checkInterval
+	s.mutex.RUnlock()
+	if checked {
+		return
+	}
+
+	cfg := s.config()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if now.Sub(s.lastCheck) < checkInterval {
+		return
+	}
+	s.lastCheck = now
+
+	pfxStamp := newStamp(cfg.Server.File)
+	pfxStamp.password = cfg.Server.Password
+	if pfxStamp != s.pfxStamp {
+		s.pfxStamp = pfxStamp
+		pfx, err := s.loadPfx(cfg.Server.File, cfg.Server.Password)
+		if err != nil {
+			s.LogError("reload ", s.name, " pfx file '", cfg.Server.File, "' fail: ", err)
+		} else {
+			s.pfx = pfx
+			s.LogInfo(s.name, " pfx file '", cfg.Server.File, "' reloaded")
+		}
+	}
+
+	caStamp := stamp{}
+	if len(cfg.Ca.File) > 0 {
+		caStamp = newStamp(cfg.Ca.File)
+	}
+	if caStamp != s.caStamp {
+		s.caStamp = caStamp
+		if len(cfg.Ca.File) < 1 {
+			s.ca = nil
+			s.LogInfo(s.name, " ca file removed")
+			return
+		}
+		ca, err := s.loadCa(cfg.Ca.File)
+		if err != nil {
+			s.LogError("reload ", s.name, " ca file '", cfg.Ca.File, "' fail: ", err)
+		} else {
+			s.ca = ca
+			s.LogInfo(s.name, " ca file '", cfg.Ca.File, "' reloaded")
+		}
+	}
+}
+
+func loadPfx(file, password string) (*gcrt.Pfx, error) {
+	pfx := &gcrt.Pfx{}
+	err := pfx.FromFile(file, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return pfx, nil
+}
+
+func loadCa(file string) (*gcrt.Crt, error) {
+	ca := &gcrt.Crt{}
+	err := ca.FromFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return ca, nil
+}
+
+func (s *Store) config() *gcfg.Crt {
+	if s.source != nil {
+		cfg := s.source()
+		if cfg != nil {
+			return cfg
+		}
+	}
+
+	return &gcfg.Crt{}
+}
+
+// stamp 文件标记，用于判断文件是否发生变化
+type stamp struct {
+	path     string
+	password string
+	size     int64
+	modTime  int64
+}
+
+func newStamp(path string) stamp {
+	v := stamp{path: path}
+	info, err := os.Stat(path)
+	if err == nil {
+		v.size = info.Size()
+		v.modTime = info.ModTime().UnixNano()
+	}
+
+	return v
+}
@@ -0,0 +1,304 @@
+package gcert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"github.com/csby/gsecurity/gcrt"
+	"github.com/csby/gwsf/gcfg"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testLoader 记录加载次数, 文件内容为bad时加载失败
+type testLoader struct {
+	pfxCount int
+	caCount  int
+}
+
+func (s *testLoader) loadPfx(file, password string) (*gcrt.Pfx, error) {
+	s.pfxCount++
+	if err := checkTestFile(file); err != nil {
+		return nil, err
+	}
+	return &gcrt.Pfx{}, nil
+}
+
+func (s *testLoader) loadCa(file string) (*gcrt.Crt, error) {
+	s.caCount++
+	if err := checkTestFile(file); err != nil {
+		return nil, err
+	}
+	return &gcrt.Crt{}, nil
+}
+
+func checkTestFile(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if string(data) == "bad" {
+		return fmt.Errorf("invalid certificate file")
+	}
+	return nil
+}
+
+func newTestStore(t *testing.T, cfg *gcfg.Crt) (*Store, *testLoader) {
+	loader := &testLoader{}
+	s := NewStore(nil, "test", func() *gcfg.Crt {
+		return cfg
+	})
+	s.loadPfx = loader.loadPfx
+	s.loadCa = loader.loadCa
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	return s, loader
+}
+
+func writeTestFile(t *testing.T, name, content string) {
+	if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expire 使下一次访问时检查证书文件
+func expire(s *Store) {
+	s.mutex.Lock()
+	s.lastCheck = time.Now().Add(-checkInterval)
+	s.mutex.Unlock()
+}
+
+func TestStore_Check(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &gcfg.Crt{}
+	cfg.Server.File = filepath.Join(dir, "server.pfx")
+	cfg.Ca.File = filepath.Join(dir, "ca.crt")
+	writeTestFile(t, cfg.Server.File, "server")
+	writeTestFile(t, cfg.Ca.File, "ca")
+
+	s, loader := newTestStore(t, cfg)
+	if s.Pfx() == nil || s.Ca() == nil || loader.pfxCount != 1 || loader.caCount != 1 {
+		t.Fatal("load:", loader.pfxCount, loader.caCount)
+	}
+
+	// 未变化时不重新加载
+	expire(s)
+	if s.Pfx() == nil || s.Ca() == nil || loader.pfxCount != 1 || loader.caCount != 1 {
+		t.Fatal("reloaded without change:", loader.pfxCount, loader.caCount)
+	}
+
+	// 检查间隔内不检查文件
+	writeTestFile(t, cfg.Server.File, "server-v2")
+	for i := 0; i < 10; i++ {
+		s.Pfx()
+	}
+	if loader.pfxCount != 1 {
+		t.Fatal("file checked within interval:", loader.pfxCount)
+	}
+
+	// 文件变化后重新加载
+	expire(s)
+	if s.Pfx() == nil || loader.pfxCount != 2 || loader.caCount != 1 {
+		t.Fatal("not reloaded after change:", loader.pfxCount, loader.caCount)
+	}
+
+	// 密码变化后重新加载
+	cfg.Server.Password = "secret"
+	expire(s)
+	if s.Pfx() == nil || loader.pfxCount != 3 {
+		t.Fatal("not reloaded after password changed:", loader.pfxCount)
+	}
+
+	// 配置的路径变化后重新加载
+	cfg.Ca.File = filepath.Join(dir, "ca2.crt")
+	writeTestFile(t, cfg.Ca.File, "ca2")
+	expire(s)
+	if s.Ca() == nil || loader.caCount != 2 || loader.pfxCount != 3 {
+		t.Fatal("not reloaded after path changed:", loader.pfxCount, loader.caCount)
+	}
+
+	// 移除CA证书配置
+	cfg.Ca.File = ""
+	expire(s)
+	if s.Ca() != nil {
+		t.Fatal("ca should be removed")
+	}
+	if s.Pfx() == nil || loader.pfxCount != 3 {
+		t.Fatal("pfx should be kept")
+	}
+}
+
+func TestStore_BadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &gcfg.Crt{}
+	cfg.Server.File = filepath.Join(dir, "server.pfx")
+	cfg.Ca.File = filepath.Join(dir, "ca.crt")
+	writeTestFile(t, cfg.Server.File, "server")
+	writeTestFile(t, cfg.Ca.File, "ca")
+
+	s, loader := newTestStore(t, cfg)
+
+	// 加载失败时保留原证书
+	writeTestFile(t, cfg.Server.File, "bad")
+	writeTestFile(t, cfg.Ca.File, "bad")
+	expire(s)
+	if s.Pfx() == nil || s.Ca() == nil {
+		t.Fatal("certificate should be kept when reload fail")
+	}
+	if loader.pfxCount != 2 || loader.caCount != 2 {
+		t.Fatal("load count:", loader.pfxCount, loader.caCount)
+	}
+
+	// 文件未再变化时不重复加载
+	expire(s)
+	s.Pfx()
+	if loader.pfxCount != 2 || loader.caCount != 2 {
+		t.Fatal("bad file reloaded without change:", loader.pfxCount, loader.caCount)
+	}
+
+	// 文件修复后重新加载
+	writeTestFile(t, cfg.Server.File, "server-v2")
+	expire(s)
+	if s.Pfx() == nil || loader.pfxCount != 3 {
+		t.Fatal("not reloaded after file fixed:", loader.pfxCount)
+	}
+
+	// 文件被删除时保留原证书
+	os.Remove(cfg.Server.File)
+	expire(s)
+	if s.Pfx() == nil || loader.pfxCount != 4 {
+		t.Fatal("certificate should be kept when file removed")
+	}
+}
+
+func TestStore_LoadFail(t *testing.T) {
+	cfg := &gcfg.Crt{}
+	cfg.Server.File = filepath.Join(os.TempDir(), "gcert-not-exist.pfx")
+	s := NewStore(nil, "test", func() *gcfg.Crt {
+		return cfg
+	})
+	s.loadPfx = (&testLoader{}).loadPfx
+	if s.Load() == nil {
+		t.Fatal("error expected")
+	}
+	if s.Pfx() != nil {
+		t.Fatal("pfx should be nil")
+	}
+	if _, err := s.certificate(); err == nil {
+		t.Fatal("certificate error expected")
+	}
+}
+
+// newTestCertificate 创建证书, parent为nil时创建自签名的CA证书
+func newTestCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	} else {
+		template.DNSNames = []string{name}
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+func TestVerifyServer(t *testing.T) {
+	ca, caKey := newTestCertificate(t, "test ca", nil, nil)
+	server, _ := newTestCertificate(t, "server.example.com", ca, caKey)
+	other, otherKey := newTestCertificate(t, "other ca", nil, nil)
+	untrusted, _ := newTestCertificate(t, "server.example.com", other, otherKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	tests := []struct {
+		name       string
+		serverName string
+		certs      []*x509.Certificate
+		ok         bool
+	}{
+		{"valid", "server.example.com", []*x509.Certificate{server}, true},
+		{"hostname mismatch", "evil.example.com", []*x509.Certificate{server}, false},
+		{"untrusted ca", "server.example.com", []*x509.Certificate{untrusted}, false},
+		{"no certificate", "server.example.com", nil, false},
+	}
+	for _, test := range tests {
+		state := tls.ConnectionState{ServerName: test.serverName, PeerCertificates: test.certs}
+		err := verifyServer("test", state, roots)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: err = %v", test.name, err)
+		}
+	}
+}
+
+func TestStore_ClientTlsConfig(t *testing.T) {
+	s := NewStore(nil, "test", nil)
+	s.loadPfx = (&testLoader{}).loadPfx
+	s.Load()
+
+	// 未配置CA证书且不验证时接受任意证书
+	cfg := s.ClientTlsConfig(true)
+	if !cfg.InsecureSkipVerify || cfg.VerifyConnection == nil {
+		t.Fatal("verify connection should be used instead of the default verification")
+	}
+	if err := cfg.VerifyConnection(tls.ConnectionState{ServerName: "any"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未配置CA证书且需要验证时使用系统根证书
+	cfg = s.ClientTlsConfig(false)
+	ca, caKey := newTestCertificate(t, "test ca", nil, nil)
+	server, _ := newTestCertificate(t, "server.example.com", ca, caKey)
+	state := tls.ConnectionState{ServerName: "server.example.com", PeerCertificates: []*x509.Certificate{server}}
+	if err := cfg.VerifyConnection(state); err == nil {
+		t.Fatal("certificate signed by unknown authority should be rejected")
+	}
+
+	// 证书未加载时不发送客户端证书
+	crt, err := cfg.GetClientCertificate(&tls.CertificateRequestInfo{})
+	if err != nil || crt == nil || len(crt.Certificate) > 0 {
+		t.Fatal("empty client certificate expected:", crt, err)
+	}
+}
@@ -0,0 +1,7 @@
+package gcfg
+
+type Compression struct {
+	Enabled   bool     `json:"enabled" note:"是否启用接口响应压缩(可通过CompressionMiddleware为接口单独设置)"`
+	Threshold int      `json:"threshold" note:"压缩阈值, 单位字节, 响应内容不小于该值时压缩, 0表示默认1024"`
+	Encodings []string `json:"encodings" note:"支持的压缩编码, 按优先顺序, 为空时为br,gzip,deflate"`
+}
@@ -1,5 +1,10 @@
 package gcfg
 
+import "sync"
+
+// reloadMutex 保护Reload修改的配置项, 在其他goroutine中读取这些配置项(如证书)时使用Read
+var reloadMutex sync.RWMutex
+
 type Config struct {
 	Path   string `json:"-" note:"配置文件路径"`
 	Module Module `json:"-" note:"模块信息"`
@@ -11,12 +16,19 @@ type Config struct {
 	Http    Http    `json:"http" note:"HTTP服务"`
 	Https   Https   `json:"https" note:"HTTPS服务"`
 	Cloud   Https   `json:"cloud" note:"云服务"`
-	Proxy   string  `json:"proxy" note:"代理服务器IP地址（客户端不是来自代理服务器时，远程地址为当前连接地址）"`
+	Proxy   string  `json:"proxy" note:"代理服务器IP地址或网段，多个时用逗号分隔；位于代理服务器之后时，解析来自代理服务器连接的PROXY协议(v1或v2)头部获取客户端地址，来自其他地址的连接远程地址为当前连接地址；空或无效表示不信任任何来源"`
+
+	TrustedProxies []string `json:"trustedProxies" note:"可信的HTTP代理服务器地址(IP或CIDR)，仅来自这些地址的请求解析Forwarded及X-Forwarded-*头部(从右到左，第一个不可信的地址为客户端地址)，空表示忽略转发头部"`
 
 	Site         Site   `json:"site" note:"站点配置"`
 	ReverseProxy Proxy  `json:"reverseProxy" note:"反向代理配置"`
 	Sys          System `json:"sys" note:"系统管理"`
 
+	RateLimit RateLimit `json:"rateLimit" note:"接口限流"`
+	Cors      Cors      `json:"cors" note:"跨域访问"`
+
+	Compression Compression `json:"compression" note:"接口响应压缩"`
+
 	Load func() (*Config, error) `json:"-"`
 	Save func(cfg *Config) error `json:"-"`
 }
@@ -25,3 +37,64 @@ func (s *Config) InitId() {
 	s.Node.InitId()
 	s.ReverseProxy.initId()
 }
+
+// Read 读取可重新加载的配置项(如证书、代理服务器IP), 与Reload互斥
+func Read(read func()) {
+	reloadMutex.RLock()
+	defer reloadMutex.RUnlock()
+
+	read()
+}
+
+// Reload 重新加载无需重启即可生效的配置(收到SIGHUP信号时调用): 代理服务器IP、可信的HTTP代理服务器、接口限流规则、跨域访问、
+// 响应压缩、管理网站用户及LDAP、应用网站(按基本URL匹配)的回退页面、缓存策略、预压缩及ETag,
+// 以及HTTPS、云端、节点和集群实例(按序号匹配)的证书, 新证书在之后建立的连接中生效
+func (s *Config) Reload(source *Config) {
+	if source == nil {
+		return
+	}
+
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	s.Proxy = source.Proxy
+	s.TrustedProxies = source.TrustedProxies
+	s.RateLimit.Rules = source.RateLimit.Rules
+	s.Cors = source.Cors
+	s.Compression = source.Compression
+	s.Site.Opt.Users = source.Site.Opt.Users
+	source.Site.Opt.Ldap.CopyTo(&s.Site.Opt.Ldap)
+	s.Https.Cert = source.Https.Cert
+	s.Cloud.Cert = source.Cloud.Cert
+	s.Node.Cert = source.Node.Cert
+
+	for i := range s.Cluster.Instances {
+		instance := &s.Cluster.Instances[i]
+		for j := range source.Cluster.Instances {
+			item := &source.Cluster.Instances[j]
+			if item.Index != instance.Index {
+				continue
+			}
+
+			instance.Ca = item.Ca
+			instance.Crt = item.Crt
+			break
+		}
+	}
+
+	for i := range s.Site.Apps {
+		app := &s.Site.Apps[i]
+		for j := range source.Site.Apps {
+			item := &source.Site.Apps[j]
+			if item.Uri != app.Uri {
+				continue
+			}
+
+			app.Fallback = item.Fallback
+			app.Caches = item.Caches
+			app.Precompressed = item.Precompressed
+			app.ETag = item.ETag
+			break
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package gcfg
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type Cors struct {
+	Enabled       bool     `json:"enabled" note:"是否启用, 未启用时接口响应允许任意来源(*), WebSocket仅允许同源或无来源(非浏览器)的连接"`
+	Origins       []string `json:"origins" note:"允许的来源, 如: https://www.example.com; *表示任意来源; 支持通配子域名, 如: https://*.example.com"`
+	Methods       []string `json:"methods" note:"允许的方法, 为空时为GET,POST,PUT,PATCH,DELETE,HEAD,OPTIONS"`
+	Headers       []string `json:"headers" note:"允许的请求头部, 为空时允许预检请求中的所有头部"`
+	ExposeHeaders []string `json:"exposeHeaders" note:"允许浏览器读取的响应头部, 如: X-RateLimit-Remaining"`
+	Credentials   bool     `json:"credentials" note:"是否允许携带凭据(cookie、认证信息等), 启用时按请求来源回应而不使用*"`
+	MaxAge        int      `json:"maxAge" note:"预检结果缓存时间, 单位秒, 0表示不指定"`
+}
+
+// AllowOrigin 来源是否在允许列表中(未启用时不允许任何跨域来源)
+func (s *Cors) AllowOrigin(origin string) bool {
+	if s == nil || !s.Enabled || len(origin) < 1 {
+		return false
+	}
+
+	origin = strings.ToLower(origin)
+	for _, item := range s.Origins {
+		allowed := strings.ToLower(strings.TrimSpace(item))
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+
+		// 通配子域名: https://*.example.com
+		index := strings.Index(allowed, "://*.")
+		if index < 0 {
+			continue
+		}
+		scheme := allowed[:index+3]
+		suffix := allowed[index+4:]
+		if strings.HasPrefix(origin, scheme) && strings.HasSuffix(origin, suffix) &&
+			len(origin) > len(scheme)+len(suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowAnyOrigin 是否允许任意来源且不携带凭据, 此时响应头部可使用*
+func (s *Cors) AllowAnyOrigin() bool {
+	if s == nil || !s.Enabled || s.Credentials {
+		return false
+	}
+
+	for _, item := range s.Origins {
+		if strings.TrimSpace(item) == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckOrigin WebSocket来源检查: 允许无来源(非浏览器客户端)、同源及允许列表中的来源
+func (s *Cors) CheckOrigin(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if len(origin) < 1 {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err == nil {
+		if strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		host := r.Header.Get("X-Forwarded-Host")
+		if len(host) > 0 && strings.EqualFold(u.Host, host) {
+			return true
+		}
+	}
+
+	return s.AllowOrigin(origin)
+}
@@ -6,6 +6,9 @@ type Proxy struct {
 	Enabled bool           `json:"enabled" note:"是否启用(是否显示页面)"`
 	Disable bool           `json:"disable" note:"已禁用"`
 	Servers []*ProxyServer `json:"servers" note:"服务器"`
+
+	DrainTimeout int          `json:"drainTimeout" note:"停止服务时等待已有连接结束的超时时间（秒），超时后强制关闭，0表示立即关闭"`
+	History      ProxyHistory `json:"history" note:"连接历史记录"`
 }
 
 func (s *Proxy) initId() {
@@ -26,6 +29,8 @@ func (s *Proxy) CopyTo(target *Proxy) {
 
 	target.Disable = s.Disable
 	target.Servers = s.Servers
+	target.DrainTimeout = s.DrainTimeout
+	target.History = s.History
 }
 
 func (s *Proxy) AddServer(server *ProxyServer) error {
@@ -78,7 +83,7 @@ func (s *Proxy) ModifyServer(server *ProxyServerEdit) error {
 
 	var item *ProxyServer = nil
 	id := server.Id
-	uid := fmt.Sprintf("%s:%s", server.IP, server.Port)
+	uid := proxyServerUniqueId(server.Protocol, server.IP, server.Port)
 	count := len(s.Servers)
 	for i := 0; i < count; i++ {
 		srv := s.Servers[i]
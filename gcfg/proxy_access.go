@@ -0,0 +1,19 @@
+package gcfg
+
+type ProxyAccess struct {
+	Allow    []string `json:"allow" note:"允许的来源地址（IP或CIDR），空表示全部允许"`
+	Deny     []string `json:"deny" note:"拒绝的来源地址（IP或CIDR），优先于允许列表"`
+	MaxConns int      `json:"maxConns" note:"每个来源IP的最大并发连接数，0表示不限制"`
+	Rate     int      `json:"rate" note:"每个来源IP每秒的最大新建连接数，0表示不限制"`
+}
+
+func (s *ProxyAccess) CopyFrom(source *ProxyAccess) {
+	if source == nil {
+		return
+	}
+
+	s.Allow = source.Allow
+	s.Deny = source.Deny
+	s.MaxConns = source.MaxConns
+	s.Rate = source.Rate
+}
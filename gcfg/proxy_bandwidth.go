@@ -0,0 +1,19 @@
+package gcfg
+
+type ProxyBandwidth struct {
+	Upload         int64 `json:"upload" note:"上传（客户端至目标）带宽（字节/秒），所有连接共享，0表示不限制"`
+	Download       int64 `json:"download" note:"下载（目标至客户端）带宽（字节/秒），所有连接共享，0表示不限制"`
+	ClientUpload   int64 `json:"clientUpload" note:"每个来源IP的上传带宽（字节/秒），0表示不限制"`
+	ClientDownload int64 `json:"clientDownload" note:"每个来源IP的下载带宽（字节/秒），0表示不限制"`
+}
+
+func (s *ProxyBandwidth) CopyFrom(source *ProxyBandwidth) {
+	if source == nil {
+		return
+	}
+
+	s.Upload = source.Upload
+	s.Download = source.Download
+	s.ClientUpload = source.ClientUpload
+	s.ClientDownload = source.ClientDownload
+}
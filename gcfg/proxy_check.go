@@ -0,0 +1,35 @@
+package gcfg
+
+type ProxyCheck struct {
+	Type     int    `json:"type" note:"检测类型，0-TCP连接；1-HTTP GET请求；2-TLS握手"`
+	Interval int64  `json:"interval" note:"检测间隔（秒），小于1时为5"`
+	Timeout  int64  `json:"timeout" note:"超时时间（毫秒），小于1时为500"`
+	Rise     int    `json:"rise" note:"连续成功次数达到该值时标记为在线，小于1时为1"`
+	Fall     int    `json:"fall" note:"连续失败次数达到该值时标记为离线，小于1时为1"`
+	Path     string `json:"path" note:"HTTP请求路径，如/health，空表示根路径"`
+	Host     string `json:"host" note:"HTTP请求主机名（Host头部）或TLS握手的SNI，空表示使用目标地址"`
+	Https    bool   `json:"https" note:"HTTP请求是否使用https"`
+	Status   int    `json:"status" note:"HTTP期望状态码，0表示200-399"`
+	Body     string `json:"body" note:"HTTP响应内容需包含的字符串，空表示不检测"`
+	Failures int    `json:"failures" note:"被动检测：连续连接失败次数达到该值时立即标记为离线（熔断）并转移至其他地址，0表示不启用"`
+	Cooldown int64  `json:"cooldown" note:"熔断冷却时间（秒），标记为离线后在该时间内检测通过也不恢复为在线，0表示检测间隔"`
+}
+
+func (s *ProxyCheck) CopyFrom(source *ProxyCheck) {
+	if source == nil {
+		return
+	}
+
+	s.Type = source.Type
+	s.Interval = source.Interval
+	s.Timeout = source.Timeout
+	s.Rise = source.Rise
+	s.Fall = source.Fall
+	s.Path = source.Path
+	s.Host = source.Host
+	s.Https = source.Https
+	s.Status = source.Status
+	s.Body = source.Body
+	s.Failures = source.Failures
+	s.Cooldown = source.Cooldown
+}
@@ -0,0 +1,15 @@
+package gcfg
+
+type ProxyHeader struct {
+	Set    map[string]string `json:"set" note:"添加或替换的头部，键为名称，值为内容"`
+	Remove []string          `json:"remove" note:"删除的头部名称，先于添加执行"`
+}
+
+func (s *ProxyHeader) CopyFrom(source *ProxyHeader) {
+	if source == nil {
+		return
+	}
+
+	s.Set = source.Set
+	s.Remove = source.Remove
+}
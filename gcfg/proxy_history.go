@@ -0,0 +1,7 @@
+package gcfg
+
+type ProxyHistory struct {
+	Folder   string `json:"folder" note:"文件夹路径，空表示不保存已断开连接的历史记录"`
+	MaxSize  int    `json:"maxSize" note:"单个文件的最大大小（MB），超过后滚动为新文件，0表示10MB"`
+	MaxFiles int    `json:"maxFiles" note:"保留的最大文件数，超过后删除最早的文件，0表示10个"`
+}
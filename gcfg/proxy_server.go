@@ -5,6 +5,13 @@ import (
 	"github.com/csby/gwsf/gtype"
 )
 
+const (
+	ProxyProtocolTcp = "tcp"
+	ProxyProtocolUdp = "udp"
+	// HTTP(七层)转发，与tcp共用监听端口
+	ProxyProtocolHttp = "http"
+)
+
 type ProxyServer struct {
 	Id      string `json:"id" note:"标识ID"`
 	Name    string `json:"name" note:"名称"`
@@ -14,6 +21,19 @@ type ProxyServer struct {
 	IP   string `json:"ip" note:"监听地址，空表示所有IP地址"`
 	Port string `json:"port" note:"监听端口"`
 
+	Protocol    string `json:"protocol" note:"协议，tcp、udp或http，空表示tcp；http时解析每个请求，按域名及路径选择目标，并添加X-Forwarded-For/Proto/Host头部，tls时须同时TLS终止"`
+	IdleTimeout int    `json:"idleTimeout" note:"UDP会话空闲超时时间（秒），0表示60秒，仅udp有效"`
+
+	Terminate    bool     `json:"terminate" note:"TLS终止，仅tls有效：由代理按SNI选择证书解密，按域名及路径转发（同http）"`
+	Certificates []CrtPfx `json:"certificates" note:"TLS终止时使用的证书，按SNI自动选择"`
+
+	ProxyProtocol        bool     `json:"proxyProtocol" note:"是否接收并去除传入连接的PROXY协议头部（v1或v2），位于其他负载均衡之后时使用；来自可信地址的连接须先发送头部，由服务端先发送数据的协议（如SMTP、FTP）直连且不发送头部时，在头部超时后断开"`
+	ProxyProtocolTimeout int      `json:"proxyProtocolTimeout" note:"读取PROXY协议头部的超时时间（秒），0表示5秒"`
+	TrustedProxies       []string `json:"trustedProxies" note:"可信的代理地址（IP或CIDR），只解析来自可信地址连接的PROXY协议头部，空表示不信任任何来源"`
+
+	Access    ProxyAccess    `json:"access" note:"访问控制"`
+	Bandwidth ProxyBandwidth `json:"bandwidth" note:"带宽限制，tcp及http有效"`
+
 	Targets []*ProxyTarget `json:"targets" note:"目标地址"`
 }
 
@@ -57,7 +77,21 @@ func (s *ProxyServer) InitAddrId() {
 }
 
 func (s *ProxyServer) UniqueId() string {
-	return fmt.Sprintf("%s:%s", s.IP, s.Port)
+	return proxyServerUniqueId(s.Protocol, s.IP, s.Port)
+}
+
+// IsUdp 是否为UDP服务器
+func (s *ProxyServer) IsUdp() bool {
+	return s.Protocol == ProxyProtocolUdp
+}
+
+// proxyServerUniqueId TCP(包括HTTP)与UDP可以监听相同的地址及端口
+func proxyServerUniqueId(protocol, ip, port string) string {
+	if protocol == ProxyProtocolUdp {
+		return fmt.Sprintf("udp/%s:%s", ip, port)
+	}
+
+	return fmt.Sprintf("%s:%s", ip, port)
 }
 
 func (s *ProxyServer) AddTarget(target *ProxyTarget) error {
@@ -67,7 +101,7 @@ func (s *ProxyServer) AddTarget(target *ProxyTarget) error {
 
 	count := len(s.Targets)
 	for i := 0; i < count; i++ {
-		if target.Domain == s.Targets[i].Domain && target.Path == s.Targets[i].Path {
+		if target.SameMatch(s.Targets[i]) {
 			return fmt.Errorf("domain '%s' and path '%s' has been existed", target.Domain, target.Path)
 		}
 	}
@@ -108,7 +142,7 @@ func (s *ProxyServer) ModifyTarget(target *ProxyTarget) (*ProxyTarget, error) {
 		if target.Id == s.Targets[i].Id {
 			continue
 		}
-		if target.Domain == s.Targets[i].Domain && target.Path == s.Targets[i].Path {
+		if target.SameMatch(s.Targets[i]) {
 			return nil, fmt.Errorf("domain '%s' and path '%s' not existed", target.Domain, target.Path)
 		}
 	}
@@ -134,6 +168,19 @@ type ProxyServerAdd struct {
 	TLS     bool   `json:"tls" note:"传入是否为TLS连接"`
 	IP      string `json:"ip" note:"监听地址，空表示所有IP地址"`
 	Port    string `json:"port" required:"true" note:"监听端口"`
+
+	Protocol    string `json:"protocol" note:"协议，tcp、udp或http，空表示tcp；http时解析每个请求，按域名及路径选择目标，并添加X-Forwarded-For/Proto/Host头部，tls时须同时TLS终止"`
+	IdleTimeout int    `json:"idleTimeout" note:"UDP会话空闲超时时间（秒），0表示60秒，仅udp有效"`
+
+	Terminate    bool     `json:"terminate" note:"TLS终止，仅tls有效：由代理按SNI选择证书解密，按域名及路径转发（同http）"`
+	Certificates []CrtPfx `json:"certificates" note:"TLS终止时使用的证书，按SNI自动选择"`
+
+	ProxyProtocol        bool     `json:"proxyProtocol" note:"是否接收并去除传入连接的PROXY协议头部（v1或v2），位于其他负载均衡之后时使用；来自可信地址的连接须先发送头部，由服务端先发送数据的协议（如SMTP、FTP）直连且不发送头部时，在头部超时后断开"`
+	ProxyProtocolTimeout int      `json:"proxyProtocolTimeout" note:"读取PROXY协议头部的超时时间（秒），0表示5秒"`
+	TrustedProxies       []string `json:"trustedProxies" note:"可信的代理地址（IP或CIDR），只解析来自可信地址连接的PROXY协议头部，空表示不信任任何来源"`
+
+	Access    ProxyAccess    `json:"access" note:"访问控制"`
+	Bandwidth ProxyBandwidth `json:"bandwidth" note:"带宽限制，tcp及http有效"`
 }
 
 type ProxyServerDel struct {
@@ -153,8 +200,17 @@ func (s *ProxyServerEdit) CopyTo(target *ProxyServer) {
 	target.Name = s.Name
 	target.Disable = s.Disable
 	target.TLS = s.TLS
+	target.Terminate = s.Terminate
+	target.Certificates = s.Certificates
 	target.IP = s.IP
 	target.Port = s.Port
+	target.Protocol = s.Protocol
+	target.IdleTimeout = s.IdleTimeout
+	target.ProxyProtocol = s.ProxyProtocol
+	target.ProxyProtocolTimeout = s.ProxyProtocolTimeout
+	target.TrustedProxies = s.TrustedProxies
+	target.Access.CopyFrom(&s.Access)
+	target.Bandwidth.CopyFrom(&s.Bandwidth)
 }
 
 func (s *ProxyServerEdit) CopyFrom(source *ProxyServer) {
@@ -166,6 +222,15 @@ func (s *ProxyServerEdit) CopyFrom(source *ProxyServer) {
 	s.Name = source.Name
 	s.Disable = source.Disable
 	s.TLS = source.TLS
+	s.Terminate = source.Terminate
+	s.Certificates = source.Certificates
 	s.IP = source.IP
 	s.Port = source.Port
+	s.Protocol = source.Protocol
+	s.IdleTimeout = source.IdleTimeout
+	s.ProxyProtocol = source.ProxyProtocol
+	s.ProxyProtocolTimeout = source.ProxyProtocolTimeout
+	s.TrustedProxies = source.TrustedProxies
+	s.Access.CopyFrom(&source.Access)
+	s.Bandwidth.CopyFrom(&source.Bandwidth)
 }
@@ -12,8 +12,10 @@ type ProxySpare struct {
 	AddrId    string `json:"addrId" note:"地址标识"`
 	Alive     bool   `json:"alive" note:"在线状态"`
 	ConnCount int64  `json:"connCount" note:"连接数量"`
-	IP        string `json:"ip" note:"目标地址"`
+	IP        string `json:"ip" note:"目标地址，IP、域名或SRV记录"`
 	Port      string `json:"port" note:"目标端口"`
+	Weight    int    `json:"weight" note:"权重，小于1时视为1"`
+	Draining  bool   `json:"draining" note:"排空，true-不再分配新连接，已有连接继续直到结束"`
 
 	sourceId string
 	targetId string
@@ -47,6 +49,14 @@ func (s *ProxySpare) SetAlive(v bool) {
 	s.Alive = v
 }
 
+func (s *ProxySpare) IsDraining() bool {
+	return s.Draining
+}
+
+func (s *ProxySpare) SetDraining(v bool) {
+	s.Draining = v
+}
+
 func (s *ProxySpare) IncreaseCount() int64 {
 	s.Lock()
 	defer s.Unlock()
@@ -69,18 +79,37 @@ type ProxyTarget struct {
 	sync.RWMutex
 
 	Id     string `json:"id" note:"标识ID"`
-	Domain string `json:"domain" note:"域名"`
-	Path   string `json:"path" note:"路径，仅http有效"`
+	Domain string `json:"domain" note:"域名，支持通配符（如*.example.com）及正则表达式（以~开头，如~^shop-[0-9]+[.]example[.]com$），多个匹配时精确域名优先，其次为后缀最长的通配符、先配置的正则表达式"`
+	Path   string `json:"path" note:"路径，http或TLS终止时有效"`
+
+	Sources []string `json:"sources" note:"来源地址（IP或CIDR），为空时匹配所有来源，多个匹配时网段最小的优先"`
+	Alpn    []string `json:"alpn" note:"TLS ALPN协议（如h2、http/1.1），为空时匹配所有连接，TLS透传时匹配客户端提供的协议"`
 
 	AddrId    string        `json:"addrId" note:"地址标识"`
 	Alive     bool          `json:"alive" note:"在线状态"`
 	ConnCount int64         `json:"connCount" note:"连接数量"`
-	IP        string        `json:"ip" note:"目标地址"`
+	IP        string        `json:"ip" note:"目标地址，IP或域名，也可以是SRV记录（如srv://_http._tcp.example.com，此时按记录中的端口转发，忽略目标端口）"`
 	Port      string        `json:"port" note:"目标端口"`
-	Version   int           `json:"version" note:"版本号，0或1，0-不添加头部；1-添加代理头部（PROXY family srcIP srcPort targetIP targetPort）"`
+	Version   int           `json:"version" note:"版本号，0、1或2，0-不添加头部；1-添加代理头部（PROXY family srcIP srcPort targetIP targetPort）；2-添加PROXY协议v2二进制头部（包含SNI或Host）"`
 	Disable   bool          `json:"disable" note:"已禁用"`
+	Draining  bool          `json:"draining" note:"排空，true-不再分配新连接，已有连接继续直到结束"`
+	Weight    int           `json:"weight" note:"权重，小于1时视为1"`
+	Balance   int           `json:"balance" note:"负载均衡策略，0-最少连接；1-加权轮询；2-随机；3-源地址哈希（会话保持）"`
+	Check     ProxyCheck    `json:"check" note:"健康检测"`
 	Spares    []*ProxySpare `json:"spares" note:"备用目标"`
 
+	ResolveInterval int `json:"resolveInterval" note:"域名重新解析的最大间隔（秒），DNS记录的TTL较小时按TTL，0表示30秒"`
+
+	Encrypt    bool `json:"encrypt" note:"TLS终止或http时是否使用TLS连接目标（重新加密）"`
+	SkipVerify bool `json:"skipVerify" note:"重新加密时是否跳过目标证书验证"`
+
+	PathRewrite    string      `json:"pathRewrite" note:"路径前缀替换，非空时将请求路径中匹配的路径(path)前缀替换为该值，'/'表示去除前缀，仅http有效"`
+	RequestHeader  ProxyHeader `json:"requestHeader" note:"转发至目标的请求头部修改，仅http有效"`
+	ResponseHeader ProxyHeader `json:"responseHeader" note:"返回至客户端的响应头部修改，仅http有效"`
+
+	Access    ProxyAccess    `json:"access" note:"访问控制，仅对该目标生效"`
+	Bandwidth ProxyBandwidth `json:"bandwidth" note:"带宽限制，仅对该目标生效，tcp及http有效"`
+
 	sourceId string
 }
 
@@ -121,22 +150,76 @@ func (s *ProxyTarget) CopyFrom(source *ProxyTarget) {
 
 	s.Domain = source.Domain
 	s.Path = source.Path
+	s.Sources = source.Sources
+	s.Alpn = source.Alpn
 	s.IP = source.IP
 	s.Port = source.Port
+	s.ResolveInterval = source.ResolveInterval
 	s.Version = source.Version
 	s.Disable = source.Disable
+	s.Encrypt = source.Encrypt
+	s.SkipVerify = source.SkipVerify
+	s.PathRewrite = source.PathRewrite
+	s.RequestHeader.CopyFrom(&source.RequestHeader)
+	s.ResponseHeader.CopyFrom(&source.ResponseHeader)
+	s.Weight = source.Weight
+	s.Balance = source.Balance
+	s.Check.CopyFrom(&source.Check)
+	s.Access.CopyFrom(&source.Access)
+	s.Bandwidth.CopyFrom(&source.Bandwidth)
+
+	// 排空状态通过单独的接口设置，修改时保留原备用目标的排空状态
+	drains := make(map[string]bool)
+	for i := 0; i < len(s.Spares); i++ {
+		item := s.Spares[i]
+		if item != nil && item.Draining {
+			drains[fmt.Sprintf("%s:%s", item.IP, item.Port)] = true
+		}
+	}
 	s.Spares = make([]*ProxySpare, 0)
 	for i := 0; i < len(source.Spares); i++ {
 		item := source.Spares[i]
 		if item != nil {
 			s.Spares = append(s.Spares, &ProxySpare{
-				IP:   item.IP,
-				Port: item.Port,
+				IP:       item.IP,
+				Port:     item.Port,
+				Weight:   item.Weight,
+				Draining: drains[fmt.Sprintf("%s:%s", item.IP, item.Port)],
 			})
 		}
 	}
 }
 
+// SameMatch 域名、路径、来源地址及ALPN是否都相同
+func (s *ProxyTarget) SameMatch(target *ProxyTarget) bool {
+	if target == nil {
+		return false
+	}
+	if s.Domain != target.Domain || s.Path != target.Path {
+		return false
+	}
+
+	return sameStrings(s.Sources, target.Sources) && sameStrings(s.Alpn, target.Alpn)
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	items := make(map[string]int)
+	for _, v := range a {
+		items[v]++
+	}
+	for _, v := range b {
+		if items[v] < 1 {
+			return false
+		}
+		items[v]--
+	}
+
+	return true
+}
+
 func (s *ProxyTarget) SpareTargets() []string {
 	targets := make([]string, 0)
 
@@ -153,6 +236,22 @@ func (s *ProxyTarget) SpareTargets() []string {
 	return targets
 }
 
+func (s *ProxyTarget) SpareWeights() []int {
+	weights := make([]int, 0)
+
+	c := len(s.Spares)
+	for i := 0; i < c; i++ {
+		spare := s.Spares[i]
+		if spare == nil {
+			continue
+		}
+
+		weights = append(weights, spare.Weight)
+	}
+
+	return weights
+}
+
 func (s *ProxyTarget) IsAlive() bool {
 	return s.Alive
 }
@@ -165,6 +264,14 @@ func (s *ProxyTarget) SetAlive(v bool) {
 	s.Alive = v
 }
 
+func (s *ProxyTarget) IsDraining() bool {
+	return s.Draining
+}
+
+func (s *ProxyTarget) SetDraining(v bool) {
+	s.Draining = v
+}
+
 func (s *ProxyTarget) IncreaseCount() int64 {
 	s.Lock()
 	defer s.Unlock()
@@ -191,6 +298,11 @@ type ProxyTargetEdit struct {
 	Target   ProxyTarget `json:"target" note:"目标地址"`
 }
 
+type ProxyTargetDrain struct {
+	AddrId   string `json:"addrId" required:"true" note:"地址标识（目标或备用目标）"`
+	Draining bool   `json:"draining" note:"true-排空，不再分配新连接，已有连接继续直到结束；false-恢复"`
+}
+
 type ProxyTargetDel struct {
 	ServerId string `json:"serverId" required:"true" note:"服务器标识ID"`
 	TargetId string `json:"targetId" required:"true" note:"目标地址标识ID"`
@@ -0,0 +1,24 @@
+package gcfg
+
+import "github.com/csby/gwsf/gtype"
+
+const (
+	RateLimitKeyIp     = "ip"     // 客户端IP地址
+	RateLimitKeyToken  = "token"  // 凭证，没有凭证时使用客户端IP地址
+	RateLimitKeyCustom = "custom" // 自定义键函数
+)
+
+type RateLimit struct {
+	Enabled bool             `json:"enabled" note:"是否启用"`
+	Cluster bool             `json:"cluster" note:"是否在集群中共享限流计数（通过集群通道同步）"`
+	Rules   []*RateLimitRule `json:"rules" note:"限流规则, 按路径前缀最长匹配"`
+
+	Key func(ctx gtype.Context, rule *RateLimitRule) string `json:"-" note:"自定义键函数, 规则的键类型为custom时使用, 返回空时使用客户端IP地址"`
+}
+
+type RateLimitRule struct {
+	Path  string  `json:"path" note:"路径前缀, 按路径段匹配, 如: /opt.api/login匹配/opt.api/login及/opt.api/login/xxx, 不匹配/opt.api/loginxxx"`
+	Key   string  `json:"key" note:"键类型: ip-客户端IP地址(默认); token-凭证; custom-自定义键函数"`
+	Rate  float64 `json:"rate" note:"每秒补充的令牌数, 如: 0.5表示每2秒1个请求"`
+	Burst int     `json:"burst" note:"令牌桶容量, 即允许的突发请求数, 小于1时为1"`
+}
@@ -7,4 +7,14 @@ type SiteApp struct {
 
 	DownloadTitle string `json:"downloadTitle" note:"下载连接标题"`
 	DownloadUrl   string `json:"downloadUrl" note:"下载连接地址"`
+
+	Fallback      string          `json:"fallback" note:"回退页面，请求的路径(不含扩展名)不存在时返回，用于history模式的单页应用，如: index.html，空表示返回404"`
+	Caches        []*SiteAppCache `json:"caches" note:"缓存策略，按顺序匹配第一条，未匹配时不输出Cache-Control"`
+	Precompressed bool            `json:"precompressed" note:"是否优先返回预压缩的文件(如: app.js.br、app.js.gz)"`
+	ETag          bool            `json:"etag" note:"是否输出强ETag(文件内容的SHA-256)"`
+}
+
+type SiteAppCache struct {
+	Pattern string `json:"pattern" note:"路径匹配模式，含/时匹配相对路径(如: /assets/*)，以/结尾时匹配路径前缀，否则匹配文件名(如: *.html)"`
+	Control string `json:"control" note:"Cache-Control的值，如: no-cache; public, max-age=31536000, immutable"`
 }
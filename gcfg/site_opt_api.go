@@ -1,5 +1,6 @@
 package gcfg
 
 type SiteOptApi struct {
-	Token Token `json:"token" note:"凭证"`
+	Token Token         `json:"token" note:"凭证"`
+	Limit RateLimitRule `json:"limit" note:"登录及验证码接口限流(按客户端IP), rate为0时使用默认值(每5秒1次, 突发10次), 小于0时不限流"`
 }
@@ -7,6 +7,8 @@ type Svc struct {
 	Args     string    `json:"-" note:"启动参数"`
 	BootTime time.Time `json:"-" note:"启动时间"`
 
+	ShutdownTimeout int `json:"shutdownTimeout" note:"关闭服务时等待处理中的请求及WebSocket连接结束的最长时间, 单位秒, 0表示默认30"`
+
 	DownloadTitle string `json:"downloadTitle" note:"下载连接标题"`
 	DownloadUrl   string `json:"downloadUrl" note:"下载连接地址"`
 
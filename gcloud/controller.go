@@ -94,10 +94,16 @@ func (s *Controller) createCatalog(doc gtype.Doc, names ...string) gtype.Catalog
 }
 
 func (s *Controller) checkOrigin(r *http.Request) bool {
-	if r != nil {
+	var cors *gcfg.Cors
+	if s.cfg != nil {
+		cors = &s.cfg.Cors
+	}
+	if cors.CheckOrigin(r) {
+		return true
 	}
 
-	return true
+	s.LogWarning("websocket origin is not allowed: origin=", r.Header.Get("Origin"), ", host=", r.Host, ", path=", r.URL.Path)
+	return false
 }
 
 func (s *Controller) writeOptSocketMessage(id int, data interface{}) bool {
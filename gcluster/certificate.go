@@ -3,6 +3,7 @@ package gcluster
 import (
 	"crypto/tls"
 	"github.com/csby/gsecurity/gcrt"
+	"github.com/csby/gwsf/gcert"
 	"github.com/csby/gwsf/gcfg"
 	"github.com/csby/gwsf/gtype"
 )
@@ -10,61 +11,51 @@ import (
 type Certificate struct {
 	gtype.Base
 
-	ca  *gcrt.Crt
-	crt *gcrt.Pfx
+	store *gcert.Store
 }
 
 func (s *Certificate) Ca() *gcrt.Crt {
-	return s.ca
+	if s.store == nil {
+		return nil
+	}
+
+	return s.store.Ca()
 }
 
 func (s *Certificate) Crt() *gcrt.Pfx {
-	return s.crt
+	if s.store == nil {
+		return nil
+	}
+
+	return s.store.Pfx()
 }
 
+// Load 加载证书，证书文件或配置的路径改变时，新建立的连接使用新的证书
 func (s *Certificate) Load(instance *gcfg.ClusterInstance) {
 	if instance == nil {
 		return
 	}
 
-	caFilePath := instance.Ca.File
-	s.LogInfo("cluster ca file: ", caFilePath)
-	pfxFilePath := instance.Crt.File
-	s.LogInfo("cluster crt file: ", pfxFilePath)
-	pfx := &gcrt.Pfx{}
-	err := pfx.FromFile(pfxFilePath, instance.Crt.Password)
+	s.store = gcert.NewStore(s.GetLog(), "cluster", func() *gcfg.Crt {
+		crt := &gcfg.Crt{}
+		gcfg.Read(func() {
+			crt.Ca = instance.Ca
+			crt.Server = instance.Crt
+		})
+		return crt
+	})
+	err := s.store.Load()
 	if err != nil {
-		s.crt = nil
-		s.LogError("load cluster crt file fail: ", err)
-	} else {
-		s.crt = pfx
-	}
-
-	if len(caFilePath) > 0 {
-		crt := &gcrt.Crt{}
-		err = crt.FromFile(caFilePath)
-		if err != nil {
-			s.ca = nil
-			s.LogError("load node ca file fail: ", err)
-		} else {
-			s.ca = crt
-		}
-	} else {
-		s.ca = nil
+		s.LogError(err)
 	}
 }
 
 func (s *Certificate) ClientTlsConfig() *tls.Config {
-	cfg := &tls.Config{}
-
-	if s.ca != nil {
-		cfg.RootCAs = s.ca.Pool()
-	} else {
-		cfg.InsecureSkipVerify = true
-	}
-	if s.crt != nil {
-		cfg.Certificates = s.crt.TlsCertificates()
+	if s.store == nil {
+		return &tls.Config{
+			InsecureSkipVerify: true,
+		}
 	}
 
-	return cfg
+	return s.store.ClientTlsConfig(true)
 }
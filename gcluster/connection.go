@@ -25,6 +25,10 @@ type Connection struct {
 
 	connected bool
 	version   string
+
+	mutex  sync.Mutex
+	closed bool
+	conn   *websocket.Conn
 }
 
 func (s *Connection) Connected() bool {
@@ -48,6 +52,10 @@ func (s *Connection) OnConnect(conn *websocket.Conn, version string) {
 	if s.connected {
 		return
 	}
+	if !s.setConn(conn) {
+		return
+	}
+	defer s.setConn(nil)
 	s.version = version
 
 	defer s.setConnected(false)
@@ -136,9 +144,43 @@ func (s *Connection) DoConnect() error {
 	return nil
 }
 
+// Close 关闭连接并停止重连, 用于服务关闭
+func (s *Connection) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+func (s *Connection) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.closed
+}
+
+// setConn 设置当前连接, 已关闭时返回false
+func (s *Connection) setConn(conn *websocket.Conn) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if conn != nil && s.closed {
+		return false
+	}
+	s.conn = conn
+
+	return true
+}
+
 func (s *Connection) doConnect(uri, host string) {
 	for {
 		time.Sleep(time.Second)
+		if s.isClosed() {
+			return
+		}
 
 		s.connect(uri, host)
 	}
@@ -150,6 +192,11 @@ func (s *Connection) connect(url, host string) {
 		s.LogDebug("instance connect to cluster fail:", err)
 		return
 	}
+	if !s.setConn(websocketConn) {
+		websocketConn.Close()
+		return
+	}
+	defer s.setConn(nil)
 	defer func(conn io.Closer, h string) {
 		s.setConnected(false)
 		conn.Close()
@@ -50,10 +50,16 @@ func (s *Controller) preHandle(ctx gtype.Context, ps gtype.Params) {
 }
 
 func (s *Controller) checkOrigin(r *http.Request) bool {
-	if r != nil {
+	var cors *gcfg.Cors
+	if s.cfg != nil {
+		cors = &s.cfg.Cors
+	}
+	if cors.CheckOrigin(r) {
+		return true
 	}
 
-	return true
+	s.LogWarning("websocket origin is not allowed: origin=", r.Header.Get("Origin"), ", host=", r.Host, ", path=", r.URL.Path)
+	return false
 }
 
 func (s *Controller) createCatalog(doc gtype.Doc, names ...string) gtype.Catalog {
@@ -137,7 +143,7 @@ func (s *Controller) init(cluster *gcfg.Cluster) {
 			if cluster.Enable {
 				crt := &Certificate{}
 				crt.SetLog(s.GetLog())
-				crt.Load(&item)
+				crt.Load(&items[i])
 				cfg = crt.ClientTlsConfig()
 			}
 		}
@@ -178,6 +184,25 @@ func (s *Controller) init(cluster *gcfg.Cluster) {
 	}
 }
 
+// Close 关闭与其他实例的连接(包括接入及连出)并停止重连
+func (s *Controller) Close() {
+	items := s.instances
+	c := len(items)
+	for i := 0; i < c; i++ {
+		item := items[i]
+		if item == nil {
+			continue
+		}
+
+		if item.In != nil {
+			item.In.Close()
+		}
+		if item.Out != nil {
+			item.Out.Close()
+		}
+	}
+}
+
 func (s *Controller) getInstance(index uint64) *Instance {
 	items := s.instances
 	c := len(items)
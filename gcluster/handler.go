@@ -1,7 +1,9 @@
 package gcluster
 
 import (
+	"context"
 	"github.com/csby/gwsf/gcfg"
+	"github.com/csby/gwsf/glimit"
 	"github.com/csby/gwsf/gtype"
 )
 
@@ -20,6 +22,10 @@ func NewHandler(log gtype.Log, cfg *gcfg.Config, opt gtype.SocketChannelCollecti
 	}
 	instance.controller = NewController(log, cfg, instance.chs)
 
+	if cfg != nil && cfg.RateLimit.Cluster {
+		glimit.Share(instance.chs.cluster, cfg.Cluster.Index)
+	}
+
 	return instance
 }
 
@@ -61,3 +67,8 @@ func (s *innerHandler) initOpt(router gtype.Router, path *gtype.Path, preHandle
 	router.POST(path.Uri("/cluster/msg/sync/send"), preHandle,
 		s.controller.SendSyncMessage, s.controller.SendSyncMessageDoc)
 }
+
+// Shutdown 关闭与其他实例的连接并停止重连, 实现gtype.ShutdownHandler, 用于服务关闭
+func (s *innerHandler) Shutdown(ctx context.Context) {
+	s.controller.Close()
+}
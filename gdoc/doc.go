@@ -15,6 +15,7 @@ func NewDoc(enable bool) gtype.Doc {
 		catalogs:    make(CatalogCollection, 0),
 		functions:   make(map[string]*Function),
 		regenerates: make([]*redo, 0),
+		middlewares: make(map[string][]*Middleware),
 	}
 }
 
@@ -24,6 +25,10 @@ type doc struct {
 	functions   map[string]*Function
 	regenerates []*redo
 
+	// 全局中间件及各接口(标识)的中间件
+	globalMiddlewares []*Middleware
+	middlewares       map[string][]*Middleware
+
 	onFunctionReady func(index int, method, path, name string)
 }
 
@@ -100,8 +105,13 @@ func (s *doc) Catalogs() interface{} {
 }
 
 func (s *doc) Function(id, schema, host string) (interface{}, error) {
-	fun, ok := s.functions[id]
+	item, ok := s.functions[id]
 	if ok {
+		// 共享的接口定义可能被并发请求，在副本中设置中间件及完整地址
+		fun := *item
+		fun.Middlewares = make([]*Middleware, 0, len(s.globalMiddlewares)+len(s.middlewares[id]))
+		fun.Middlewares = append(fun.Middlewares, s.globalMiddlewares...)
+		fun.Middlewares = append(fun.Middlewares, s.middlewares[id]...)
 		if fun.IsWebsocket {
 			if strings.ToLower(schema) == "https" {
 				fun.FullPath = fmt.Sprintf("%s://%s%s", "wss", host, fun.Path)
@@ -111,7 +121,7 @@ func (s *doc) Function(id, schema, host string) (interface{}, error) {
 		} else {
 			fun.FullPath = fmt.Sprintf("%s://%s%s", schema, host, fun.Path)
 		}
-		return fun, nil
+		return &fun, nil
 	} else {
 		return nil, fmt.Errorf("id '%s' not exist", id)
 	}
@@ -145,6 +155,23 @@ func (s *doc) TokenCreate(id string, items []gtype.TokenAuth, ctx gtype.Context)
 	return create(items, ctx)
 }
 
+func (s *doc) SetMiddlewares(method string, uri gtype.Uri, middlewares []gtype.Middleware) {
+	if uri == nil {
+		return
+	}
+
+	id := s.generateFunctionId(method, uri.Path())
+	if len(middlewares) < 1 {
+		delete(s.middlewares, id)
+		return
+	}
+	s.middlewares[id] = newMiddlewares(MiddlewareScopeRoute, middlewares)
+}
+
+func (s *doc) UseMiddlewares(middlewares ...gtype.Middleware) {
+	s.globalMiddlewares = append(s.globalMiddlewares, newMiddlewares(MiddlewareScopeGlobal, middlewares)...)
+}
+
 func (s *doc) onNewFunction(fun *Function) {
 	id := s.generateFunctionId(fun.Method, fun.Path)
 	_, ok := s.functions[id]
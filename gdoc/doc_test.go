@@ -0,0 +1,48 @@
+package gdoc
+
+import (
+	"fmt"
+	"github.com/csby/gwsf/gtype"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestDoc_FunctionConcurrent(t *testing.T) {
+	nop := func(next gtype.HttpHandle) gtype.HttpHandle {
+		return next
+	}
+	d := NewDoc(true)
+	uri := (&gtype.Path{}).Uri("/api/test")
+	d.AddCatalog("test").AddFunction(http.MethodGet, uri, "test")
+	d.UseMiddlewares(gtype.NewMiddleware("global", "", nop))
+	d.SetMiddlewares(http.MethodGet, uri, []gtype.Middleware{gtype.NewMiddleware("route", "", nop)})
+	id := d.(*doc).generateFunctionId(http.MethodGet, "/api/test")
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			host := fmt.Sprintf("host%d", i)
+			v, err := d.Function(id, "http", host)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			fun := v.(*Function)
+			if fun.FullPath != "http://"+host+"/api/test" {
+				t.Error("full path:", fun.FullPath)
+			}
+			if len(fun.Middlewares) != 2 || fun.Middlewares[0].Name != "global" || fun.Middlewares[1].Name != "route" {
+				t.Error("middlewares:", fun.Middlewares)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(d.(*doc).functions[id].Middlewares) != 0 {
+		t.Error("shared function should not be modified")
+	}
+}
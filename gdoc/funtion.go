@@ -22,6 +22,8 @@ type Function struct {
 	Input       *Input  `json:"input"`       // 输入
 	Output      *Output `json:"output"`      // 输出
 
+	Middlewares []*Middleware `json:"middlewares"` // 中间件，按执行顺序
+
 	TokenUI     func() []gtype.TokenUI                                                 `json:"-"`
 	TokenCreate func(items []gtype.TokenAuth, ctx gtype.Context) (string, gtype.Error) `json:"-"`
 }
@@ -8,7 +8,7 @@ type Input struct {
 	Forms    []*Form     `json:"forms"`    // 表单
 	Model    []*Type     `json:"model"`    // 数据模型
 	Example  interface{} `json:"example"`  // 数据示例
-	Format   int         `json:"format"`   // 数据格式: 0-text; 1-json; 2-xml
+	Format   int         `json:"format"`   // 数据格式: 0-text; 1-json; 2-xml; 3-msgpack
 	Appendix *Appendix   `json:"appendix"` // 附录
 }
 
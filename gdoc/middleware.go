@@ -0,0 +1,31 @@
+package gdoc
+
+import "github.com/csby/gwsf/gtype"
+
+const (
+	MiddlewareScopeGlobal = "global"
+	MiddlewareScopeRoute  = "route"
+)
+
+type Middleware struct {
+	Name  string `json:"name"`  // 名称
+	Note  string `json:"note"`  // 说明
+	Scope string `json:"scope"` // 范围: global-全局; route-分组或接口
+}
+
+func newMiddlewares(scope string, items []gtype.Middleware) []*Middleware {
+	middlewares := make([]*Middleware, 0, len(items))
+	for i := 0; i < len(items); i++ {
+		item := items[i]
+		if item.Wrap == nil {
+			continue
+		}
+		middlewares = append(middlewares, &Middleware{
+			Name:  item.Name,
+			Note:  item.Note,
+			Scope: scope,
+		})
+	}
+
+	return middlewares
+}
@@ -10,7 +10,7 @@ type Output struct {
 	Headers  []*Header       `json:"headers"`  // 头部
 	Model    []*Type         `json:"model"`    // 数据模型
 	Example  interface{}     `json:"example"`  // 数据示例
-	Format   int             `json:"format"`   // 数据格式: 0-text; 1-json; 2-xml
+	Format   int             `json:"format"`   // 数据格式: 0-text; 1-json; 2-xml; 3-msgpack
 	Errors   ErrorCollection `json:"errors"`   // 输出错误代码
 	Appendix *Appendix       `json:"appendix"` // 附录
 }
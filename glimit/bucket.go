@@ -0,0 +1,58 @@
+package glimit
+
+import (
+	"math"
+	"time"
+)
+
+// bucket 令牌桶: 以rate个/秒的速度补充令牌，最多capacity个
+type bucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+
+	rejected int       // 自上次输出日志后被拒绝的请求数
+	warned   time.Time // 上次输出日志的时间
+}
+
+func newBucket(rate float64, capacity int, now time.Time) *bucket {
+	return &bucket{
+		rate:     rate,
+		capacity: float64(capacity),
+		tokens:   float64(capacity),
+		last:     now,
+	}
+}
+
+func (s *bucket) refill(now time.Time) {
+	elapsed := now.Sub(s.last).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	s.last = now
+	s.tokens = math.Min(s.capacity, s.tokens+elapsed*s.rate)
+}
+
+func (s *bucket) take(count float64) bool {
+	if s.tokens < count {
+		return false
+	}
+	s.tokens -= count
+
+	return true
+}
+
+func (s *bucket) full() bool {
+	return s.tokens >= s.capacity
+}
+
+// wait 返回令牌数达到count所需的时间
+func (s *bucket) wait(count float64) time.Duration {
+	lack := count - s.tokens
+	if lack <= 0 {
+		return 0
+	}
+
+	return time.Duration(lack / s.rate * float64(time.Second))
+}
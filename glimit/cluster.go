@@ -0,0 +1,126 @@
+package glimit
+
+import (
+	"github.com/csby/gwsf/gtype"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	syncInterval = time.Second
+)
+
+var shared = &sharing{
+	limiters: make(map[string]*Limiter),
+}
+
+// Share 通过集群通道(gcluster)共享限流计数: 定期向其他实例发送本实例消耗的令牌，
+// 并从本地令牌桶中扣除其他实例消耗的令牌；仅对启用集群(cluster)的限流器生效
+func Share(chs gtype.SocketChannelCollection, index uint64) {
+	if chs == nil {
+		return
+	}
+
+	shared.Lock()
+	defer shared.Unlock()
+	if shared.chs != nil {
+		return
+	}
+	shared.chs = chs
+	shared.index = index
+	atomic.StoreInt32(&shared.enabled, 1)
+
+	chs.AddReader(shared.read)
+	go shared.run()
+}
+
+type consumption struct {
+	Path  string  `json:"path" note:"规则路径前缀"`
+	Key   string  `json:"key" note:"键"`
+	Count float64 `json:"count" note:"消耗的令牌数"`
+}
+
+type consumptionMessage struct {
+	Index   uint64         `json:"index" note:"实例索引"`
+	Limiter string         `json:"limiter" note:"限流器名称"`
+	Items   []*consumption `json:"items" note:"消耗的令牌"`
+}
+
+type sharing struct {
+	sync.RWMutex
+
+	chs      gtype.SocketChannelCollection
+	index    uint64
+	limiters map[string]*Limiter
+	enabled  int32
+}
+
+func share(limiter *Limiter) {
+	shared.Lock()
+	defer shared.Unlock()
+
+	shared.limiters[limiter.name] = limiter
+}
+
+func (s *sharing) isEnabled() bool {
+	return atomic.LoadInt32(&s.enabled) != 0
+}
+
+func (s *sharing) run() {
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.write()
+	}
+}
+
+func (s *sharing) write() {
+	s.RLock()
+	defer s.RUnlock()
+
+	for name, limiter := range s.limiters {
+		items := limiter.flush()
+		if len(items) < 1 {
+			continue
+		}
+
+		s.chs.Write(&gtype.SocketMessage{
+			ID: gtype.WSClusterRateLimitConsumed,
+			Data: &consumptionMessage{
+				Index:   s.index,
+				Limiter: name,
+				Items:   items,
+			},
+		}, nil)
+	}
+}
+
+func (s *sharing) read(message *gtype.SocketMessage, channel gtype.SocketChannel) {
+	if message == nil || message.ID != gtype.WSClusterRateLimitConsumed {
+		return
+	}
+
+	msg := &consumptionMessage{}
+	if message.GetData(msg) != nil {
+		return
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+	if msg.Index == s.index {
+		return
+	}
+	limiter, ok := s.limiters[msg.Limiter]
+	if !ok {
+		return
+	}
+
+	for _, item := range msg.Items {
+		if item == nil {
+			continue
+		}
+		limiter.consume(item.Path, item.Key, item.Count)
+	}
+}
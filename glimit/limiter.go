@@ -0,0 +1,357 @@
+package glimit
+
+import (
+	"fmt"
+	"github.com/csby/gwsf/gcfg"
+	"github.com/csby/gwsf/gtype"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderLimit     = "X-RateLimit-Limit"
+	HeaderRemaining = "X-RateLimit-Remaining"
+	HeaderReset     = "X-RateLimit-Reset"
+	HeaderRetry     = "Retry-After"
+
+	sweepInterval = time.Minute
+	warnInterval  = time.Minute
+)
+
+// Limiter 令牌桶限流器，按路径前缀(以路径段为单位)最长匹配规则，每个规则下按键(客户端IP、凭证等)分别计数
+type Limiter struct {
+	gtype.Base
+
+	name    string
+	cluster bool
+	keyFunc func(ctx gtype.Context, rule *gcfg.RateLimitRule) string
+
+	rulesMutex sync.RWMutex
+	rules      []*rule
+
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	consumed  map[string]float64
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewLimiter 创建限流器，name用于在集群中区分不同的限流器，忽略rate不大于0的规则
+func NewLimiter(log gtype.Log, name string, cfg *gcfg.RateLimit) *Limiter {
+	instance := &Limiter{
+		name:     name,
+		buckets:  make(map[string]*bucket),
+		consumed: make(map[string]float64),
+		now:      time.Now,
+	}
+	instance.SetLog(log)
+	instance.lastSweep = instance.now()
+
+	if cfg == nil {
+		return instance
+	}
+	instance.cluster = cfg.Cluster
+	instance.keyFunc = cfg.Key
+	instance.rules = newRules(cfg.Rules)
+
+	if instance.cluster {
+		share(instance)
+	}
+
+	return instance
+}
+
+// Reload 重新加载限流规则并清空计数(集群共享及键函数不变)
+func (s *Limiter) Reload(cfg *gcfg.RateLimit) {
+	if cfg == nil {
+		return
+	}
+	rules := newRules(cfg.Rules)
+
+	s.rulesMutex.Lock()
+	s.rules = rules
+	s.rulesMutex.Unlock()
+
+	s.mutex.Lock()
+	s.buckets = make(map[string]*bucket)
+	s.consumed = make(map[string]float64)
+	s.mutex.Unlock()
+}
+
+// Middleware 返回限流中间件，未匹配规则的请求不受限制
+func (s *Limiter) Middleware() gtype.Middleware {
+	s.rulesMutex.RLock()
+	notes := make([]string, 0, len(s.rules))
+	for _, item := range s.rules {
+		notes = append(notes, item.String())
+	}
+	s.rulesMutex.RUnlock()
+
+	return gtype.NewMiddleware("限流", strings.Join(notes, "; "), func(next gtype.HttpHandle) gtype.HttpHandle {
+		return func(ctx gtype.Context, ps gtype.Params) {
+			if !s.Check(ctx) {
+				return
+			}
+			next(ctx, ps)
+		}
+	})
+}
+
+// Check 检查请求是否允许通过并输出X-RateLimit-*头部，拒绝时输出ErrTooMany并返回false
+func (s *Limiter) Check(ctx gtype.Context) bool {
+	if ctx == nil {
+		return true
+	}
+	r := s.match(ctx.Path())
+	if r == nil {
+		return true
+	}
+
+	key := s.key(ctx, r)
+	allowed, remaining, reset, retry := s.take(r, key)
+
+	header := ctx.Response().Header()
+	header.Set(HeaderLimit, fmt.Sprint(r.burst))
+	header.Set(HeaderRemaining, fmt.Sprint(remaining))
+	header.Set(HeaderReset, fmt.Sprint(seconds(reset)))
+	if allowed {
+		return true
+	}
+
+	if count := s.reject(r, key); count > 0 {
+		s.LogWarning("rate limit exceeded: path=", ctx.Path(), ", rule=", r.path, ", key=", key, ", rip=", ctx.RIP(),
+			", rejected=", count)
+	}
+
+	header.Set(HeaderRetry, fmt.Sprint(seconds(retry)))
+	ctx.Set(gtype.CtxStatusCode, http.StatusTooManyRequests)
+	ctx.Error(gtype.ErrTooMany, fmt.Sprintf("请%d秒后重试", seconds(retry)))
+	ctx.SetHandled(true)
+
+	return false
+}
+
+func (s *Limiter) match(path string) *rule {
+	s.rulesMutex.RLock()
+	defer s.rulesMutex.RUnlock()
+
+	for _, item := range s.rules {
+		if matchPath(path, item.path) {
+			return item
+		}
+	}
+
+	return nil
+}
+
+// matchPath 路径是否匹配规则的路径前缀: 与前缀相同, 或前缀之后为"/", 或前缀以"/"结尾,
+// 如"/api"匹配"/api"及"/api/user", 不匹配"/apis"
+func matchPath(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	if len(path) == len(prefix) || len(prefix) < 1 || strings.HasSuffix(prefix, "/") {
+		return true
+	}
+
+	return path[len(prefix)] == '/'
+}
+
+func (s *Limiter) key(ctx gtype.Context, r *rule) string {
+	key := ""
+	switch r.key {
+	case gcfg.RateLimitKeyToken:
+		key = ctx.Token()
+	case gcfg.RateLimitKeyCustom:
+		if s.keyFunc != nil {
+			key = s.keyFunc(ctx, r.cfg)
+		}
+	}
+	if len(key) > 0 {
+		return key
+	}
+
+	return ctx.RIP()
+}
+
+// take 从令牌桶中取出一个令牌，返回是否成功、剩余令牌数、令牌桶充满所需时间及获取下一个令牌所需时间
+func (s *Limiter) take(r *rule, key string) (bool, int, time.Duration, time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	id := bucketId(r.path, key)
+	b := s.bucket(r, id, now)
+	allowed := b.take(1)
+	if allowed && s.cluster && shared.isEnabled() {
+		s.consumed[id]++
+	}
+
+	return allowed, int(math.Floor(b.tokens)), b.wait(b.capacity), b.wait(1)
+}
+
+// reject 记录被拒绝的请求，每个键在warnInterval内最多返回一次自上次返回后被拒绝的请求数，其余返回0,
+// 避免持续超限时每个请求都输出日志
+func (s *Limiter) reject(r *rule, key string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	b := s.bucket(r, bucketId(r.path, key), now)
+	b.rejected++
+	if now.Sub(b.warned) < warnInterval {
+		return 0
+	}
+	count := b.rejected
+	b.rejected = 0
+	b.warned = now
+
+	return count
+}
+
+// consume 扣除其他集群实例已消耗的令牌
+func (s *Limiter) consume(path, key string, count float64) {
+	r := s.rule(path)
+	if r == nil || count <= 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b := s.bucket(r, bucketId(path, key), s.now())
+	b.tokens = math.Max(0, b.tokens-count)
+}
+
+// flush 返回并清空本实例自上次同步后消耗的令牌
+func (s *Limiter) flush() []*consumption {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.consumed) < 1 {
+		return nil
+	}
+
+	items := make([]*consumption, 0, len(s.consumed))
+	for id, count := range s.consumed {
+		path, key := splitBucketId(id)
+		items = append(items, &consumption{Path: path, Key: key, Count: count})
+	}
+	s.consumed = make(map[string]float64)
+
+	return items
+}
+
+func (s *Limiter) rule(path string) *rule {
+	s.rulesMutex.RLock()
+	defer s.rulesMutex.RUnlock()
+
+	for _, item := range s.rules {
+		if item.path == path {
+			return item
+		}
+	}
+
+	return nil
+}
+
+func (s *Limiter) bucket(r *rule, id string, now time.Time) *bucket {
+	b, ok := s.buckets[id]
+	if ok {
+		b.refill(now)
+	} else {
+		b = newBucket(r.rate, r.burst, now)
+		s.buckets[id] = b
+	}
+
+	return b
+}
+
+// sweep 定期删除已充满的令牌桶，避免键过多时占用内存
+func (s *Limiter) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for id, b := range s.buckets {
+		b.refill(now)
+		if b.full() {
+			delete(s.buckets, id)
+		}
+	}
+}
+
+type rule struct {
+	cfg   *gcfg.RateLimitRule
+	path  string
+	key   string
+	rate  float64
+	burst int
+}
+
+// newRules 创建规则(忽略rate不大于0的规则), 按路径前缀长度从长到短排序
+func newRules(items []*gcfg.RateLimitRule) []*rule {
+	rules := make([]*rule, 0, len(items))
+	for _, item := range items {
+		if item == nil || item.Rate <= 0 {
+			continue
+		}
+		rules = append(rules, newRule(item))
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].path) > len(rules[j].path)
+	})
+
+	return rules
+}
+
+func newRule(cfg *gcfg.RateLimitRule) *rule {
+	r := &rule{
+		cfg:   cfg,
+		path:  cfg.Path,
+		key:   strings.ToLower(cfg.Key),
+		rate:  cfg.Rate,
+		burst: cfg.Burst,
+	}
+	if r.burst < 1 {
+		r.burst = 1
+	}
+	if len(r.key) < 1 {
+		r.key = gcfg.RateLimitKeyIp
+	}
+
+	return r
+}
+
+func (s *rule) String() string {
+	path := s.path
+	if len(path) < 1 {
+		path = "/"
+	}
+
+	return fmt.Sprintf("%s: 每个%s每秒%g次, 突发%d次", path, s.key, s.rate, s.burst)
+}
+
+func bucketId(path, key string) string {
+	return path + "\n" + key
+}
+
+func splitBucketId(id string) (string, string) {
+	index := strings.Index(id, "\n")
+	if index < 0 {
+		return id, ""
+	}
+
+	return id[:index], id[index+1:]
+}
+
+func seconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
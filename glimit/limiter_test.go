@@ -0,0 +1,222 @@
+package glimit
+
+import (
+	"github.com/csby/gwsf/gcfg"
+	"github.com/csby/gwsf/gtype"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Check(t *testing.T) {
+	now := time.Now()
+	limiter := NewLimiter(nil, "test", &gcfg.RateLimit{
+		Rules: []*gcfg.RateLimitRule{
+			{Path: "/api", Rate: 10, Burst: 5},
+			{Path: "/api/login", Key: gcfg.RateLimitKeyToken, Rate: 0.5, Burst: 2},
+			{Path: "/disabled", Rate: 0},
+		},
+	})
+	limiter.now = func() time.Time { return now }
+
+	// 最长前缀匹配，按凭证计数
+	for i := 0; i < 2; i++ {
+		if ctx := newTestContext("/api/login", "1.1.1.1", "t1"); !limiter.Check(ctx) {
+			t.Fatal("request", i, "should be allowed")
+		}
+	}
+	ctx := newTestContext("/api/login", "1.1.1.1", "t1")
+	if limiter.Check(ctx) {
+		t.Fatal("request should be rejected")
+	}
+	if ctx.keys[gtype.CtxStatusCode] != http.StatusTooManyRequests || ctx.code != gtype.ErrTooMany.Code() || !ctx.handled {
+		t.Fatal("rejection:", ctx.keys, ctx.code, ctx.handled)
+	}
+	header := ctx.response.Header()
+	if header.Get(HeaderLimit) != "2" || header.Get(HeaderRemaining) != "0" ||
+		header.Get(HeaderRetry) != "2" || header.Get(HeaderReset) != "4" {
+		t.Fatal("headers:", header)
+	}
+
+	// 其他凭证及其他规则不受影响
+	if !limiter.Check(newTestContext("/api/login", "1.1.1.1", "t2")) {
+		t.Fatal("other token should be allowed")
+	}
+	if !limiter.Check(newTestContext("/api/user", "1.1.1.1", "t1")) {
+		t.Fatal("other rule should be allowed")
+	}
+	for i := 0; i < 10; i++ {
+		if !limiter.Check(newTestContext("/disabled", "1.1.1.1", "")) {
+			t.Fatal("unmatched path should be allowed")
+		}
+	}
+
+	// 补充令牌
+	now = now.Add(2 * time.Second)
+	if !limiter.Check(newTestContext("/api/login", "1.1.1.1", "t1")) {
+		t.Fatal("request should be allowed after refill")
+	}
+
+	// 定期删除已充满的令牌桶
+	now = now.Add(sweepInterval)
+	limiter.Check(newTestContext("/api/user", "2.2.2.2", ""))
+	if len(limiter.buckets) != 1 {
+		t.Fatal("buckets after sweep:", len(limiter.buckets))
+	}
+}
+
+func TestLimiter_Custom(t *testing.T) {
+	limiter := NewLimiter(nil, "test", &gcfg.RateLimit{
+		Rules: []*gcfg.RateLimitRule{
+			{Path: "/", Key: gcfg.RateLimitKeyCustom, Rate: 1, Burst: 1},
+		},
+		Key: func(ctx gtype.Context, rule *gcfg.RateLimitRule) string {
+			return ctx.Path()
+		},
+	})
+
+	if !limiter.Check(newTestContext("/a", "1.1.1.1", "")) || !limiter.Check(newTestContext("/b", "1.1.1.1", "")) {
+		t.Fatal("different keys should be allowed")
+	}
+	if limiter.Check(newTestContext("/a", "2.2.2.2", "")) {
+		t.Fatal("same key should be rejected")
+	}
+
+	// 重新加载规则后清空计数
+	limiter.Reload(&gcfg.RateLimit{
+		Rules: []*gcfg.RateLimitRule{
+			{Path: "/b", Rate: 1, Burst: 1},
+		},
+	})
+	if !limiter.Check(newTestContext("/a", "2.2.2.2", "")) || !limiter.Check(newTestContext("/b", "2.2.2.2", "")) {
+		t.Fatal("requests should be allowed after reload")
+	}
+	if limiter.Check(newTestContext("/b", "2.2.2.2", "")) {
+		t.Fatal("reloaded rule should apply")
+	}
+}
+
+func TestLimiter_Consume(t *testing.T) {
+	limiter := NewLimiter(nil, "test", &gcfg.RateLimit{
+		Rules: []*gcfg.RateLimitRule{
+			{Path: "/api", Rate: 1, Burst: 3},
+		},
+	})
+	limiter.cluster = true
+	shared.enabled = 1
+	defer func() { shared.enabled = 0 }()
+
+	limiter.Check(newTestContext("/api", "1.1.1.1", ""))
+	items := limiter.flush()
+	if len(items) != 1 || items[0].Path != "/api" || items[0].Key != "1.1.1.1" || items[0].Count != 1 {
+		t.Fatal("consumed:", items)
+	}
+	if limiter.flush() != nil {
+		t.Fatal("consumed should be cleared after flush")
+	}
+
+	// 扣除其他实例消耗的令牌
+	limiter.consume("/api", "1.1.1.1", 2)
+	if limiter.Check(newTestContext("/api", "1.1.1.1", "")) {
+		t.Fatal("request should be rejected after consumed by others")
+	}
+}
+
+func TestLimiter_Match(t *testing.T) {
+	limiter := NewLimiter(nil, "test", &gcfg.RateLimit{
+		Rules: []*gcfg.RateLimitRule{
+			{Path: "/api", Rate: 1},
+			{Path: "/static/", Rate: 1},
+		},
+	})
+
+	tests := map[string]string{
+		"/api":          "/api",
+		"/api/":         "/api",
+		"/api/user":     "/api",
+		"/apis":         "",
+		"/api-docs/x":   "",
+		"/static/a.js":  "/static/",
+		"/static":       "",
+		"/staticx/a.js": "",
+	}
+	for path, want := range tests {
+		got := ""
+		if r := limiter.match(path); r != nil {
+			got = r.path
+		}
+		if got != want {
+			t.Errorf("%s: rule = %q, want %q", path, got, want)
+		}
+	}
+
+	limiter.Reload(&gcfg.RateLimit{
+		Rules: []*gcfg.RateLimitRule{
+			{Path: "", Rate: 1},
+		},
+	})
+	if limiter.match("/any") == nil {
+		t.Error("empty path should match all")
+	}
+}
+
+func TestLimiter_Reject(t *testing.T) {
+	now := time.Now()
+	limiter := NewLimiter(nil, "test", &gcfg.RateLimit{
+		Rules: []*gcfg.RateLimitRule{
+			{Path: "/api", Rate: 1, Burst: 1},
+		},
+	})
+	limiter.now = func() time.Time { return now }
+	r := limiter.match("/api")
+
+	// 每个键在warnInterval内只输出一次日志
+	if n := limiter.reject(r, "1.1.1.1"); n != 1 {
+		t.Fatal("first rejection:", n)
+	}
+	for i := 0; i < 10; i++ {
+		if n := limiter.reject(r, "1.1.1.1"); n != 0 {
+			t.Fatal("rejection within interval:", n)
+		}
+	}
+	if n := limiter.reject(r, "2.2.2.2"); n != 1 {
+		t.Fatal("rejection of other key:", n)
+	}
+
+	// 超过间隔后返回期间被拒绝的请求数
+	now = now.Add(warnInterval)
+	if n := limiter.reject(r, "1.1.1.1"); n != 11 {
+		t.Fatal("rejection after interval:", n)
+	}
+}
+
+type testContext struct {
+	gtype.Context
+
+	path     string
+	rip      string
+	token    string
+	response *httptest.ResponseRecorder
+	keys     map[string]interface{}
+	code     int
+	handled  bool
+}
+
+func newTestContext(path, rip, token string) *testContext {
+	return &testContext{
+		path:     path,
+		rip:      rip,
+		token:    token,
+		response: httptest.NewRecorder(),
+		keys:     make(map[string]interface{}),
+	}
+}
+
+func (s *testContext) Path() string                                 { return s.path }
+func (s *testContext) RIP() string                                  { return s.rip }
+func (s *testContext) Token() string                                { return s.token }
+func (s *testContext) Response() http.ResponseWriter                { return s.response }
+func (s *testContext) Set(key string, val interface{})              { s.keys[key] = val }
+func (s *testContext) SetHandled(v bool)                            { s.handled = v }
+func (s *testContext) Error(err gtype.Error, detail ...interface{}) { s.code = err.Code() }
@@ -1,5 +1,6 @@
 package gmodel
 
 type ProxyServiceSetting struct {
-	Disable bool `json:"disable" note:"已禁用"`
+	Disable      bool `json:"disable" note:"已禁用"`
+	DrainTimeout int  `json:"drainTimeout" note:"停止服务时等待已有连接结束的超时时间（秒），超时后强制关闭，0表示立即关闭"`
 }
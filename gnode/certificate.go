@@ -3,6 +3,7 @@ package gnode
 import (
 	"crypto/tls"
 	"github.com/csby/gsecurity/gcrt"
+	"github.com/csby/gwsf/gcert"
 	"github.com/csby/gwsf/gcfg"
 	"github.com/csby/gwsf/gtype"
 )
@@ -10,59 +11,50 @@ import (
 type Certificate struct {
 	gtype.Base
 
-	ca   *gcrt.Crt
-	node *gcrt.Pfx
+	store *gcert.Store
 }
 
 func (s *Certificate) Ca() *gcrt.Crt {
-	return s.ca
+	if s.store == nil {
+		return nil
+	}
+
+	return s.store.Ca()
 }
 
 func (s *Certificate) Node() *gcrt.Pfx {
-	return s.node
+	if s.store == nil {
+		return nil
+	}
+
+	return s.store.Pfx()
 }
 
+// Load 加载证书，证书文件或配置的路径改变时，新建立的连接使用新的证书
 func (s *Certificate) Load(cfg *gcfg.Crt) {
 	if cfg == nil {
 		return
 	}
 
-	caFilePath := cfg.Ca.File
-	s.LogInfo("node ca file: ", caFilePath)
-	pfxFilePath := cfg.Server.File
-	s.LogInfo("node pfx file: ", pfxFilePath)
-	pfx := &gcrt.Pfx{}
-	err := pfx.FromFile(pfxFilePath, cfg.Server.Password)
+	s.store = gcert.NewStore(s.GetLog(), "node", func() *gcfg.Crt {
+		crt := &gcfg.Crt{}
+		gcfg.Read(func() {
+			*crt = *cfg
+		})
+		return crt
+	})
+	err := s.store.Load()
 	if err != nil {
-		s.node = nil
-		s.LogError("load node pfx file fail: ", err)
-	} else {
-		s.node = pfx
-	}
-
-	if len(caFilePath) > 0 {
-		crt := &gcrt.Crt{}
-		err = crt.FromFile(caFilePath)
-		if err != nil {
-			s.ca = nil
-			s.LogError("load node ca file fail: ", err)
-		} else {
-			s.ca = crt
-		}
-	} else {
-		s.ca = nil
+		s.LogError(err)
 	}
 }
 
 func (s *Certificate) ClientTlsConfig() *tls.Config {
-	cfg := &tls.Config{}
-
-	if s.ca != nil {
-		cfg.RootCAs = s.ca.Pool()
-	}
-	if s.node != nil {
-		cfg.Certificates = s.node.TlsCertificates()
+	if s.store == nil {
+		return &tls.Config{
+			InsecureSkipVerify: false,
+		}
 	}
 
-	return cfg
+	return s.store.ClientTlsConfig(false)
 }
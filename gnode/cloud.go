@@ -21,6 +21,11 @@ type Cloud interface {
 	PostJson(uri string, argument interface{}) *gtype.Result
 }
 
+// closer 可选接口, 关闭与云端的连接并停止重连
+type closer interface {
+	Close()
+}
+
 func NewCloud(log gtype.Log, cfg *gcfg.Config, dialer *websocket.Dialer, chs *Channels) Cloud {
 	instance := &innerCloud{
 		isConnected: false,
@@ -44,6 +49,10 @@ type innerCloud struct {
 	nodeChannel gtype.SocketChannel
 
 	state func(isConnected bool)
+
+	mutex  sync.Mutex
+	closed bool
+	conn   *websocket.Conn
 }
 
 func (s *innerCloud) IsConnected() bool {
@@ -80,9 +89,43 @@ func (s *innerCloud) Connect() error {
 	return nil
 }
 
+// Close 关闭与云端的连接并停止重连, 用于服务关闭
+func (s *innerCloud) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+func (s *innerCloud) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.closed
+}
+
+// setConn 设置当前连接, 已关闭时返回false
+func (s *innerCloud) setConn(conn *websocket.Conn) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if conn != nil && s.closed {
+		return false
+	}
+	s.conn = conn
+
+	return true
+}
+
 func (s *innerCloud) doConnect(uri, host string) {
 	for {
 		time.Sleep(time.Second)
+		if s.isClosed() {
+			return
+		}
 
 		s.connect(uri, host)
 	}
@@ -94,6 +137,11 @@ func (s *innerCloud) connect(uri, host string) {
 		s.LogDebug("node connect to cloud fail:", err)
 		return
 	}
+	if !s.setConn(websocketConn) {
+		websocketConn.Close()
+		return
+	}
+	defer s.setConn(nil)
 	defer func(conn io.Closer, h string) {
 		s.setConnected(false)
 		conn.Close()
@@ -1,6 +1,7 @@
 package gnode
 
 import (
+	"context"
 	"github.com/csby/gwsf/gcfg"
 	"github.com/csby/gwsf/gtype"
 	"github.com/gorilla/websocket"
@@ -42,9 +43,10 @@ func NewHandler(log gtype.Log, cfg *gcfg.Config, optChannels gtype.SocketChannel
 	if cfg != nil {
 		instance.controller.nodeInstance = cfg.Node.InstanceId
 	}
-	if crt.node != nil {
-		instance.controller.nodeId = crt.node.OrganizationalUnit()
-		instance.controller.nodeName = crt.node.CommonName()
+	node := crt.Node()
+	if node != nil {
+		instance.controller.nodeId = node.OrganizationalUnit()
+		instance.controller.nodeName = node.CommonName()
 	}
 	instance.forward.SetState(instance.controller.onNodeFwdInputListenStateChanged)
 	instance.cloud.SetState(instance.controller.onNodeOnlineStateChanged)
@@ -85,3 +87,11 @@ func (s *innerHandler) Cloud() Cloud {
 func (s *innerHandler) Forward() Forward {
 	return s.forward
 }
+
+// Shutdown 停止转发并关闭与云端的连接, 实现gtype.ShutdownHandler, 用于服务关闭
+func (s *innerHandler) Shutdown(ctx context.Context) {
+	s.forward.Stop()
+	if c, ok := s.cloud.(closer); ok {
+		c.Close()
+	}
+}
@@ -24,8 +24,18 @@ func NewProxy(log gtype.Log, cfg *gcfg.Config, wsc gtype.SocketChannelCollection
 		OnDisconnected:           inst.onProxyDisconnected,
 		OnTargetAliveChanged:     inst.onTargetAliveChanged,
 		OnTargetConnCountChanged: inst.onTargetConnCountChanged,
+		DrainTimeout:             time.Duration(cfg.ReverseProxy.DrainTimeout) * time.Second,
 	}
 	inst.proxyServer.SetLog(log)
+	history := cfg.ReverseProxy.History
+	if len(history.Folder) > 0 {
+		h, err := gproxy.NewLinkHistory(history.Folder, int64(history.MaxSize)*1024*1024, history.MaxFiles)
+		if err != nil {
+			inst.LogError("create proxy link history fail:", err)
+		} else {
+			inst.proxyHistory = h
+		}
+	}
 	inst.proxyTargets = &ProxyTargetCollection{
 		items: make(map[string]ProxyTargetItem),
 	}
@@ -45,6 +55,7 @@ type Proxy struct {
 
 	proxyServer  *gproxy.Server
 	proxyLinks   gproxy.LinkCollection
+	proxyHistory *gproxy.LinkHistory
 	proxyTargets *ProxyTargetCollection
 }
 
@@ -81,10 +92,47 @@ func (s *Proxy) GetProxyServersDoc(doc gtype.Doc, method string, uri gtype.Uri)
 				Id: gtype.NewGuid(),
 			},
 			ProxyServerAdd: gcfg.ProxyServerAdd{
-				Name:    "https",
-				Disable: false,
-				IP:      "",
-				Port:    "443",
+				Name:      "https",
+				Disable:   false,
+				TLS:       true,
+				IP:        "",
+				Port:      "443",
+				Terminate: true,
+				Certificates: []gcfg.CrtPfx{
+					{
+						File:     "/usr/local/gwsf/crt/server.pfx",
+						Password: "",
+					},
+				},
+			},
+		},
+		{
+			ProxyServerDel: gcfg.ProxyServerDel{
+				Id: gtype.NewGuid(),
+			},
+			ProxyServerAdd: gcfg.ProxyServerAdd{
+				Name:     "web",
+				Disable:  false,
+				IP:       "",
+				Port:     "8000",
+				Protocol: gcfg.ProxyProtocolHttp,
+				Bandwidth: gcfg.ProxyBandwidth{
+					Download:       10 * 1024 * 1024,
+					ClientDownload: 1024 * 1024,
+				},
+			},
+		},
+		{
+			ProxyServerDel: gcfg.ProxyServerDel{
+				Id: gtype.NewGuid(),
+			},
+			ProxyServerAdd: gcfg.ProxyServerAdd{
+				Name:        "dns",
+				Disable:     false,
+				IP:          "",
+				Port:        "53",
+				Protocol:    gcfg.ProxyProtocolUdp,
+				IdleTimeout: 30,
 			},
 		},
 	})
@@ -99,24 +147,8 @@ func (s *Proxy) AddProxyServer(ctx gtype.Context, ps gtype.Params) {
 		ctx.Error(gtype.ErrInput, err)
 		return
 	}
-	if len(argument.Name) < 1 {
-		ctx.Error(gtype.ErrInput, "名称为空")
-		return
-	}
-	if len(argument.IP) > 0 {
-		addr := net.ParseIP(argument.IP)
-		if addr == nil {
-			ctx.Error(gtype.ErrInput, fmt.Sprintf("IP地址(%s)无效", argument.IP))
-			return
-		}
-	}
-	if len(argument.Port) < 1 {
-		ctx.Error(gtype.ErrInput, "监听端口为空")
-		return
-	}
-	port, err := strconv.ParseUint(argument.Port, 10, 16)
-	if err != nil || port < 1 {
-		ctx.Error(gtype.ErrInput, fmt.Sprintf("监听端口(%s)无效", argument.Port))
+	if err = validateProxyServer(argument); err != nil {
+		ctx.Error(gtype.ErrInput, err)
 		return
 	}
 
@@ -179,7 +211,7 @@ func (s *Proxy) DelProxyServer(ctx gtype.Context, ps gtype.Params) {
 		return
 	}
 
-	s.initRoutes()
+	s.applyRoutes()
 	ctx.Success(nil)
 
 	go s.writeOptMessage(gtype.WSReviseProxyServerDel, &gcfg.ProxyServerDel{Id: argument.Id})
@@ -209,24 +241,8 @@ func (s *Proxy) ModifyProxyServer(ctx gtype.Context, ps gtype.Params) {
 		ctx.Error(gtype.ErrInput, "ID为空")
 		return
 	}
-	if len(argument.Name) < 1 {
-		ctx.Error(gtype.ErrInput, "名称为空")
-		return
-	}
-	if len(argument.IP) > 0 {
-		addr := net.ParseIP(argument.IP)
-		if addr == nil {
-			ctx.Error(gtype.ErrInput, fmt.Sprintf("IP地址(%s)无效", argument.IP))
-			return
-		}
-	}
-	if len(argument.Port) < 1 {
-		ctx.Error(gtype.ErrInput, "监听端口为空")
-		return
-	}
-	port, err := strconv.ParseUint(argument.Port, 10, 16)
-	if err != nil || port < 1 {
-		ctx.Error(gtype.ErrInput, fmt.Sprintf("监听端口(%s)无效", argument.Port))
+	if err = validateProxyServer(argument); err != nil {
+		ctx.Error(gtype.ErrInput, err)
 		return
 	}
 
@@ -242,7 +258,7 @@ func (s *Proxy) ModifyProxyServer(ctx gtype.Context, ps gtype.Params) {
 		return
 	}
 
-	s.initRoutes()
+	s.applyRoutes()
 	ctx.Success(nil)
 
 	go s.writeOptMessage(gtype.WSReviseProxyServerMod, argument)
@@ -306,10 +322,24 @@ func (s *Proxy) GetProxyTargetsDoc(doc gtype.Doc, method string, uri gtype.Uri)
 			Port:    "8080",
 			Version: 0,
 			Disable: false,
+			Weight:  2,
+			Balance: int(gproxy.BalanceRoundRobin),
+			Check: gcfg.ProxyCheck{
+				Type:     int(gproxy.CheckHttp),
+				Interval: 5,
+				Timeout:  1000,
+				Rise:     2,
+				Fall:     3,
+				Path:     "/health",
+				Status:   200,
+				Failures: 3,
+				Cooldown: 30,
+			},
 			Spares: []*gcfg.ProxySpare{
 				{
-					IP:   "192.168.210.18",
-					Port: "8080",
+					IP:     "192.168.210.18",
+					Port:   "8080",
+					Weight: 1,
 				},
 			},
 		},
@@ -327,6 +357,37 @@ func (s *Proxy) GetProxyTargetsDoc(doc gtype.Doc, method string, uri gtype.Uri)
 				},
 			},
 		},
+		{
+			Id:          gtype.NewGuid(),
+			Domain:      "test.com",
+			Path:        "/api",
+			IP:          "192.168.210.9",
+			Port:        "8080",
+			PathRewrite: "/",
+			RequestHeader: gcfg.ProxyHeader{
+				Set: map[string]string{
+					"X-Gateway": "gwsf",
+				},
+				Remove: []string{"Cookie"},
+			},
+			ResponseHeader: gcfg.ProxyHeader{
+				Remove: []string{"Server", "X-Powered-By"},
+			},
+		},
+		{
+			Id:      gtype.NewGuid(),
+			Domain:  "*.test.com",
+			Sources: []string{"10.0.0.0/8"},
+			IP:      "192.168.210.10",
+			Port:    "8080",
+		},
+		{
+			Id:              gtype.NewGuid(),
+			Domain:          "svc.test.com",
+			IP:              "srv://_http._tcp.backend.local",
+			ResolveInterval: 60,
+			Balance:         int(gproxy.BalanceRoundRobin),
+		},
 	})
 	function.AddOutputError(gtype.ErrInput)
 	function.AddOutputError(gtype.ErrInternal)
@@ -340,37 +401,10 @@ func (s *Proxy) AddProxyTarget(ctx gtype.Context, ps gtype.Params) {
 		ctx.Error(gtype.ErrInput, err)
 		return
 	}
-	if len(argument.Target.IP) < 1 {
-		ctx.Error(gtype.ErrInput, "目标地址为空")
-		return
-	}
-	if len(argument.Target.Port) < 1 {
-		ctx.Error(gtype.ErrInput, "目标端口为空")
-		return
-	}
-	port, err := strconv.ParseUint(argument.Target.Port, 10, 16)
-	if err != nil || port < 1 {
-		ctx.Error(gtype.ErrInput, fmt.Sprintf("目标端口(%s)无效", argument.Target.Port))
+	if err = validateProxyTarget(&argument.Target); err != nil {
+		ctx.Error(gtype.ErrInput, err)
 		return
 	}
-	c := len(argument.Target.Spares)
-	if c > 0 {
-		for i := 0; i < c; i++ {
-			spare := argument.Target.Spares[i]
-			if spare == nil {
-				ctx.Error(gtype.ErrInput, "备用目标项目为空")
-				return
-			}
-			if len(spare.IP) < 1 {
-				ctx.Error(gtype.ErrInput, "备用目标地址为空")
-				return
-			}
-			if len(spare.Port) < 1 {
-				ctx.Error(gtype.ErrInput, "备用目标端口为空")
-				return
-			}
-		}
-	}
 
 	if len(argument.ServerId) < 1 {
 		ctx.Error(gtype.ErrInput, "服务器标识ID为空")
@@ -395,7 +429,7 @@ func (s *Proxy) AddProxyTarget(ctx gtype.Context, ps gtype.Params) {
 		return
 	}
 
-	s.initRoutes()
+	s.applyRoutes()
 	ctx.Success(nil)
 
 	go s.writeOptMessage(gtype.WSReviseProxyTargetAdd, argument)
@@ -414,10 +448,24 @@ func (s *Proxy) AddProxyTargetDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 			Port:    "8080",
 			Version: 0,
 			Disable: false,
+			Weight:  2,
+			Balance: int(gproxy.BalanceRoundRobin),
+			Check: gcfg.ProxyCheck{
+				Type:     int(gproxy.CheckHttp),
+				Interval: 5,
+				Timeout:  1000,
+				Rise:     2,
+				Fall:     3,
+				Path:     "/health",
+				Status:   200,
+				Failures: 3,
+				Cooldown: 30,
+			},
 			Spares: []*gcfg.ProxySpare{
 				{
-					IP:   "192.168.210.18",
-					Port: "8080",
+					IP:     "192.168.210.18",
+					Port:   "8080",
+					Weight: 1,
 				},
 			},
 		},
@@ -461,7 +509,7 @@ func (s *Proxy) DelProxyTarget(ctx gtype.Context, ps gtype.Params) {
 		return
 	}
 
-	s.initRoutes()
+	s.applyRoutes()
 	ctx.Success(nil)
 
 	go s.writeOptMessage(gtype.WSReviseProxyTargetDel, argument)
@@ -496,38 +544,11 @@ func (s *Proxy) ModifyProxyTarget(ctx gtype.Context, ps gtype.Params) {
 		ctx.Error(gtype.ErrInput, "目标地址标识ID为空")
 		return
 	}
-	if len(argument.Target.IP) < 1 {
-		ctx.Error(gtype.ErrInput, "目标地址为空")
-		return
-	}
-	if len(argument.Target.Port) < 1 {
-		ctx.Error(gtype.ErrInput, "目标端口为空")
+	if err = validateProxyTarget(&argument.Target); err != nil {
+		ctx.Error(gtype.ErrInput, err)
 		return
 	}
-	c := len(argument.Target.Spares)
-	if c > 0 {
-		for i := 0; i < c; i++ {
-			spare := argument.Target.Spares[i]
-			if spare == nil {
-				ctx.Error(gtype.ErrInput, "备用目标项目为空")
-				return
-			}
-			if len(spare.IP) < 1 {
-				ctx.Error(gtype.ErrInput, "备用目标地址为空")
-				return
-			}
-			if len(spare.Port) < 1 {
-				ctx.Error(gtype.ErrInput, "备用目标端口为空")
-				return
-			}
-		}
-	}
 
-	port, err := strconv.ParseUint(argument.Target.Port, 10, 16)
-	if err != nil || port < 1 {
-		ctx.Error(gtype.ErrInput, fmt.Sprintf("目标端口(%s)无效", argument.Target.Port))
-		return
-	}
 	server := s.cfg.ReverseProxy.GetServer(argument.ServerId)
 	if server == nil {
 		ctx.Error(gtype.ErrInput, fmt.Sprintf("server id '%s' not exist", argument.ServerId))
@@ -570,7 +591,7 @@ func (s *Proxy) ModifyProxyTarget(ctx gtype.Context, ps gtype.Params) {
 		}
 	}
 
-	s.initRoutes()
+	s.applyRoutes()
 	ctx.Success(nil)
 
 	go s.writeOptMessage(gtype.WSReviseProxyTargetMod, &gcfg.ProxyTargetEdit{
@@ -592,10 +613,24 @@ func (s *Proxy) ModifyProxyTargetDoc(doc gtype.Doc, method string, uri gtype.Uri
 			Port:    "8080",
 			Version: 0,
 			Disable: false,
+			Weight:  2,
+			Balance: int(gproxy.BalanceRoundRobin),
+			Check: gcfg.ProxyCheck{
+				Type:     int(gproxy.CheckHttp),
+				Interval: 5,
+				Timeout:  1000,
+				Rise:     2,
+				Fall:     3,
+				Path:     "/health",
+				Status:   200,
+				Failures: 3,
+				Cooldown: 30,
+			},
 			Spares: []*gcfg.ProxySpare{
 				{
-					IP:   "192.168.210.18",
-					Port: "8080",
+					IP:     "192.168.210.18",
+					Port:   "8080",
+					Weight: 1,
 				},
 			},
 		},
@@ -606,9 +641,64 @@ func (s *Proxy) ModifyProxyTargetDoc(doc gtype.Doc, method string, uri gtype.Uri
 	function.AddOutputError(gtype.ErrTokenInvalid)
 }
 
+func (s *Proxy) DrainProxyTarget(ctx gtype.Context, ps gtype.Params) {
+	argument := &gcfg.ProxyTargetDrain{}
+	err := ctx.GetJson(argument)
+	if err != nil {
+		ctx.Error(gtype.ErrInput, err)
+		return
+	}
+	if len(argument.AddrId) < 1 {
+		ctx.Error(gtype.ErrInput, "地址标识为空")
+		return
+	}
+	item := s.proxyTargets.GetItem(argument.AddrId)
+	if item == nil {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("地址标识'%s'不存在", argument.AddrId))
+		return
+	}
+
+	item.SetDraining(argument.Draining)
+	err = s.saveConfig()
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return
+	}
+
+	s.proxyServer.Drain(argument.AddrId, argument.Draining)
+	ctx.Success(argument)
+
+	go s.writeOptMessage(gtype.WSReviseProxyTargetStatusChanged, &ProxyTargetEntry{
+		SourceId: item.SourceId(),
+		TargetId: item.TargetId(),
+		AddrId:   argument.AddrId,
+		Alive:    item.IsAlive(),
+		Count:    item.Count(),
+		Draining: item.IsDraining(),
+	})
+}
+
+func (s *Proxy) DrainProxyTargetDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.proxyCatalog(doc)
+	function := catalog.AddFunction(method, uri, "排空目标地址")
+	function.SetNote("设置目标地址(或备用目标地址)的排空状态，排空时新连接分配给其他可用地址，已有连接继续直到结束，用于滚动重启后端服务")
+	function.SetInputJsonExample(&gcfg.ProxyTargetDrain{
+		AddrId:   gtype.NewGuid(),
+		Draining: true,
+	})
+	function.SetOutputDataExample(&gcfg.ProxyTargetDrain{
+		AddrId:   gtype.NewGuid(),
+		Draining: true,
+	})
+	function.AddOutputError(gtype.ErrInput)
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+}
+
 func (s *Proxy) GetProxyServiceSetting(ctx gtype.Context, ps gtype.Params) {
 	data := &gmodel.ProxyServiceSetting{
-		Disable: s.cfg.ReverseProxy.Disable,
+		Disable:      s.cfg.ReverseProxy.Disable,
+		DrainTimeout: s.cfg.ReverseProxy.DrainTimeout,
 	}
 
 	ctx.Success(data)
@@ -619,7 +709,8 @@ func (s *Proxy) GetProxyServiceSettingDoc(doc gtype.Doc, method string, uri gtyp
 	function := catalog.AddFunction(method, uri, "获取服务设置")
 	function.SetNote("获取反向代理服务设置")
 	function.SetOutputDataExample(&gmodel.ProxyServiceSetting{
-		Disable: false,
+		Disable:      false,
+		DrainTimeout: 30,
 	})
 	function.AddOutputError(gtype.ErrInternal)
 	function.AddOutputError(gtype.ErrTokenInvalid)
@@ -627,19 +718,27 @@ func (s *Proxy) GetProxyServiceSettingDoc(doc gtype.Doc, method string, uri gtyp
 
 func (s *Proxy) SetProxyServiceSetting(ctx gtype.Context, ps gtype.Params) {
 	argument := &gmodel.ProxyServiceSetting{
-		Disable: s.cfg.ReverseProxy.Disable,
+		Disable:      s.cfg.ReverseProxy.Disable,
+		DrainTimeout: s.cfg.ReverseProxy.DrainTimeout,
 	}
 	err := ctx.GetJson(argument)
 	if err != nil {
 		ctx.Error(gtype.ErrInput, err)
 		return
 	}
-	if argument.Disable == s.cfg.ReverseProxy.Disable {
+	if argument.DrainTimeout < 0 {
+		ctx.Error(gtype.ErrInput, fmt.Sprintf("超时时间(%d)无效", argument.DrainTimeout))
+		return
+	}
+	if argument.Disable == s.cfg.ReverseProxy.Disable &&
+		argument.DrainTimeout == s.cfg.ReverseProxy.DrainTimeout {
 		ctx.Success(argument)
 		return
 	}
 
 	s.cfg.ReverseProxy.Disable = argument.Disable
+	s.cfg.ReverseProxy.DrainTimeout = argument.DrainTimeout
+	s.proxyServer.DrainTimeout = time.Duration(argument.DrainTimeout) * time.Second
 	err = s.saveConfig()
 	if err != nil {
 		ctx.Error(gtype.ErrInternal, err)
@@ -647,7 +746,7 @@ func (s *Proxy) SetProxyServiceSetting(ctx gtype.Context, ps gtype.Params) {
 	}
 
 	if argument.Disable {
-		s.proxyServer.Stop()
+		go s.proxyServer.Stop()
 	}
 
 	ctx.Success(argument)
@@ -658,16 +757,30 @@ func (s *Proxy) SetProxyServiceSettingDoc(doc gtype.Doc, method string, uri gtyp
 	function := catalog.AddFunction(method, uri, "修改服务设置")
 	function.SetNote("修改反向代理服务设置")
 	function.SetInputJsonExample(&gmodel.ProxyServiceSetting{
-		Disable: false,
+		Disable:      false,
+		DrainTimeout: 30,
 	})
 	function.SetOutputDataExample(&gmodel.ProxyServiceSetting{
-		Disable: false,
+		Disable:      false,
+		DrainTimeout: 30,
 	})
 	function.AddOutputError(gtype.ErrInput)
 	function.AddOutputError(gtype.ErrInternal)
 	function.AddOutputError(gtype.ErrTokenInvalid)
 }
 
+// Shutdown 停止反向代理服务, 未运行时忽略
+func (s *Proxy) Shutdown() {
+	if s.proxyServer.Result().Status != gproxy.StatusRunning {
+		return
+	}
+
+	err := s.proxyServer.Stop()
+	if err != nil {
+		s.LogError("stop reverse proxy service fail: ", err)
+	}
+}
+
 func (s *Proxy) StartProxyService(ctx gtype.Context, ps gtype.Params) {
 	if s.cfg.ReverseProxy.Disable {
 		ctx.Error(gtype.ErrInternal, "服务已禁用")
@@ -778,6 +891,11 @@ func (s *Proxy) GetProxyLinksDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 			Domain:     "test.com",
 			SourceAddr: "10.3.2.18:25312",
 			TargetAddr: "192.168.1.6:8080",
+			SourceId:   gtype.NewGuid(),
+			TargetId:   gtype.NewGuid(),
+			BytesIn:    2 * 1024,
+			BytesOut:   512 * 1024,
+			Duration:   3500,
 		},
 		{
 			Id:         gtype.NewGuid(),
@@ -786,6 +904,147 @@ func (s *Proxy) GetProxyLinksDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 			Domain:     "test.com.cn",
 			SourceAddr: "10.7.32.26:53127",
 			TargetAddr: "192.168.1.86:8443",
+			SourceId:   gtype.NewGuid(),
+			TargetId:   gtype.NewGuid(),
+			BytesIn:    6 * 1024,
+			BytesOut:   1024 * 1024,
+			Duration:   12000,
+		},
+	})
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+}
+
+func (s *Proxy) GetProxyLinkHistory(ctx gtype.Context, ps gtype.Params) {
+	argument := &gproxy.LinkHistoryFilter{}
+	ctx.GetJson(argument)
+	data, ok := s.queryLinkHistory(ctx, argument)
+	if !ok {
+		return
+	}
+
+	ctx.Success(data)
+}
+
+func (s *Proxy) GetProxyLinkHistoryDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	now := gtype.DateTime(time.Now())
+	start := gtype.DateTime(time.Now().Add(-24 * time.Hour))
+	catalog := s.proxyCatalog(doc)
+	function := catalog.AddFunction(method, uri, "获取连接历史")
+	function.SetNote("获取已断开连接的历史记录，按断开时间倒序排列，需在配置中设置历史记录文件夹(reverseProxy.history.folder)")
+	function.SetInputJsonExample(&gproxy.LinkHistoryFilter{
+		LinkFilter: gproxy.LinkFilter{
+			Domain: "test.com",
+		},
+		StartTime: &start,
+		EndTime:   &now,
+		Limit:     100,
+	})
+	function.SetOutputDataExample([]*gproxy.Link{
+		{
+			Id:          gtype.NewGuid(),
+			Time:        now,
+			Protocol:    gproxy.ProtocolTcp,
+			ListenAddr:  ":80",
+			Domain:      "test.com",
+			SourceAddr:  "10.3.2.18:25312",
+			TargetAddr:  "192.168.1.6:8080",
+			Status:      1,
+			SourceId:    gtype.NewGuid(),
+			TargetId:    gtype.NewGuid(),
+			BytesIn:     2 * 1024,
+			BytesOut:    512 * 1024,
+			Duration:    3500,
+			CloseReason: "client closed",
+		},
+	})
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrNotSupport)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+}
+
+func (s *Proxy) ExportProxyLinkHistory(ctx gtype.Context, ps gtype.Params) {
+	argument := &gproxy.LinkHistoryFilter{}
+	ctx.GetJson(argument)
+	data, ok := s.queryLinkHistory(ctx, argument)
+	if !ok {
+		return
+	}
+
+	fileName := fmt.Sprintf("proxy-links-%s.csv", time.Now().Format("20060102150405"))
+	ctx.Response().Header().Set("Content-Type", "text/csv; charset=utf-8")
+	ctx.Response().Header().Set("Content-Disposition", fmt.Sprint("attachment; filename=", fileName))
+	err := gproxy.WriteLinksCsv(ctx.Response(), data)
+	if err != nil {
+		s.LogError("export proxy link history fail:", err)
+	}
+}
+
+func (s *Proxy) ExportProxyLinkHistoryDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	now := gtype.DateTime(time.Now())
+	start := gtype.DateTime(time.Now().Add(-24 * time.Hour))
+	catalog := s.proxyCatalog(doc)
+	function := catalog.AddFunction(method, uri, "导出连接历史")
+	function.SetNote("按条件导出已断开连接的历史记录(.csv)，字段：time, protocol, listenAddr, domain, sourceAddr, targetAddr, bytesIn, bytesOut, duration, closeReason")
+	function.SetInputJsonExample(&gproxy.LinkHistoryFilter{
+		SourceAddr: "10.3.2.18",
+		StartTime:  &start,
+		EndTime:    &now,
+	})
+	function.AddOutputError(gtype.ErrInternal)
+	function.AddOutputError(gtype.ErrNotSupport)
+	function.AddOutputError(gtype.ErrTokenInvalid)
+}
+
+func (s *Proxy) queryLinkHistory(ctx gtype.Context, filter *gproxy.LinkHistoryFilter) ([]*gproxy.Link, bool) {
+	if s.proxyHistory == nil {
+		ctx.Error(gtype.ErrNotSupport, "未启用连接历史记录")
+		return nil, false
+	}
+	if filter.StartTime != nil && filter.EndTime != nil {
+		if filter.EndTime.Before(*filter.StartTime) {
+			ctx.Error(gtype.ErrInput, "结束时间早于开始时间")
+			return nil, false
+		}
+	}
+
+	data, err := s.proxyHistory.Query(filter)
+	if err != nil {
+		ctx.Error(gtype.ErrInternal, err)
+		return nil, false
+	}
+
+	return data, true
+}
+
+func (s *Proxy) GetProxyTraffics(ctx gtype.Context, ps gtype.Params) {
+	ctx.Success(s.proxyServer.Traffics())
+}
+
+func (s *Proxy) GetProxyTrafficsDoc(doc gtype.Doc, method string, uri gtype.Uri) {
+	catalog := s.proxyCatalog(doc)
+	function := catalog.AddFunction(method, uri, "获取流量统计")
+	function.SetNote("获取自服务启动以来各服务器及目标的连接数、字节数及拒绝连接数，字节数包括当前连接已传输的部分")
+	function.SetOutputDataExample(&gproxy.TrafficSummary{
+		Servers: []*gproxy.Traffic{
+			{
+				Id:          gtype.NewGuid(),
+				Connections: 128,
+				Actives:     3,
+				BytesIn:     32 * 1024 * 1024,
+				BytesOut:    1024 * 1024 * 1024,
+				Rejects:     5,
+			},
+		},
+		Targets: []*gproxy.Traffic{
+			{
+				Id:          gtype.NewGuid(),
+				Connections: 96,
+				Actives:     2,
+				BytesIn:     24 * 1024 * 1024,
+				BytesOut:    768 * 1024 * 1024,
+				Rejects:     2,
+			},
 		},
 	})
 	function.AddOutputError(gtype.ErrInternal)
@@ -806,6 +1065,16 @@ func (s *Proxy) saveConfig() error {
 	return s.cfg.Save(cfg)
 }
 
+// applyRoutes 重新生成路由，服务运行时立即生效(不中断已有连接)
+func (s *Proxy) applyRoutes() {
+	s.initRoutes()
+
+	err := s.proxyServer.Apply(s.proxyServer.Routes)
+	if err != nil {
+		s.LogError("apply proxy routes error:", err)
+	}
+}
+
 func (s *Proxy) initRoutes() {
 	s.proxyServer.Routes = make([]gproxy.Route, 0)
 	s.proxyTargets.items = make(map[string]ProxyTargetItem)
@@ -835,19 +1104,56 @@ func (s *Proxy) initRoutes() {
 			}
 
 			s.proxyServer.Routes = append(s.proxyServer.Routes, gproxy.Route{
-				SourceId:     server.Id,
-				TargetId:     target.Id,
-				IsTls:        server.TLS,
-				Address:      fmt.Sprintf("%s:%s", server.IP, server.Port),
-				Domain:       target.Domain,
-				Path:         target.Path,
-				Target:       fmt.Sprintf("%s:%s", target.IP, target.Port),
-				Version:      target.Version,
-				SpareTargets: target.SpareTargets(),
+				SourceId:        server.Id,
+				TargetId:        target.Id,
+				IsTls:           server.TLS,
+				Address:         fmt.Sprintf("%s:%s", server.IP, server.Port),
+				Protocol:        server.Protocol,
+				IdleTimeout:     time.Duration(server.IdleTimeout) * time.Second,
+				Domain:          target.Domain,
+				Path:            target.Path,
+				Sources:         target.Sources,
+				Alpn:            target.Alpn,
+				Target:          fmt.Sprintf("%s:%s", target.IP, target.Port),
+				Version:         target.Version,
+				SpareTargets:    target.SpareTargets(),
+				ResolveInterval: time.Duration(target.ResolveInterval) * time.Second,
+				Balance:         gproxy.Balance(target.Balance),
+				Weight:          target.Weight,
+				SpareWeights:    target.SpareWeights(),
+				Check: gproxy.HealthCheck{
+					Type:     gproxy.CheckType(target.Check.Type),
+					Interval: time.Duration(target.Check.Interval) * time.Second,
+					Timeout:  time.Duration(target.Check.Timeout) * time.Millisecond,
+					Rise:     target.Check.Rise,
+					Fall:     target.Check.Fall,
+					Path:     target.Check.Path,
+					Host:     target.Check.Host,
+					Https:    target.Check.Https,
+					Status:   target.Check.Status,
+					Body:     target.Check.Body,
+					Failures: target.Check.Failures,
+					Cooldown: time.Duration(target.Check.Cooldown) * time.Second,
+				},
+				Terminate:          server.Terminate,
+				Certificates:       proxyCertificates(server.Certificates),
+				Encrypt:            target.Encrypt,
+				SkipVerify:         target.SkipVerify,
+				PathRewrite:        target.PathRewrite,
+				RequestHeader:      proxyHeader(&target.RequestHeader),
+				ResponseHeader:     proxyHeader(&target.ResponseHeader),
+				Access:             proxyAccess(&server.Access),
+				TargetAccess:       proxyAccess(&target.Access),
+				Bandwidth:          proxyBandwidth(&server.Bandwidth),
+				TargetBandwidth:    proxyBandwidth(&target.Bandwidth),
+				AcceptProxy:        server.ProxyProtocol,
+				TrustedProxies:     server.TrustedProxies,
+				AcceptProxyTimeout: time.Duration(server.ProxyProtocolTimeout) * time.Second,
 			})
 
 			target.SetSourceId(server.Id)
 			s.proxyTargets.AddItem(target.AddrId, target)
+			s.proxyServer.Drain(target.AddrId, target.Draining)
 			spareCount := len(target.Spares)
 			for spareIndex := 0; spareIndex < spareCount; spareIndex++ {
 				spare := target.Spares[spareIndex]
@@ -857,11 +1163,219 @@ func (s *Proxy) initRoutes() {
 				spare.SetSourceId(server.Id)
 				spare.SetTargetId(target.Id)
 				s.proxyTargets.AddItem(spare.AddrId, spare)
+				s.proxyServer.Drain(spare.AddrId, spare.Draining)
 			}
 		}
 	}
 }
 
+func proxyHeader(v *gcfg.ProxyHeader) gproxy.HeaderRewrite {
+	return gproxy.HeaderRewrite{
+		Set:    v.Set,
+		Remove: v.Remove,
+	}
+}
+
+func proxyAccess(v *gcfg.ProxyAccess) gproxy.AccessPolicy {
+	return gproxy.AccessPolicy{
+		Allow:    v.Allow,
+		Deny:     v.Deny,
+		MaxConns: v.MaxConns,
+		Rate:     v.Rate,
+	}
+}
+
+// validateProxyServer 检查添加或修改的服务器参数
+func validateProxyServer(argument *gcfg.ProxyServerEdit) error {
+	if len(argument.Name) < 1 {
+		return fmt.Errorf("名称为空")
+	}
+	if len(argument.IP) > 0 {
+		addr := net.ParseIP(argument.IP)
+		if addr == nil {
+			return fmt.Errorf("IP地址(%s)无效", argument.IP)
+		}
+	}
+	if len(argument.Port) < 1 {
+		return fmt.Errorf("监听端口为空")
+	}
+	port, err := strconv.ParseUint(argument.Port, 10, 16)
+	if err != nil || port < 1 {
+		return fmt.Errorf("监听端口(%s)无效", argument.Port)
+	}
+	for i := 0; i < len(argument.TrustedProxies); i++ {
+		v := argument.TrustedProxies[i]
+		if len(gproxy.ParseCIDRs([]string{v})) < 1 {
+			return fmt.Errorf("可信代理地址(%s)无效", v)
+		}
+	}
+	if len(argument.Protocol) > 0 {
+		if argument.Protocol != gcfg.ProxyProtocolTcp && argument.Protocol != gcfg.ProxyProtocolUdp &&
+			argument.Protocol != gcfg.ProxyProtocolHttp {
+			return fmt.Errorf("协议(%s)无效", argument.Protocol)
+		}
+	}
+	if argument.Protocol == gcfg.ProxyProtocolUdp {
+		if argument.TLS {
+			return fmt.Errorf("udp不支持TLS")
+		}
+		if argument.ProxyProtocol {
+			return fmt.Errorf("udp不支持PROXY协议头部")
+		}
+	}
+	if argument.IdleTimeout < 0 {
+		return fmt.Errorf("空闲超时时间(%d)无效", argument.IdleTimeout)
+	}
+	if err = checkProxyAccess(&argument.Access); err != nil {
+		return err
+	}
+	if err = checkProxyBandwidth(&argument.Bandwidth); err != nil {
+		return err
+	}
+	if argument.Protocol == gcfg.ProxyProtocolHttp && argument.TLS && !argument.Terminate {
+		return fmt.Errorf("http且tls时须启用TLS终止")
+	}
+	if argument.Terminate {
+		if !argument.TLS {
+			return fmt.Errorf("TLS终止仅tls有效")
+		}
+		if len(argument.Certificates) < 1 {
+			return fmt.Errorf("TLS终止证书为空")
+		}
+		for i := 0; i < len(argument.Certificates); i++ {
+			if len(argument.Certificates[i].File) < 1 {
+				return fmt.Errorf("TLS终止证书文件路径为空")
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateProxyTarget 检查添加或修改的目标参数
+func validateProxyTarget(target *gcfg.ProxyTarget) error {
+	if len(target.IP) < 1 {
+		return fmt.Errorf("目标地址为空")
+	}
+	if err := checkProxyTargetPort(target.IP, target.Port); err != nil {
+		return err
+	}
+	c := len(target.Spares)
+	if c > 0 {
+		for i := 0; i < c; i++ {
+			spare := target.Spares[i]
+			if spare == nil {
+				return fmt.Errorf("备用目标项目为空")
+			}
+			if len(spare.IP) < 1 {
+				return fmt.Errorf("备用目标地址为空")
+			}
+			if len(spare.Port) < 1 && !gproxy.IsSrvAddress(spare.IP) {
+				return fmt.Errorf("备用目标端口为空")
+			}
+		}
+	}
+	if target.Version < 0 || target.Version > 2 {
+		return fmt.Errorf("版本号(%d)无效", target.Version)
+	}
+	if !gproxy.Balance(target.Balance).IsValid() {
+		return fmt.Errorf("负载均衡策略(%d)无效", target.Balance)
+	}
+	if !gproxy.CheckType(target.Check.Type).IsValid() {
+		return fmt.Errorf("健康检测类型(%d)无效", target.Check.Type)
+	}
+	if target.Check.Failures < 0 || target.Check.Cooldown < 0 {
+		return fmt.Errorf("熔断参数无效")
+	}
+	if err := checkProxyAccess(&target.Access); err != nil {
+		return err
+	}
+	if err := checkProxyBandwidth(&target.Bandwidth); err != nil {
+		return err
+	}
+	if len(target.PathRewrite) > 0 && target.PathRewrite[0] != '/' {
+		return fmt.Errorf("路径前缀替换(%s)无效，须以'/'开头", target.PathRewrite)
+	}
+	if target.ResolveInterval < 0 {
+		return fmt.Errorf("域名解析间隔(%d)无效", target.ResolveInterval)
+	}
+	if err := gproxy.CheckRouteMatch(target.Domain, target.Sources); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func checkProxyAccess(v *gcfg.ProxyAccess) error {
+	for i := 0; i < len(v.Allow); i++ {
+		if len(gproxy.ParseCIDRs([]string{v.Allow[i]})) < 1 {
+			return fmt.Errorf("允许的来源地址(%s)无效", v.Allow[i])
+		}
+	}
+	for i := 0; i < len(v.Deny); i++ {
+		if len(gproxy.ParseCIDRs([]string{v.Deny[i]})) < 1 {
+			return fmt.Errorf("拒绝的来源地址(%s)无效", v.Deny[i])
+		}
+	}
+	if v.MaxConns < 0 {
+		return fmt.Errorf("最大并发连接数(%d)无效", v.MaxConns)
+	}
+	if v.Rate < 0 {
+		return fmt.Errorf("每秒最大新建连接数(%d)无效", v.Rate)
+	}
+
+	return nil
+}
+
+func proxyBandwidth(v *gcfg.ProxyBandwidth) gproxy.BandwidthPolicy {
+	return gproxy.BandwidthPolicy{
+		Upload:         v.Upload,
+		Download:       v.Download,
+		ClientUpload:   v.ClientUpload,
+		ClientDownload: v.ClientDownload,
+	}
+}
+
+func checkProxyBandwidth(v *gcfg.ProxyBandwidth) error {
+	if v.Upload < 0 || v.Download < 0 || v.ClientUpload < 0 || v.ClientDownload < 0 {
+		return fmt.Errorf("带宽限制(上传: %d, 下载: %d, 来源IP上传: %d, 来源IP下载: %d)无效",
+			v.Upload, v.Download, v.ClientUpload, v.ClientDownload)
+	}
+
+	return nil
+}
+
+// checkProxyTargetPort SRV记录目标按记录中的端口转发，端口可以为空
+func checkProxyTargetPort(ip, port string) error {
+	if gproxy.IsSrvAddress(ip) {
+		if len(ip) <= len(gproxy.SrvPrefix) {
+			return fmt.Errorf("SRV记录目标地址(%s)无效", ip)
+		}
+		return nil
+	}
+	if len(port) < 1 {
+		return fmt.Errorf("目标端口为空")
+	}
+	v, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || v < 1 {
+		return fmt.Errorf("目标端口(%s)无效", port)
+	}
+
+	return nil
+}
+
+func proxyCertificates(items []gcfg.CrtPfx) []gproxy.Certificate {
+	certificates := make([]gproxy.Certificate, 0)
+	for i := 0; i < len(items); i++ {
+		certificates = append(certificates, gproxy.Certificate{
+			File:     items[i].File,
+			Password: items[i].Password,
+		})
+	}
+
+	return certificates
+}
+
 func (s *Proxy) onProxyServerStatusChanged(status gproxy.Status) {
 	if status != gproxy.StatusRunning {
 		s.proxyTargets.Stop()
@@ -876,6 +1390,12 @@ func (s *Proxy) onProxyConnected(link gproxy.Link) {
 
 func (s *Proxy) onProxyDisconnected(link gproxy.Link) {
 	s.proxyLinks.Del(link.Id)
+	if s.proxyHistory != nil {
+		err := s.proxyHistory.Add(&link)
+		if err != nil {
+			s.LogError("save proxy link history fail:", err)
+		}
+	}
 	s.writeOptMessage(gtype.WSReviseProxyConnectionShut, link)
 }
 
@@ -884,18 +1404,20 @@ func (s *Proxy) onTargetAliveChanged(addr *gproxy.TargetAddressItem) {
 		return
 	}
 
-	item := s.proxyTargets.GetItem(addr.AddrId)
+	item := s.proxyTargets.GetItem(addr.HostId)
 	if item == nil {
 		return
 	}
 
-	item.SetAlive(addr.IstAlive())
+	item.SetAlive(s.proxyServer.HostAlive(addr.HostId))
 	s.writeOptMessage(gtype.WSReviseProxyTargetStatusChanged, &ProxyTargetEntry{
 		SourceId: item.SourceId(),
 		TargetId: item.TargetId(),
-		AddrId:   addr.AddrId,
+		AddrId:   addr.HostId,
 		Alive:    item.IsAlive(),
 		Count:    item.Count(),
+		Error:    addr.CheckError(),
+		Draining: addr.IsDraining(),
 	})
 }
 
@@ -904,7 +1426,7 @@ func (s *Proxy) onTargetConnCountChanged(addr *gproxy.TargetAddressItem, increas
 		return
 	}
 
-	item := s.proxyTargets.GetItem(addr.AddrId)
+	item := s.proxyTargets.GetItem(addr.HostId)
 	if item == nil {
 		return
 	}
@@ -916,8 +1438,9 @@ func (s *Proxy) onTargetConnCountChanged(addr *gproxy.TargetAddressItem, increas
 	s.writeOptMessage(gtype.WSReviseProxyTargetStatusChanged, &ProxyTargetEntry{
 		SourceId: item.SourceId(),
 		TargetId: item.TargetId(),
-		AddrId:   addr.AddrId,
+		AddrId:   addr.HostId,
 		Alive:    item.IsAlive(),
 		Count:    item.Count(),
+		Draining: addr.IsDraining(),
 	})
 }
@@ -6,6 +6,8 @@ type ProxyTargetItem interface {
 	IsAlive() bool
 	Count() int64
 	SetAlive(v bool)
+	IsDraining() bool
+	SetDraining(v bool)
 	IncreaseCount() int64
 	DecreaseCount() int64
 }
@@ -71,4 +73,6 @@ type ProxyTargetEntry struct {
 	AddrId   string `json:"addrId" note:"地址ID "`
 	Alive    bool   `json:"alive" note:"是否在线"`
 	Count    int64  `json:"count" note:"连接数量"`
+	Error    string `json:"error" note:"健康检测错误信息"`
+	Draining bool   `json:"draining" note:"是否排空"`
 }
@@ -159,9 +159,16 @@ func (s *Websocket) NotifyDoc(doc gtype.Doc, method string, uri gtype.Uri) {
 }
 
 func (s *Websocket) checkOrigin(r *http.Request) bool {
-	if r != nil {
+	var cors *gcfg.Cors
+	if s.cfg != nil {
+		cors = &s.cfg.Cors
 	}
-	return true
+	if cors.CheckOrigin(r) {
+		return true
+	}
+
+	s.LogWarning("websocket origin is not allowed: origin=", r.Header.Get("Origin"), ", host=", r.Host, ", path=", r.URL.Path)
+	return false
 }
 
 func (s *Websocket) onChannelRemoved(channel gtype.SocketChannel) {
@@ -1,7 +1,9 @@
 package gopt
 
 import (
+	"context"
 	"github.com/csby/gwsf/gcfg"
+	"github.com/csby/gwsf/glimit"
 	"github.com/csby/gwsf/gopt/controller"
 	"github.com/csby/gwsf/gtype"
 	"net/http"
@@ -112,6 +114,25 @@ func (s *innerHandler) SocketChannels() gtype.SocketChannelCollection {
 	return s.wsc
 }
 
+// Shutdown 停止反向代理(等待已有连接结束, 最长为排空超时时间), 实现gtype.ShutdownHandler, 用于服务关闭
+func (s *innerHandler) Shutdown(ctx context.Context) {
+	if s.proxy == nil {
+		return
+	}
+
+	done := make(chan bool, 1)
+	go func() {
+		s.proxy.Shutdown()
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.LogWarning("reverse proxy shutdown timeout: ", ctx.Err())
+	}
+}
+
 func (s *innerHandler) ApiPath() *gtype.Path {
 	return s.apiPath
 }
@@ -137,12 +158,15 @@ func (s *innerHandler) mapApi(router gtype.Router, path *gtype.Path) gtype.HttpH
 	if s.preHandle != nil {
 		tokenChecker = s.preHandle
 	}
+	captchaUri := path.Uri("/captcha").SetTokenUI(nil).SetTokenCreate(nil)
+	loginUri := path.Uri("/login").SetTokenUI(nil).SetTokenCreate(nil)
+	loginLimits := s.loginLimits(captchaUri, loginUri)
 	// 获取验证码
-	router.POST(path.Uri("/captcha").SetTokenUI(nil).SetTokenCreate(nil), nil,
-		s.auth.GetCaptcha, s.auth.GetCaptchaDoc)
+	router.POST(captchaUri, nil,
+		s.auth.GetCaptcha, s.auth.GetCaptchaDoc, loginLimits...)
 	// 用户登陆
-	router.POST(path.Uri("/login").SetTokenUI(nil).SetTokenCreate(nil), nil,
-		s.auth.Login, s.auth.LoginDoc)
+	router.POST(loginUri, nil,
+		s.auth.Login, s.auth.LoginDoc, loginLimits...)
 	// 注销登陆
 	router.POST(path.Uri("/logout"), tokenChecker,
 		s.auth.Logout, s.auth.LogoutDoc)
@@ -263,6 +287,12 @@ func (s *innerHandler) mapApi(router gtype.Router, path *gtype.Path) gtype.HttpH
 	// 反向代理-连接
 	router.POST(path.Uri("/proxy/conn/list"), tokenChecker,
 		s.proxy.GetProxyLinks, s.proxy.GetProxyLinksDoc)
+	router.POST(path.Uri("/proxy/conn/history/list"), tokenChecker,
+		s.proxy.GetProxyLinkHistory, s.proxy.GetProxyLinkHistoryDoc)
+	router.POST(path.Uri("/proxy/conn/history/export"), tokenChecker,
+		s.proxy.ExportProxyLinkHistory, s.proxy.ExportProxyLinkHistoryDoc)
+	router.POST(path.Uri("/proxy/traffic/list"), tokenChecker,
+		s.proxy.GetProxyTraffics, s.proxy.GetProxyTrafficsDoc)
 
 	// 反向代理-端口
 	router.POST(path.Uri("/proxy/server/list"), tokenChecker,
@@ -283,6 +313,8 @@ func (s *innerHandler) mapApi(router gtype.Router, path *gtype.Path) gtype.HttpH
 		s.proxy.DelProxyTarget, s.proxy.DelProxyTargetDoc)
 	router.POST(path.Uri("/proxy/target/mod"), tokenChecker,
 		s.proxy.ModifyProxyTarget, s.proxy.ModifyProxyTargetDoc)
+	router.POST(path.Uri("/proxy/target/drain"), tokenChecker,
+		s.proxy.DrainProxyTarget, s.proxy.DrainProxyTargetDoc)
 
 	// 系统服务-tomcat
 	router.POST(path.Uri("/svc/tomcat/svc/list"), tokenChecker,
@@ -441,3 +473,35 @@ func (s *innerHandler) mapApi(router gtype.Router, path *gtype.Path) gtype.HttpH
 func (s *innerHandler) mapSite(router gtype.Router, root string) {
 	router.ServeFiles(s.webPath.Uri("/*filepath"), nil, http.Dir(root), nil)
 }
+
+// loginLimits 登录及验证码接口限流(按客户端IP)，防止暴力破解
+func (s *innerHandler) loginLimits(uris ...gtype.Uri) []gtype.Middleware {
+	rate := 0.2
+	burst := 10
+	cfg := &gcfg.RateLimit{
+		Rules: make([]*gcfg.RateLimitRule, 0, len(uris)),
+	}
+	if s.cfg != nil {
+		limit := s.cfg.Site.Opt.Api.Limit
+		if limit.Rate < 0 {
+			return nil
+		} else if limit.Rate > 0 {
+			rate = limit.Rate
+			burst = limit.Burst
+		}
+		cfg.Cluster = s.cfg.RateLimit.Cluster
+	}
+
+	for _, uri := range uris {
+		cfg.Rules = append(cfg.Rules, &gcfg.RateLimitRule{
+			Path:  uri.Path(),
+			Key:   gcfg.RateLimitKeyIp,
+			Rate:  rate,
+			Burst: burst,
+		})
+	}
+
+	return []gtype.Middleware{
+		glimit.NewLimiter(s.GetLog(), "opt.login", cfg).Middleware(),
+	}
+}
@@ -0,0 +1,154 @@
+package gproxy
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// AccessPolicy 访问控制
+type AccessPolicy struct {
+	// 允许的来源地址(IP或CIDR)，为空时表示全部允许
+	Allow []string
+	// 拒绝的来源地址(IP或CIDR)，优先于允许列表
+	Deny []string
+	// 每个来源IP的最大并发连接数，小于等于0时不限制
+	MaxConns int
+	// 每个来源IP每秒的最大新建连接数，小于等于0时不限制
+	Rate int
+}
+
+func (s *AccessPolicy) IsEmpty() bool {
+	return len(s.Allow) < 1 && len(s.Deny) < 1 && s.MaxConns <= 0 && s.Rate <= 0
+}
+
+func (s *AccessPolicy) String() string {
+	if s.IsEmpty() {
+		return "none"
+	}
+
+	return fmt.Sprintf("allow=%v, deny=%v, conns=%d, rate=%d", s.Allow, s.Deny, s.MaxConns, s.Rate)
+}
+
+// accessControl 按访问控制策略检查来源地址，并统计每个来源IP的连接
+type accessControl struct {
+	sync.Mutex
+
+	allow    []*net.IPNet
+	deny     []*net.IPNet
+	maxConns int
+	rate     int
+
+	sources   map[string]*accessSource
+	sweepTime time.Time
+}
+
+type accessSource struct {
+	conns  int
+	second int64
+	count  int
+}
+
+// newAccessControl 策略为空时返回nil，nil不做任何限制
+func newAccessControl(policy AccessPolicy) *accessControl {
+	if policy.IsEmpty() {
+		return nil
+	}
+
+	return &accessControl{
+		allow:    ParseCIDRs(policy.Allow),
+		deny:     ParseCIDRs(policy.Deny),
+		maxConns: policy.MaxConns,
+		rate:     policy.Rate,
+		sources:  make(map[string]*accessSource),
+	}
+}
+
+// acquire 检查来源地址是否允许连接，允许时返回的release须在连接结束时调用；
+// 不允许时返回拒绝原因
+func (s *accessControl) acquire(addr net.Addr) (release func(), reason string) {
+	if s == nil {
+		return func() {}, ""
+	}
+
+	if len(s.deny) > 0 && ContainsIP(s.deny, addr) {
+		return nil, "denied"
+	}
+	if len(s.allow) > 0 && !ContainsIP(s.allow, addr) {
+		return nil, "not allowed"
+	}
+	if s.maxConns <= 0 && s.rate <= 0 {
+		return func() {}, ""
+	}
+
+	ip := addrIP(addr)
+	now := time.Now()
+	s.Lock()
+	defer s.Unlock()
+
+	s.sweep(now)
+	source, ok := s.sources[ip]
+	if !ok {
+		source = &accessSource{}
+		s.sources[ip] = source
+	}
+	if s.maxConns > 0 && source.conns >= s.maxConns {
+		return nil, fmt.Sprintf("too many connections (%d)", source.conns)
+	}
+	if s.rate > 0 {
+		second := now.Unix()
+		if source.second != second {
+			source.second = second
+			source.count = 0
+		}
+		if source.count >= s.rate {
+			return nil, fmt.Sprintf("rate limit exceeded (%d/s)", s.rate)
+		}
+		source.count++
+	}
+	source.conns++
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			s.Lock()
+			defer s.Unlock()
+			source.conns--
+		})
+	}, ""
+}
+
+// sweep 每分钟清理没有连接的来源IP
+func (s *accessControl) sweep(now time.Time) {
+	if now.Sub(s.sweepTime) < time.Minute {
+		return
+	}
+	s.sweepTime = now
+
+	second := now.Unix()
+	for ip, source := range s.sources {
+		if source.conns <= 0 && source.second != second {
+			delete(s.sources, ip)
+		}
+	}
+}
+
+func addrIP(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP.String()
+	case *net.UDPAddr:
+		return a.IP.String()
+	}
+	if addr == nil {
+		return ""
+	}
+
+	ip, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return ip
+}
@@ -0,0 +1,55 @@
+package gproxy
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAccessControl(t *testing.T) {
+	access := newAccessControl(AccessPolicy{
+		Allow:    []string{"10.0.0.0/8"},
+		Deny:     []string{"10.0.0.9"},
+		MaxConns: 2,
+	})
+	addr := func(ip string) net.Addr {
+		return &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}
+	}
+
+	if _, reason := access.acquire(addr("192.168.1.1")); reason != "not allowed" {
+		t.Fatal("allow:", reason)
+	}
+	if _, reason := access.acquire(addr("10.0.0.9")); reason != "denied" {
+		t.Fatal("deny:", reason)
+	}
+
+	release1, reason := access.acquire(addr("10.0.0.1"))
+	if len(reason) > 0 {
+		t.Fatal("first:", reason)
+	}
+	_, reason = access.acquire(addr("10.0.0.1"))
+	if len(reason) > 0 {
+		t.Fatal("second:", reason)
+	}
+	if _, reason = access.acquire(addr("10.0.0.1")); len(reason) < 1 {
+		t.Fatal("max conns: should be rejected")
+	}
+	if _, reason = access.acquire(addr("10.0.0.2")); len(reason) > 0 {
+		t.Fatal("other source:", reason)
+	}
+	release1()
+	release1()
+	if _, reason = access.acquire(addr("10.0.0.1")); len(reason) > 0 {
+		t.Fatal("after release:", reason)
+	}
+
+	rate := newAccessControl(AccessPolicy{Rate: 2})
+	rate.acquire(addr("10.0.0.1"))
+	rate.acquire(addr("10.0.0.1"))
+	if _, reason = rate.acquire(addr("10.0.0.1")); len(reason) < 1 {
+		t.Fatal("rate: should be rejected")
+	}
+
+	if newAccessControl(AccessPolicy{}) != nil {
+		t.Fatal("empty policy")
+	}
+}
@@ -1,9 +1,14 @@
 package gproxy
 
 import (
+	"context"
 	"fmt"
 	"github.com/csby/gwsf/gtype"
+	"log"
+	"net"
+	"reflect"
 	"sync"
+	"time"
 )
 
 type TargetAddress struct {
@@ -12,14 +17,36 @@ type TargetAddress struct {
 	SourceId string
 	TargetId string
 
+	// 负载均衡策略
+	Balance Balance
+	// 健康检测
+	Check HealthCheck
+	// 被动检测：不进行主动健康检测，地址初始为在线，
+	// 转发出错时标记为离线，经过检测间隔后恢复为在线(如UDP)
+	Passive bool
+	// 域名重新解析的最大间隔，DNS记录的TTL较小时按TTL，小于等于0时为30秒
+	ResolveInterval time.Duration
+
 	AliveChanged func(item *TargetAddressItem)
 	CountChanged func(item *TargetAddressItem, increase bool)
 
-	items []*TargetAddressItem
+	hosts    []*targetHost
+	items    []*TargetAddressItem
+	balancer balancer
+
+	checking  bool
+	checkTime time.Time
+	resolving bool
 }
 
 func (s *TargetAddress) GetAddress() *TargetAddressItem {
-	items := s.items
+	return s.SelectAddress("")
+}
+
+// SelectAddress 按负载均衡策略选择目标地址
+// source: 传入连接的源IP地址，用于源地址哈希
+func (s *TargetAddress) SelectAddress(source string) *TargetAddressItem {
+	items := s.Items()
 	c := len(items)
 	if c < 1 {
 		return nil
@@ -30,9 +57,8 @@ func (s *TargetAddress) GetAddress() *TargetAddressItem {
 		return addr
 	}
 
-	s.Lock()
-	defer s.Unlock()
-	for i := 1; i < c; i++ {
+	alives := make([]*TargetAddressItem, 0, c)
+	for i := 0; i < c; i++ {
 		item := items[i]
 		if item == nil {
 			continue
@@ -40,35 +66,73 @@ func (s *TargetAddress) GetAddress() *TargetAddressItem {
 		if item.IstAlive() == false {
 			continue
 		}
+		if item.IsDraining() {
+			continue
+		}
+		alives = append(alives, item)
+	}
+	if len(alives) < 1 {
+		// 没有可用地址时优先选择未排空的地址
+		for i := 0; i < c; i++ {
+			item := items[i]
+			if item != nil && !item.IsDraining() {
+				return item
+			}
+		}
+		return addr
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if s.balancer == nil {
+		s.balancer = newBalancer(s.Balance)
+	}
 
-		if addr.IstAlive() == false {
-			addr = item
-		} else if addr.Count() > item.Count() {
-			addr = item
+	return s.balancer.selectItem(alives, source)
+}
+
+// nextAddress 选择未尝试过的可用地址，用于连接失败时的故障转移，没有时返回nil
+func (s *TargetAddress) nextAddress(tried map[*TargetAddressItem]bool, source string) *TargetAddressItem {
+	items := s.Items()
+	c := len(items)
+	candidates := make([]*TargetAddressItem, 0, c)
+	for i := 0; i < c; i++ {
+		item := items[i]
+		if item == nil || tried[item] {
+			continue
 		}
+		if item.IstAlive() == false || item.IsDraining() {
+			continue
+		}
+		candidates = append(candidates, item)
+	}
+	if len(candidates) < 1 {
+		return nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if s.balancer == nil {
+		s.balancer = newBalancer(s.Balance)
 	}
 
-	return addr
+	return s.balancer.selectItem(candidates, source)
 }
 
+// SetAddress 设置目标地址，可以是"IP:端口"、"域名:端口"或SRV记录(SrvPrefix)
 func (s *TargetAddress) SetAddress(v string) {
-	s.items = make([]*TargetAddressItem, 0)
-	s.items = append(s.items, &TargetAddressItem{
-		SourceId:     s.SourceId,
-		TargetId:     s.TargetId,
-		AddrId:       gtype.ToMd5(fmt.Sprintf("%s-%s-%s", s.SourceId, s.TargetId, v)),
-		Addr:         v,
-		alive:        false,
-		count:        0,
-		aliveChanged: s.AliveChanged,
-		countChanged: s.CountChanged,
-	})
+	s.Lock()
+	defer s.Unlock()
+
+	s.hosts = []*targetHost{newTargetHost(s.SourceId, s.TargetId, v)}
+	s.items = nil
+	s.buildItems()
 }
 
+// AddAddress 添加备用目标地址
 func (s *TargetAddress) AddAddress(vs []string) {
-	if s.items == nil {
-		s.items = make([]*TargetAddressItem, 0)
-	}
+	s.Lock()
+	defer s.Unlock()
 
 	c := len(vs)
 	for i := 0; i < c; i++ {
@@ -76,24 +140,354 @@ func (s *TargetAddress) AddAddress(vs []string) {
 		if len(v) < 1 {
 			continue
 		}
+		s.hosts = append(s.hosts, newTargetHost(s.SourceId, s.TargetId, v))
+	}
+	s.buildItems()
+}
+
+// SetWeights 按地址顺序(目标地址、备用地址)设置权重，域名解析的地址使用其权重
+func (s *TargetAddress) SetWeights(vs []int) {
+	s.Lock()
+	defer s.Unlock()
+
+	c := len(vs)
+	if c > len(s.hosts) {
+		c = len(s.hosts)
+	}
+	for i := 0; i < c; i++ {
+		s.hosts[i].weight = vs[i]
+	}
+	for _, item := range s.items {
+		for _, h := range s.hosts {
+			if item.HostId == h.id {
+				item.Weight = h.weight
+			}
+		}
+	}
+}
+
+// SetDraining 设置配置地址(地址标识)的排空状态，包括其解析的所有地址
+func (s *TargetAddress) SetDraining(hostId string, draining bool) {
+	s.Lock()
+	for _, h := range s.hosts {
+		if h.id == hostId {
+			h.draining = draining
+		}
+	}
+	items := s.items
+	s.Unlock()
+
+	for _, item := range items {
+		if item.HostId == hostId {
+			item.SetDraining(draining)
+		}
+	}
+}
 
-		s.items = append(s.items, &TargetAddressItem{
-			SourceId:     s.SourceId,
-			TargetId:     s.TargetId,
-			AddrId:       gtype.ToMd5(fmt.Sprintf("%s-%s-%s", s.SourceId, s.TargetId, v)),
-			Addr:         v,
-			alive:        false,
-			count:        0,
-			aliveChanged: s.AliveChanged,
-			countChanged: s.CountChanged,
-		})
+// setDrains 按配置地址(地址标识)设置排空状态
+func (s *TargetAddress) setDrains(drains map[string]bool) {
+	s.Lock()
+	for _, h := range s.hosts {
+		h.draining = drains[h.id]
+	}
+	items := s.items
+	s.Unlock()
+
+	for _, item := range items {
+		item.SetDraining(drains[item.HostId])
+	}
+}
+
+// HostAlive 配置地址(地址标识)解析的地址中是否有在线的地址
+func (s *TargetAddress) HostAlive(hostId string) (alive bool, ok bool) {
+	for _, item := range s.Items() {
+		if item.HostId != hostId {
+			continue
+		}
+		ok = true
+		if item.IstAlive() {
+			return true, true
+		}
 	}
+
+	return false, ok
 }
 
 func (s *TargetAddress) Items() []*TargetAddressItem {
+	s.RLock()
+	defer s.RUnlock()
+
 	return s.items
 }
 
+// buildItems 按配置地址(或其解析的地址)生成地址项，沿用相同地址标识的已有地址项，
+// 返回新建的地址项；调用时须已加锁
+func (s *TargetAddress) buildItems() []*TargetAddressItem {
+	existing := make(map[string]*TargetAddressItem)
+	for _, item := range s.items {
+		existing[item.AddrId] = item
+	}
+
+	added := make([]*TargetAddressItem, 0)
+	items := make([]*TargetAddressItem, 0, len(s.hosts))
+	add := func(h *targetHost, addrId, addr string, weight int) {
+		item, ok := existing[addrId]
+		if !ok {
+			item = &TargetAddressItem{
+				SourceId:     s.SourceId,
+				TargetId:     s.TargetId,
+				AddrId:       addrId,
+				HostId:       h.id,
+				Host:         h.addr,
+				Addr:         addr,
+				Weight:       weight,
+				alive:        false,
+				count:        0,
+				draining:     h.draining,
+				aliveChanged: s.AliveChanged,
+				countChanged: s.CountChanged,
+			}
+			added = append(added, item)
+		}
+		items = append(items, item)
+	}
+	for _, h := range s.hosts {
+		if h.resolved == nil {
+			add(h, h.id, h.addr, h.weight)
+			continue
+		}
+		for _, v := range h.resolved {
+			weight := h.weight
+			if v.Weight > 0 {
+				weight = v.Weight
+			}
+			add(h, gtype.ToMd5(fmt.Sprintf("%s-%s", h.id, v.Addr)), v.Addr, weight)
+		}
+	}
+	s.items = items
+	if rr, ok := s.balancer.(*roundRobinBalancer); ok {
+		rr.prune(items)
+	}
+
+	return added
+}
+
+// inherit 沿用old中相同配置地址的解析结果，路由更新后无需等待重新解析
+func (s *TargetAddress) inherit(old *TargetAddress) {
+	if old == nil {
+		return
+	}
+
+	resolved := make(map[string]*targetHost)
+	old.RLock()
+	for _, h := range old.hosts {
+		if h.resolved != nil {
+			resolved[h.addr] = h
+		}
+	}
+	old.RUnlock()
+
+	s.Lock()
+	defer s.Unlock()
+	for _, h := range s.hosts {
+		if v, ok := resolved[h.addr]; ok {
+			h.resolved = v.resolved
+			h.expire = v.expire
+		}
+	}
+	s.buildItems()
+}
+
+// doResolve 重新解析已过期的域名及SRV记录，解析失败时保留原地址并稍后重试
+func (s *TargetAddress) doResolve(now time.Time) {
+	s.Lock()
+	if s.resolving {
+		s.Unlock()
+		return
+	}
+	hosts := make([]*targetHost, 0)
+	for _, h := range s.hosts {
+		if h.isName() && !now.Before(h.expire) {
+			hosts = append(hosts, h)
+		}
+	}
+	if len(hosts) < 1 {
+		s.Unlock()
+		return
+	}
+	s.resolving = true
+	s.Unlock()
+
+	go func() {
+		defer func() {
+			s.Lock()
+			s.resolving = false
+			s.Unlock()
+		}()
+
+		for _, h := range hosts {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			addrs, ttl, err := resolveHost(ctx, h.host, h.port, h.srv)
+			cancel()
+			if err == nil && len(addrs) < 1 {
+				err = fmt.Errorf("no address")
+			}
+
+			s.Lock()
+			if err != nil {
+				h.expire = time.Now().Add(resolveRetryInterval)
+				s.Unlock()
+				log.Printf("gproxy: resolve %q error: %v", h.addr, err)
+				continue
+			}
+			h.expire = time.Now().Add(s.resolveInterval(ttl))
+			if reflect.DeepEqual(h.resolved, addrs) {
+				s.Unlock()
+				continue
+			}
+			h.resolved = addrs
+			added := s.buildItems()
+			s.Unlock()
+
+			log.Printf("gproxy: resolve %q: %v", h.addr, addrs)
+			if s.Passive {
+				for _, item := range added {
+					item.SetAlive(true)
+				}
+			}
+		}
+	}()
+}
+
+func (s *TargetAddress) resolveInterval(ttl time.Duration) time.Duration {
+	interval := s.ResolveInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	if ttl > 0 && ttl < interval {
+		interval = ttl
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	return interval
+}
+
+// resolveRetryInterval 解析失败后重试的间隔
+const resolveRetryInterval = 5 * time.Second
+
+// targetHost 配置的目标地址，可以是IP地址、域名或SRV记录；
+// 域名及SRV记录解析后的每个地址为一个TargetAddressItem
+type targetHost struct {
+	id       string
+	addr     string
+	host     string
+	port     string
+	srv      bool
+	weight   int
+	draining bool
+
+	// 解析的地址，nil表示未解析(使用配置的地址)
+	resolved []resolvedAddress
+	expire   time.Time
+}
+
+func newTargetHost(sourceId, targetId, v string) *targetHost {
+	h := &targetHost{
+		id:   gtype.ToMd5(fmt.Sprintf("%s-%s-%s", sourceId, targetId, v)),
+		addr: v,
+	}
+	if IsSrvAddress(v) {
+		h.srv = true
+		h.host = v[len(SrvPrefix):]
+		if host, _, err := net.SplitHostPort(h.host); err == nil {
+			h.host = host
+		}
+		return h
+	}
+
+	host, port, err := net.SplitHostPort(v)
+	if err == nil && len(host) > 0 && net.ParseIP(host) == nil {
+		h.host = host
+		h.port = port
+	}
+
+	return h
+}
+
+// isName 是否为域名或SRV记录
+func (s *targetHost) isName() bool {
+	return len(s.host) > 0
+}
+
+// doCheck 到达检测间隔时检测所有地址，返回false表示未到检测时间或上次检测未结束
+func (s *TargetAddress) doCheck(now time.Time) bool {
+	s.Lock()
+	if s.checking {
+		s.Unlock()
+		return false
+	}
+	if now.Sub(s.checkTime) < s.Check.interval() {
+		s.Unlock()
+		return false
+	}
+	s.checking = true
+	s.checkTime = now
+	s.Unlock()
+
+	if s.Passive {
+		s.doRevive(now)
+		return true
+	}
+
+	go func() {
+		defer func() {
+			s.Lock()
+			s.checking = false
+			s.Unlock()
+		}()
+
+		items := s.Items()
+		c := len(items)
+		wg := &sync.WaitGroup{}
+		for i := 0; i < c; i++ {
+			item := items[i]
+			if item == nil {
+				continue
+			}
+
+			wg.Add(1)
+			go func(item *TargetAddressItem) {
+				defer wg.Done()
+				item.setCheckResult(s.Check.Check(item.Addr), &s.Check)
+			}(item)
+		}
+		wg.Wait()
+	}()
+
+	return true
+}
+
+// doRevive 被动检测时恢复离线超过冷却时间的地址
+func (s *TargetAddress) doRevive(now time.Time) {
+	defer func() {
+		s.Lock()
+		s.checking = false
+		s.Unlock()
+	}()
+
+	cooldown := s.Check.cooldown()
+	for _, item := range s.Items() {
+		if item == nil || item.IstAlive() {
+			continue
+		}
+		if now.Sub(item.failedTime()) >= cooldown {
+			item.SetAlive(true)
+		}
+	}
+}
+
 type TargetAddressItem struct {
 	sync.RWMutex
 
@@ -101,35 +495,156 @@ type TargetAddressItem struct {
 	TargetId string
 	AddrId   string
 	Addr     string
-
-	alive bool
-	count int64
+	// 配置地址的标识及地址，域名或SRV记录解析的地址为其所属的配置地址，否则与AddrId及Addr相同
+	HostId string
+	Host   string
+	// 权重，小于1时视为1
+	Weight int
+
+	alive    bool
+	count    int64
+	draining bool
+
+	rises     int
+	falls     int
+	err       string
+	failTime  time.Time
+	dialFails int
 
 	aliveChanged func(item *TargetAddressItem)
 	countChanged func(item *TargetAddressItem, increase bool)
 }
 
 func (s *TargetAddressItem) SetAlive(v bool) {
+	s.Lock()
 	if s.alive == v {
+		s.Unlock()
 		return
 	}
 	s.alive = v
-
 	if v {
 		s.setCount(0)
 	}
+	s.Unlock()
 
 	go s.fireAliveChanged()
 }
 
+// CheckError 最后一次健康检测的错误信息，空表示检测通过
+func (s *TargetAddressItem) CheckError() string {
+	return s.err
+}
+
+func (s *TargetAddressItem) setCheckResult(err error, check *HealthCheck) {
+	s.Lock()
+	if err != nil {
+		s.err = err.Error()
+		s.rises = 0
+		s.falls++
+	} else {
+		s.err = ""
+		s.falls = 0
+		if time.Now().Sub(s.failTime) < check.cooldown() {
+			// 熔断冷却中
+			s.Unlock()
+			return
+		}
+		s.rises++
+	}
+	rises, falls := s.rises, s.falls
+	s.Unlock()
+
+	if err != nil {
+		if falls >= check.fall() {
+			s.SetAlive(false)
+		}
+	} else {
+		if rises >= check.rise() {
+			s.SetAlive(true)
+		}
+	}
+}
+
+// dialFailed 连接失败，连续失败次数达到check.Failures时立即标记为离线(熔断)
+func (s *TargetAddressItem) dialFailed(err error, check *HealthCheck) {
+	s.Lock()
+	s.err = err.Error()
+	s.dialFails++
+	open := check.Failures > 0 && s.dialFails >= check.Failures
+	if open {
+		s.dialFails = 0
+		s.rises = 0
+		s.failTime = time.Now()
+	}
+	s.Unlock()
+
+	if open {
+		s.SetAlive(false)
+	}
+}
+
+func (s *TargetAddressItem) dialSucceeded() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.dialFails = 0
+}
+
+// SetDraining 设置排空状态，排空时不再分配新连接，已有连接继续直到结束
+func (s *TargetAddressItem) SetDraining(v bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.draining = v
+}
+
+func (s *TargetAddressItem) IsDraining() bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.draining
+}
+
+// markFailed 被动检测时转发出错，标记为离线
+func (s *TargetAddressItem) markFailed(err error) {
+	s.Lock()
+	s.err = err.Error()
+	s.rises = 0
+	s.failTime = time.Now()
+	s.Unlock()
+
+	s.SetAlive(false)
+}
+
+func (s *TargetAddressItem) failedTime() time.Time {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.failTime
+}
+
 func (s *TargetAddressItem) IstAlive() bool {
+	s.RLock()
+	defer s.RUnlock()
+
 	return s.alive
 }
 
 func (s *TargetAddressItem) Count() int64 {
+	s.RLock()
+	defer s.RUnlock()
+
 	return s.count
 }
 
+func (s *TargetAddressItem) weight() int {
+	if s.Weight < 1 {
+		return 1
+	}
+
+	return s.Weight
+}
+
 func (s *TargetAddressItem) IncreaseCount() {
 	s.Lock()
 	defer s.Unlock()
@@ -0,0 +1,166 @@
+package gproxy
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+)
+
+// Balance 负载均衡策略
+type Balance int
+
+const (
+	// 最少连接(按权重)
+	BalanceLeastConn Balance = 0
+	// 加权轮询
+	BalanceRoundRobin Balance = 1
+	// 随机(按权重)
+	BalanceRandom Balance = 2
+	// 源地址哈希(会话保持)
+	BalanceSourceHash Balance = 3
+)
+
+var balances = [...]string{
+	"least-conn",
+	"round-robin",
+	"random",
+	"source-hash",
+}
+
+func (s Balance) String() string {
+	if s >= BalanceLeastConn && s <= BalanceSourceHash {
+		return balances[s]
+	}
+
+	return ""
+}
+
+func (s Balance) IsValid() bool {
+	return s >= BalanceLeastConn && s <= BalanceSourceHash
+}
+
+type balancer interface {
+	// items: 可用的地址(非空且至少一个)
+	// source: 传入连接的源IP地址
+	selectItem(items []*TargetAddressItem, source string) *TargetAddressItem
+}
+
+func newBalancer(v Balance) balancer {
+	switch v {
+	case BalanceRoundRobin:
+		return &roundRobinBalancer{}
+	case BalanceRandom:
+		return &randomBalancer{}
+	case BalanceSourceHash:
+		return &sourceHashBalancer{}
+	default:
+		return &leastConnBalancer{}
+	}
+}
+
+type leastConnBalancer struct {
+}
+
+func (s *leastConnBalancer) selectItem(items []*TargetAddressItem, source string) *TargetAddressItem {
+	addr := items[0]
+	c := len(items)
+	for i := 1; i < c; i++ {
+		item := items[i]
+		// count/weight < addr.count/addr.weight
+		if item.Count()*int64(addr.weight()) < addr.Count()*int64(item.weight()) {
+			addr = item
+		}
+	}
+
+	return addr
+}
+
+// 平滑加权轮询
+type roundRobinBalancer struct {
+	currents map[string]int
+}
+
+func (s *roundRobinBalancer) selectItem(items []*TargetAddressItem, source string) *TargetAddressItem {
+	if s.currents == nil {
+		s.currents = make(map[string]int)
+	}
+
+	var addr *TargetAddressItem = nil
+	total := 0
+	c := len(items)
+	for i := 0; i < c; i++ {
+		item := items[i]
+		weight := item.weight()
+		total += weight
+		s.currents[item.AddrId] += weight
+
+		if addr == nil || s.currents[item.AddrId] > s.currents[addr.AddrId] {
+			addr = item
+		}
+	}
+	s.currents[addr.AddrId] -= total
+
+	return addr
+}
+
+// prune 清除已删除地址的当前权重，地址项变更时调用
+func (s *roundRobinBalancer) prune(items []*TargetAddressItem) {
+	if s.currents == nil {
+		return
+	}
+
+	ids := make(map[string]bool, len(items))
+	for _, item := range items {
+		ids[item.AddrId] = true
+	}
+	for id := range s.currents {
+		if !ids[id] {
+			delete(s.currents, id)
+		}
+	}
+}
+
+type randomBalancer struct {
+}
+
+func (s *randomBalancer) selectItem(items []*TargetAddressItem, source string) *TargetAddressItem {
+	total := 0
+	c := len(items)
+	for i := 0; i < c; i++ {
+		total += items[i].weight()
+	}
+
+	n := rand.Intn(total)
+	for i := 0; i < c; i++ {
+		n -= items[i].weight()
+		if n < 0 {
+			return items[i]
+		}
+	}
+
+	return items[c-1]
+}
+
+// 加权最高随机权重哈希(rendezvous hashing)，地址上下线时只影响该地址上的会话
+type sourceHashBalancer struct {
+}
+
+func (s *sourceHashBalancer) selectItem(items []*TargetAddressItem, source string) *TargetAddressItem {
+	var addr *TargetAddressItem = nil
+	score := 0.0
+	c := len(items)
+	for i := 0; i < c; i++ {
+		item := items[i]
+		h := fnv.New64a()
+		h.Write([]byte(source))
+		h.Write([]byte(item.Addr))
+		v := (float64(h.Sum64()>>11) + 0.5) / float64(1<<53)
+		itemScore := float64(item.weight()) / -math.Log(v)
+		if addr == nil || itemScore > score {
+			addr = item
+			score = itemScore
+		}
+	}
+
+	return addr
+}
@@ -0,0 +1,69 @@
+package gproxy
+
+import (
+	"testing"
+)
+
+func TestTargetAddress_SelectAddress(t *testing.T) {
+	address := &TargetAddress{
+		SourceId: "s",
+		TargetId: "t",
+		Balance:  BalanceRoundRobin,
+	}
+	address.SetAddress("192.168.1.1:80")
+	address.AddAddress([]string{"192.168.1.2:80"})
+	address.SetWeights([]int{3, 1})
+	items := address.Items()
+	for i := 0; i < len(items); i++ {
+		items[i].alive = true
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		counts[address.SelectAddress("").Addr]++
+	}
+	if counts["192.168.1.1:80"] != 6 || counts["192.168.1.2:80"] != 2 {
+		t.Fatal("round robin:", counts)
+	}
+
+	address.Balance = BalanceSourceHash
+	address.balancer = nil
+	addr := address.SelectAddress("10.0.0.8")
+	for i := 0; i < 8; i++ {
+		if address.SelectAddress("10.0.0.8") != addr {
+			t.Fatal("source hash: address changed")
+		}
+	}
+
+	items[1].alive = false
+	for i := 0; i < 8; i++ {
+		if address.SelectAddress("10.0.0.9") != items[0] {
+			t.Fatal("dead address selected")
+		}
+	}
+}
+
+func TestRoundRobinBalancer_Prune(t *testing.T) {
+	address := &TargetAddress{Balance: BalanceRoundRobin}
+	address.SetAddress("192.168.1.1:80")
+	address.AddAddress([]string{"192.168.1.2:80"})
+	for _, item := range address.Items() {
+		item.SetAlive(true)
+	}
+	for i := 0; i < 4; i++ {
+		address.SelectAddress("")
+	}
+	rr := address.balancer.(*roundRobinBalancer)
+	if len(rr.currents) != 2 {
+		t.Fatal("currents:", rr.currents)
+	}
+
+	// 删除备用地址后清除其当前权重
+	address.SetAddress("192.168.1.1:80")
+	if len(rr.currents) != 1 {
+		t.Fatal("currents should be pruned:", rr.currents)
+	}
+	if _, ok := rr.currents[address.Items()[0].AddrId]; !ok {
+		t.Fatal("current of remaining address should be kept:", rr.currents)
+	}
+}
@@ -0,0 +1,186 @@
+package gproxy
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// BandwidthPolicy 带宽限制(字节/秒)，小于等于0时不限制
+type BandwidthPolicy struct {
+	// 上传(客户端至目标)，所有连接共享
+	Upload int64
+	// 下载(目标至客户端)，所有连接共享
+	Download int64
+	// 每个来源IP的上传
+	ClientUpload int64
+	// 每个来源IP的下载
+	ClientDownload int64
+}
+
+func (s *BandwidthPolicy) IsEmpty() bool {
+	return s.Upload <= 0 && s.Download <= 0 && s.ClientUpload <= 0 && s.ClientDownload <= 0
+}
+
+func (s *BandwidthPolicy) String() string {
+	if s.IsEmpty() {
+		return "none"
+	}
+
+	return fmt.Sprintf("up=%d, down=%d, client-up=%d, client-down=%d",
+		s.Upload, s.Download, s.ClientUpload, s.ClientDownload)
+}
+
+// bandwidthControl 按带宽限制策略分配连接的限速器
+type bandwidthControl struct {
+	sync.Mutex
+
+	upload         *rateLimiter
+	download       *rateLimiter
+	clientUpload   int64
+	clientDownload int64
+
+	clients map[string]*bandwidthClient
+}
+
+type bandwidthClient struct {
+	upload   *rateLimiter
+	download *rateLimiter
+	conns    int
+}
+
+// newBandwidthControl 策略为空时返回nil，nil不做任何限制
+func newBandwidthControl(policy BandwidthPolicy) *bandwidthControl {
+	if policy.IsEmpty() {
+		return nil
+	}
+
+	return &bandwidthControl{
+		upload:         newRateLimiter(policy.Upload),
+		download:       newRateLimiter(policy.Download),
+		clientUpload:   policy.ClientUpload,
+		clientDownload: policy.ClientDownload,
+		clients:        make(map[string]*bandwidthClient),
+	}
+}
+
+// acquire 将来源地址的限速器加入连接的上传及下载限速，
+// 返回的release须在连接结束时调用
+func (s *bandwidthControl) acquire(addr net.Addr, t *throttle) (release func()) {
+	if s == nil {
+		return func() {}
+	}
+
+	t.upload = append(t.upload, s.upload)
+	t.download = append(t.download, s.download)
+	if s.clientUpload <= 0 && s.clientDownload <= 0 {
+		return func() {}
+	}
+
+	ip := addrIP(addr)
+	s.Lock()
+	defer s.Unlock()
+
+	client, ok := s.clients[ip]
+	if !ok {
+		client = &bandwidthClient{
+			upload:   newRateLimiter(s.clientUpload),
+			download: newRateLimiter(s.clientDownload),
+		}
+		s.clients[ip] = client
+	}
+	client.conns++
+	t.upload = append(t.upload, client.upload)
+	t.download = append(t.download, client.download)
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			s.Lock()
+			defer s.Unlock()
+			client.conns--
+			if client.conns <= 0 {
+				delete(s.clients, ip)
+			}
+		})
+	}
+}
+
+// throttle 连接的上传及下载限速器(服务器、目标及来源IP)
+type throttle struct {
+	upload   rateLimiters
+	download rateLimiters
+}
+
+type rateLimiters []*rateLimiter
+
+func (s rateLimiters) wait(n int64) {
+	for _, v := range s {
+		v.wait(n)
+	}
+}
+
+// chunk 每次复制的字节数，限速时不超过最小速率的1/4，使流量更平稳
+func (s rateLimiters) chunk(size int64) int64 {
+	for _, v := range s {
+		if v == nil {
+			continue
+		}
+		if c := v.rate / 4; c < size {
+			size = c
+		}
+	}
+	if size < 512 {
+		size = 512
+	}
+
+	return size
+}
+
+// rateLimiter 令牌桶限速，容量为1秒的流量
+type rateLimiter struct {
+	sync.Mutex
+
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter rate小于等于0时返回nil，nil不做任何限制
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	return &rateLimiter{
+		rate:   rate,
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// wait 消耗n个字节的令牌，令牌不足时等待至补足
+func (s *rateLimiter) wait(n int64) {
+	if s == nil || n <= 0 {
+		return
+	}
+
+	s.Lock()
+	now := time.Now()
+	s.tokens += now.Sub(s.last).Seconds() * float64(s.rate)
+	if s.tokens > float64(s.rate) {
+		s.tokens = float64(s.rate)
+	}
+	s.last = now
+	s.tokens -= float64(n)
+	delay := time.Duration(0)
+	if s.tokens < 0 {
+		delay = time.Duration(-s.tokens / float64(s.rate) * float64(time.Second))
+	}
+	s.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,54 @@
+package gproxy
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(10 * 1024)
+	start := time.Now()
+	// 令牌桶初始为1秒的流量，之后按速率补充
+	for i := 0; i < 15; i++ {
+		limiter.wait(1024)
+	}
+	elapsed := time.Now().Sub(start)
+	if elapsed < 400*time.Millisecond || elapsed > 1500*time.Millisecond {
+		t.Fatal("elapsed:", elapsed)
+	}
+
+	if newRateLimiter(0) != nil {
+		t.Fatal("rate 0 should be unlimited")
+	}
+}
+
+func TestBandwidthControl_Acquire(t *testing.T) {
+	if newBandwidthControl(BandwidthPolicy{}) != nil {
+		t.Fatal("empty policy should be nil")
+	}
+
+	control := newBandwidthControl(BandwidthPolicy{Download: 1024 * 1024, ClientUpload: 1024})
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}
+	first := &throttle{}
+	release1 := control.acquire(addr, first)
+	second := &throttle{}
+	release2 := control.acquire(&net.TCPAddr{IP: addr.IP, Port: 1001}, second)
+
+	// 下载共享服务器限速；同一来源IP的连接共享上传限速
+	if first.download[0] == nil || first.download[0] != second.download[0] {
+		t.Fatal("download:", first.download, second.download)
+	}
+	if len(first.upload) != 2 || first.upload[1] == nil || first.upload[1] != second.upload[1] {
+		t.Fatal("client upload:", first.upload, second.upload)
+	}
+	if first.upload.chunk(proxyCopyChunk) != 512 {
+		t.Fatal("chunk:", first.upload.chunk(proxyCopyChunk))
+	}
+
+	release1()
+	release2()
+	if len(control.clients) != 0 {
+		t.Fatal("clients:", len(control.clients))
+	}
+}
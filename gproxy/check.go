@@ -0,0 +1,262 @@
+package gproxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CheckType 健康检测类型
+type CheckType int
+
+const (
+	// 建立TCP连接
+	CheckTcp CheckType = 0
+	// HTTP GET请求
+	CheckHttp CheckType = 1
+	// TLS握手
+	CheckTls CheckType = 2
+)
+
+var checkTypes = [...]string{
+	"tcp",
+	"http",
+	"tls",
+}
+
+func (s CheckType) String() string {
+	if s >= CheckTcp && s <= CheckTls {
+		return checkTypes[s]
+	}
+
+	return ""
+}
+
+func (s CheckType) IsValid() bool {
+	return s >= CheckTcp && s <= CheckTls
+}
+
+// HealthCheck 目标地址健康检测
+type HealthCheck struct {
+	// 检测类型
+	Type CheckType
+
+	// 检测间隔，小于1秒时为5秒
+	Interval time.Duration
+
+	// 超时时间，小于等于0时为500毫秒
+	Timeout time.Duration
+
+	// 连续成功次数达到该值时标记为在线，小于1时为1
+	Rise int
+
+	// 连续失败次数达到该值时标记为离线，小于1时为1
+	Fall int
+
+	// HTTP: 请求路径，如"/health", ""(根路径)
+	Path string
+
+	// HTTP/TLS: 请求主机名(Host头部或SNI)，空表示使用目标地址
+	Host string
+
+	// HTTP: 是否使用https
+	Https bool
+
+	// HTTP: 期望状态码，0表示200-399
+	Status int
+
+	// HTTP: 响应内容需包含的字符串，空表示不检测
+	Body string
+
+	// 被动检测: 连续连接失败次数达到该值时立即标记为离线(熔断)，小于1时不启用
+	Failures int
+
+	// 熔断冷却时间，标记为离线后在该时间内检测通过也不恢复为在线，小于等于0时为检测间隔
+	Cooldown time.Duration
+}
+
+func (s *HealthCheck) interval() time.Duration {
+	if s.Interval < time.Second {
+		return 5 * time.Second
+	}
+
+	return s.Interval
+}
+
+func (s *HealthCheck) cooldown() time.Duration {
+	if s.Cooldown <= 0 {
+		return s.interval()
+	}
+
+	return s.Cooldown
+}
+
+func (s *HealthCheck) timeout() time.Duration {
+	if s.Timeout <= 0 {
+		return 500 * time.Millisecond
+	}
+
+	return s.Timeout
+}
+
+func (s *HealthCheck) rise() int {
+	if s.Rise < 1 {
+		return 1
+	}
+
+	return s.Rise
+}
+
+func (s *HealthCheck) fall() int {
+	if s.Fall < 1 {
+		return 1
+	}
+
+	return s.Fall
+}
+
+func (s *HealthCheck) String() string {
+	passive := ""
+	if s.Failures > 0 {
+		passive = fmt.Sprintf(", failures=%d, cooldown=%v", s.Failures, s.cooldown())
+	}
+
+	switch s.Type {
+	case CheckHttp:
+		scheme := "http"
+		if s.Https {
+			scheme = "https"
+		}
+		return fmt.Sprintf("%s(%s%s, interval=%v, timeout=%v, rise=%d, fall=%d%s)",
+			s.Type, scheme, s.path(), s.interval(), s.timeout(), s.rise(), s.fall(), passive)
+	default:
+		return fmt.Sprintf("%s(interval=%v, timeout=%v, rise=%d, fall=%d%s)",
+			s.Type, s.interval(), s.timeout(), s.rise(), s.fall(), passive)
+	}
+}
+
+// Check 检测目标地址，返回nil表示检测通过
+func (s *HealthCheck) Check(addr string) error {
+	if len(addr) < 1 {
+		return fmt.Errorf("address is empty")
+	}
+
+	switch s.Type {
+	case CheckHttp:
+		return s.checkHttp(addr)
+	case CheckTls:
+		return s.checkTls(addr)
+	default:
+		return s.checkTcp(addr)
+	}
+}
+
+func (s *HealthCheck) checkTcp(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, s.timeout())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return nil
+}
+
+func (s *HealthCheck) checkTls(addr string) error {
+	dialer := &net.Dialer{Timeout: s.timeout()}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
+		ServerName:         s.serverName(addr),
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return nil
+}
+
+func (s *HealthCheck) checkHttp(addr string) error {
+	scheme := "http"
+	if s.Https {
+		scheme = "https"
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s://%s%s", scheme, addr, s.path()), nil)
+	if err != nil {
+		return err
+	}
+	if len(s.Host) > 0 {
+		req.Host = s.Host
+	}
+
+	client := &http.Client{
+		Timeout: s.timeout(),
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			TLSClientConfig: &tls.Config{
+				ServerName:         s.serverName(addr),
+				InsecureSkipVerify: true,
+			},
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if s.Status > 0 {
+		if resp.StatusCode != s.Status {
+			return fmt.Errorf("unexpected status code %d, want %d", resp.StatusCode, s.Status)
+		}
+	} else if resp.StatusCode < 200 || resp.StatusCode > 399 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	if len(s.Body) > 0 {
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(string(body), s.Body) {
+			return fmt.Errorf("response body not contains '%s'", s.Body)
+		}
+	}
+
+	return nil
+}
+
+func (s *HealthCheck) path() string {
+	if len(s.Path) < 1 {
+		return "/"
+	}
+	if s.Path[0] != '/' {
+		return "/" + s.Path
+	}
+
+	return s.Path
+}
+
+func (s *HealthCheck) serverName(addr string) string {
+	if len(s.Host) > 0 {
+		host, _, err := net.SplitHostPort(s.Host)
+		if err == nil {
+			return host
+		}
+		return s.Host
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
@@ -0,0 +1,40 @@
+package gproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHealthCheck_Check(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("status: ok"))
+	}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	check := &HealthCheck{Type: CheckTcp}
+	if err := check.Check(addr); err != nil {
+		t.Fatal("tcp:", err)
+	}
+
+	check = &HealthCheck{Type: CheckHttp, Path: "/health", Body: "ok"}
+	if err := check.Check(addr); err != nil {
+		t.Fatal("http:", err)
+	}
+
+	check = &HealthCheck{Type: CheckHttp, Path: "/"}
+	if err := check.Check(addr); err == nil {
+		t.Fatal("http: 503 should be failed")
+	}
+
+	check = &HealthCheck{Type: CheckHttp, Path: "/health", Body: "fail"}
+	if err := check.Check(addr); err == nil {
+		t.Fatal("http: body should not be matched")
+	}
+}
@@ -0,0 +1,85 @@
+package gproxy
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// connectionCollection 正在转发的连接，用于停止服务时等待连接结束或强制关闭
+type connectionCollection struct {
+	sync.Mutex
+
+	items map[*connectionPair]bool
+}
+
+type connectionPair struct {
+	src net.Conn
+	dst net.Conn
+}
+
+func newConnectionCollection() *connectionCollection {
+	return &connectionCollection{
+		items: make(map[*connectionPair]bool),
+	}
+}
+
+func (s *connectionCollection) add(src, dst net.Conn) *connectionPair {
+	if s == nil {
+		return nil
+	}
+
+	item := &connectionPair{src: src, dst: dst}
+	s.Lock()
+	s.items[item] = true
+	s.Unlock()
+
+	return item
+}
+
+func (s *connectionCollection) remove(item *connectionPair) {
+	if s == nil || item == nil {
+		return
+	}
+
+	s.Lock()
+	delete(s.items, item)
+	s.Unlock()
+}
+
+func (s *connectionCollection) count() int {
+	s.Lock()
+	defer s.Unlock()
+
+	return len(s.items)
+}
+
+// wait 等待所有连接结束，超时返回false
+func (s *connectionCollection) wait(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for s.count() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return true
+}
+
+// closeAll 强制关闭所有连接，返回关闭的连接数
+func (s *connectionCollection) closeAll() int {
+	s.Lock()
+	items := make([]*connectionPair, 0, len(s.items))
+	for item := range s.items {
+		items = append(items, item)
+	}
+	s.Unlock()
+
+	for _, item := range items {
+		item.src.Close()
+		item.dst.Close()
+	}
+
+	return len(items)
+}
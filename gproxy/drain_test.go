@@ -0,0 +1,92 @@
+package gproxy
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTargetAddress_Draining(t *testing.T) {
+	address := &TargetAddress{
+		SourceId: "s",
+		TargetId: "t",
+		Balance:  BalanceRoundRobin,
+	}
+	address.SetAddress("192.168.1.1:80")
+	address.AddAddress([]string{"192.168.1.2:80"})
+	items := address.Items()
+	for i := 0; i < len(items); i++ {
+		items[i].alive = true
+	}
+
+	items[0].SetDraining(true)
+	for i := 0; i < 4; i++ {
+		if address.SelectAddress("") != items[1] {
+			t.Fatal("draining address should not be selected")
+		}
+	}
+
+	// 没有可用地址时选择未排空的地址
+	items[0].alive = false
+	items[1].alive = false
+	if address.SelectAddress("") != items[1] {
+		t.Fatal("non-draining address should be preferred")
+	}
+}
+
+func TestConnectionCollection(t *testing.T) {
+	connections := newConnectionCollection()
+	client, server := net.Pipe()
+	pair := connections.add(client, server)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		connections.remove(pair)
+	}()
+	if !connections.wait(2 * time.Second) {
+		t.Fatal("wait: connection should be finished")
+	}
+
+	connections.add(client, server)
+	if connections.wait(200 * time.Millisecond) {
+		t.Fatal("wait: should time out")
+	}
+	if n := connections.closeAll(); n != 1 {
+		t.Fatal("close all:", n)
+	}
+	if _, err := client.Write([]byte("x")); err == nil {
+		t.Fatal("connection should be closed")
+	}
+}
+
+func TestServer_StopWithoutBlocking(t *testing.T) {
+	s := &Server{DrainTimeout: time.Second}
+	s.connections = newConnectionCollection()
+	s.status = StatusRunning
+	client, server := net.Pipe()
+	s.connections.add(client, server)
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- s.Stop()
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// 等待已有连接结束期间，摘流及在线状态查询不被阻塞
+	start := time.Now()
+	s.Drain("test", true)
+	s.HostAlive("test")
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatal("drain blocked by stop:", elapsed)
+	}
+	if s.Result().Status != StatusStopping {
+		t.Fatal("status:", s.Result().Status)
+	}
+
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+	if s.Result().Status != StatusStopped {
+		t.Fatal("status:", s.Result().Status)
+	}
+}
@@ -0,0 +1,325 @@
+package gproxy
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/csby/gwsf/gtype"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	historyFileName     = "links.log"
+	historyFilePrefix   = "links-"
+	historyFileSuffix   = ".log"
+	historyDefaultSize  = 10 * 1024 * 1024
+	historyDefaultLimit = 1000
+)
+
+type LinkHistoryFilter struct {
+	LinkFilter
+
+	SourceAddr string          `json:"sourceAddr" note:"传入地址"`
+	StartTime  *gtype.DateTime `json:"startTime" note:"开始时间（断开时间），空表示不限制"`
+	EndTime    *gtype.DateTime `json:"endTime" note:"结束时间（断开时间），空表示不限制"`
+	Limit      int             `json:"limit" note:"最大返回数量，0表示1000"`
+}
+
+func (s *LinkHistoryFilter) match(link *Link) bool {
+	if !s.LinkFilter.match(link) {
+		return false
+	}
+
+	if len(s.SourceAddr) > 0 {
+		if !strings.Contains(link.SourceAddr, s.SourceAddr) {
+			return false
+		}
+	}
+
+	t := time.Time(link.Time)
+	if s.StartTime != nil {
+		if t.Before(time.Time(*s.StartTime)) {
+			return false
+		}
+	}
+	if s.EndTime != nil {
+		if t.After(time.Time(*s.EndTime)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *LinkHistoryFilter) limit() int {
+	if s.Limit > 0 {
+		return s.Limit
+	}
+
+	return historyDefaultLimit
+}
+
+// LinkHistory 已断开连接的历史记录，每条记录一行(JSON)保存至文件夹中；
+// 当前文件超过大小限制时滚动为新文件，只保留最近的maxFiles个文件
+type LinkHistory struct {
+	sync.Mutex
+
+	folder   string
+	maxSize  int64
+	maxFiles int
+
+	file *os.File
+	size int64
+}
+
+// NewLinkHistory maxSize为单个文件的最大字节数，maxFiles为保留的最大文件数(包括当前文件)
+func NewLinkHistory(folder string, maxSize int64, maxFiles int) (*LinkHistory, error) {
+	if len(folder) < 1 {
+		return nil, fmt.Errorf("folder is empty")
+	}
+	err := os.MkdirAll(folder, 0777)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize <= 0 {
+		maxSize = historyDefaultSize
+	}
+	if maxFiles <= 0 {
+		maxFiles = 10
+	}
+
+	return &LinkHistory{
+		folder:   folder,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}, nil
+}
+
+func (s *LinkHistory) Add(link *Link) error {
+	if link == nil {
+		return nil
+	}
+	data, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.file == nil {
+		err = s.open()
+		if err != nil {
+			return err
+		}
+	}
+	if s.size > 0 && s.size+int64(len(data)) > s.maxSize {
+		err = s.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(data)
+	s.size += int64(n)
+
+	return err
+}
+
+// Query 按断开时间倒序返回匹配的记录
+func (s *LinkHistory) Query(filter *LinkHistoryFilter) ([]*Link, error) {
+	if filter == nil {
+		filter = &LinkHistoryFilter{}
+	}
+	limit := filter.limit()
+
+	s.Lock()
+	defer s.Unlock()
+
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*Link, 0)
+	for i := len(files) - 1; i >= 0; i-- {
+		// 文件最后修改时间早于开始时间时，其中的记录均不匹配
+		if filter.StartTime != nil {
+			info, err := os.Stat(files[i])
+			if err == nil && info.ModTime().Before(time.Time(*filter.StartTime)) {
+				break
+			}
+		}
+
+		links, err := s.read(files[i], filter)
+		if err != nil {
+			return nil, err
+		}
+		for j := len(links) - 1; j >= 0; j-- {
+			items = append(items, links[j])
+			if len(items) >= limit {
+				return items, nil
+			}
+		}
+	}
+
+	return items, nil
+}
+
+func (s *LinkHistory) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+func (s *LinkHistory) open() error {
+	file, err := os.OpenFile(filepath.Join(s.folder, historyFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.size = info.Size()
+
+	return nil
+}
+
+func (s *LinkHistory) rotate() error {
+	s.file.Close()
+	s.file = nil
+
+	name := fmt.Sprintf("%s%s%s", historyFilePrefix, time.Now().Format("20060102-150405.000000"), historyFileSuffix)
+	err := os.Rename(filepath.Join(s.folder, historyFileName), filepath.Join(s.folder, name))
+	if err != nil {
+		return err
+	}
+
+	files, err := s.rotatedFiles()
+	if err == nil {
+		for i := 0; i <= len(files)-s.maxFiles; i++ {
+			os.Remove(files[i])
+		}
+	}
+
+	return s.open()
+}
+
+// files 返回所有记录文件，按时间正序排列，当前文件在最后
+func (s *LinkHistory) files() ([]string, error) {
+	files, err := s.rotatedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	current := filepath.Join(s.folder, historyFileName)
+	_, err = os.Stat(current)
+	if err == nil {
+		files = append(files, current)
+	}
+
+	return files, nil
+}
+
+func (s *LinkHistory) rotatedFiles() ([]string, error) {
+	infos, err := ioutil.ReadDir(s.folder)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0)
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		name := info.Name()
+		if strings.HasPrefix(name, historyFilePrefix) && strings.HasSuffix(name, historyFileSuffix) {
+			files = append(files, filepath.Join(s.folder, name))
+		}
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func (s *LinkHistory) read(path string, filter *LinkHistoryFilter) ([]*Link, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	links := make([]*Link, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		link := &Link{}
+		if json.Unmarshal(scanner.Bytes(), link) != nil {
+			continue
+		}
+		if filter.match(link) {
+			links = append(links, link)
+		}
+	}
+
+	return links, scanner.Err()
+}
+
+// WriteLinksCsv 以CSV格式输出连接记录
+func WriteLinksCsv(w io.Writer, links []*Link) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{
+		"time", "protocol", "listenAddr", "domain", "sourceAddr", "targetAddr",
+		"bytesIn", "bytesOut", "duration", "closeReason",
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, link := range links {
+		if link == nil {
+			continue
+		}
+		err = writer.Write([]string{
+			link.Time.String(),
+			link.Protocol,
+			link.ListenAddr,
+			link.Domain,
+			link.SourceAddr,
+			link.TargetAddr,
+			fmt.Sprint(link.BytesIn),
+			fmt.Sprint(link.BytesOut),
+			fmt.Sprint(link.Duration),
+			link.CloseReason,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
@@ -0,0 +1,86 @@
+package gproxy
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"github.com/csby/gwsf/gtype"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLinkHistory(t *testing.T) {
+	folder, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	history, err := NewLinkHistory(folder, 1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer history.Close()
+
+	now := time.Now()
+	for i := 0; i < 40; i++ {
+		domain := "a.com"
+		if i%2 == 1 {
+			domain = "b.com"
+		}
+		err = history.Add(&Link{
+			Id:         fmt.Sprint(i),
+			Time:       gtype.DateTime(now.Add(time.Duration(i-40) * time.Minute)),
+			ListenAddr: ":80",
+			Domain:     domain,
+			SourceAddr: fmt.Sprintf("10.0.0.%d:1000", i),
+			TargetAddr: "192.168.1.6:8080",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 文件数量受限，最早的记录已被删除
+	files, _ := filepath.Glob(filepath.Join(folder, "*.log"))
+	if len(files) != 3 {
+		t.Fatal("files:", files)
+	}
+	all, err := history.Query(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) < 1 || len(all) >= 40 || all[0].Id != "39" {
+		t.Fatal("all:", len(all))
+	}
+
+	start := gtype.DateTime(now.Add(-10*time.Minute - time.Second))
+	links, err := history.Query(&LinkHistoryFilter{
+		LinkFilter: LinkFilter{Domain: "b.com"},
+		StartTime:  &start,
+		Limit:      3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 3 || links[0].Id != "39" || links[1].Id != "37" || links[2].Id != "35" {
+		t.Fatal("links:", links)
+	}
+
+	links, _ = history.Query(&LinkHistoryFilter{SourceAddr: "10.0.0.38:"})
+	if len(links) != 1 || links[0].Id != "38" {
+		t.Fatal("source:", links)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteLinksCsv(buf, links); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(buf).ReadAll()
+	if err != nil || len(records) != 2 || records[1][3] != "a.com" {
+		t.Fatal("csv:", records, err)
+	}
+}
@@ -0,0 +1,413 @@
+package gproxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/csby/gwsf/gtype"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeaderRewrite HTTP头部修改，先删除后设置
+type HeaderRewrite struct {
+	// 添加或替换的头部
+	Set map[string]string
+	// 删除的头部
+	Remove []string
+}
+
+func (s *HeaderRewrite) apply(header http.Header) {
+	for _, name := range s.Remove {
+		header.Del(name)
+	}
+	for name, value := range s.Set {
+		header.Set(name, value)
+	}
+}
+
+type httpContextKey int
+
+const (
+	httpConnKey httpContextKey = iota
+	httpRequestKey
+)
+
+// httpProxy HTTP(七层)转发，逐个请求按域名及路径匹配路由，
+// 并按负载均衡策略为每个请求选择目标地址；
+// 每个请求作为一个连接(Link)记录，访问控制的并发数及频率也按请求计算
+type httpProxy struct {
+	gtype.Base
+	sync.Mutex
+
+	address string
+	routes  []*httpRoute
+	server  *http.Server
+	conns   map[net.Conn]*connectionPair
+
+	traffics       *trafficCollection
+	connections    *connectionCollection
+	onConnected    func(link *Link)
+	onDisconnected func(link *Link)
+	onRejected     func(link *Link)
+}
+
+func newHttpProxy(address string, routes []*httpRoute) *httpProxy {
+	s := &httpProxy{
+		address: address,
+		routes:  routes,
+		conns:   make(map[net.Conn]*connectionPair),
+	}
+	s.server = &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		ConnState:         s.connState,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, httpConnKey, c)
+		},
+	}
+
+	return s
+}
+
+func (s *httpProxy) serve(ln net.Listener) {
+	err := s.server.Serve(ln)
+	if err != nil && err != http.ErrServerClosed && err != errListenerClosed {
+		s.LogError(fmt.Sprintf("http proxy(listen=%s): %v", s.address, err))
+	}
+}
+
+// shutdown 停止接收新请求，关闭空闲连接，处理中的请求继续直到结束
+func (s *httpProxy) shutdown() {
+	go func() {
+		s.server.Shutdown(context.Background())
+		for _, route := range s.routes {
+			route.transport.CloseIdleConnections()
+		}
+	}()
+}
+
+// connState 处理请求中的连接计入正在转发的连接，空闲连接在停止服务时直接关闭
+func (s *httpProxy) connState(conn net.Conn, state http.ConnState) {
+	s.Lock()
+	defer s.Unlock()
+
+	switch state {
+	case http.StateActive:
+		if _, ok := s.conns[conn]; !ok {
+			s.conns[conn] = s.connections.add(conn, conn)
+		}
+	case http.StateIdle, http.StateHijacked, http.StateClosed:
+		if pair, ok := s.conns[conn]; ok {
+			delete(s.conns, conn)
+			s.connections.remove(pair)
+		}
+	}
+}
+
+func (s *httpProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := s.match(r)
+	if route == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var remoteAddr net.Addr = nil
+	if conn, ok := r.Context().Value(httpConnKey).(net.Conn); ok {
+		remoteAddr = conn.RemoteAddr()
+	}
+	for _, access := range route.access {
+		release, reason := access.acquire(remoteAddr)
+		if len(reason) > 0 {
+			s.reject(route, r, reason)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		defer release()
+	}
+	limits := &throttle{}
+	for _, bandwidth := range route.bandwidth {
+		defer bandwidth.acquire(remoteAddr, limits)()
+	}
+
+	item := route.target.SelectAddress(addrIP(remoteAddr))
+	if item == nil {
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	item.IncreaseCount()
+	defer item.DecreaseCount()
+
+	link := &Link{
+		Id:         newGuid(),
+		Time:       gtype.DateTime(time.Now()),
+		Protocol:   ProtocolHttp,
+		ListenAddr: s.address,
+		Domain:     httpHost(r),
+		SourceAddr: r.RemoteAddr,
+		TargetAddr: item.Addr,
+		Status:     0,
+		SourceId:   route.target.SourceId,
+		TargetId:   route.target.TargetId,
+		start:      time.Now(),
+	}
+	if s.traffics != nil {
+		link.traffic = s.traffics.newLink(link.SourceId, link.TargetId)
+	} else {
+		link.traffic = &linkTraffic{}
+	}
+	link.traffic.open()
+	if s.onConnected != nil {
+		connected := *link
+		go s.onConnected(&connected)
+	}
+
+	request := &httpRequest{item: item, tls: r.TLS != nil}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &httpBody{ReadCloser: r.Body, count: link.traffic.addIn, limits: limits.upload}
+	}
+	writer := &httpWriter{ResponseWriter: w, count: link.traffic.addOut, limits: limits.download}
+	route.proxy.ServeHTTP(writer, r.WithContext(context.WithValue(r.Context(), httpRequestKey, request)))
+
+	link.traffic.shut()
+	link.Time = gtype.DateTime(time.Now())
+	link.Status = 1
+	if request.err != nil {
+		link.CloseReason = fmt.Sprintf("target error: %v", request.err)
+	} else {
+		status := writer.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		link.CloseReason = fmt.Sprintf("%s %s %d", r.Method, r.URL.Path, status)
+	}
+	link.refresh()
+	if s.onDisconnected != nil {
+		go s.onDisconnected(link)
+	}
+}
+
+// match 按域名、路径、来源地址及ALPN匹配路由，优先顺序见routeMatcher
+func (s *httpProxy) match(r *http.Request) *httpRoute {
+	req := &matchRequest{
+		host: httpHost(r),
+		path: r.URL.Path,
+	}
+	if conn, ok := r.Context().Value(httpConnKey).(net.Conn); ok {
+		req.ip = net.ParseIP(addrIP(conn.RemoteAddr()))
+	}
+	if r.TLS != nil && len(r.TLS.NegotiatedProtocol) > 0 {
+		req.alpn = []string{r.TLS.NegotiatedProtocol}
+	}
+
+	matchers := make([]*routeMatcher, 0, len(s.routes))
+	for _, route := range s.routes {
+		matchers = append(matchers, route.matcher)
+	}
+	index := selectRoute(matchers, req)
+	if index < 0 {
+		return nil
+	}
+
+	return s.routes[index]
+}
+
+func (s *httpProxy) reject(route *httpRoute, r *http.Request, reason string) {
+	if s.traffics != nil {
+		s.traffics.reject(route.target.SourceId, route.target.TargetId)
+	}
+	if s.onRejected != nil {
+		go s.onRejected(&Link{
+			Id:          newGuid(),
+			Time:        gtype.DateTime(time.Now()),
+			Protocol:    ProtocolHttp,
+			ListenAddr:  s.address,
+			Domain:      httpHost(r),
+			SourceAddr:  r.RemoteAddr,
+			Status:      1,
+			SourceId:    route.target.SourceId,
+			TargetId:    route.target.TargetId,
+			CloseReason: "rejected: " + reason,
+		})
+	}
+}
+
+func httpHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		return r.Host
+	}
+
+	return host
+}
+
+// httpRoute HTTP转发路由
+type httpRoute struct {
+	Route
+
+	matcher   *routeMatcher
+	target    *TargetAddress
+	access    []*accessControl
+	bandwidth []*bandwidthControl
+	proxy     *httputil.ReverseProxy
+	transport *http.Transport
+}
+
+func newHttpRoute(route Route, matcher *routeMatcher, target *TargetAddress, access []*accessControl, bandwidth []*bandwidthControl) *httpRoute {
+	s := &httpRoute{
+		Route:     route,
+		matcher:   matcher,
+		target:    target,
+		access:    access,
+		bandwidth: bandwidth,
+	}
+	s.transport = &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: time.Minute,
+		}).DialContext,
+		MaxIdleConnsPerHost:   32,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	if route.Encrypt {
+		s.transport.TLSClientConfig = newEncryptConfig(route.serverName(), route.SkipVerify)
+	}
+	s.proxy = &httputil.ReverseProxy{
+		Director:       s.direct,
+		Transport:      s.transport,
+		FlushInterval:  -1,
+		ModifyResponse: s.modifyResponse,
+		ErrorHandler:   s.handleError,
+	}
+
+	return s
+}
+
+// direct 设置请求的目标地址、路径及X-Forwarded头部，
+// X-Forwarded-For由httputil.ReverseProxy追加
+func (s *httpRoute) direct(r *http.Request) {
+	request := r.Context().Value(httpRequestKey).(*httpRequest)
+	r.URL.Scheme = "http"
+	if s.Encrypt {
+		r.URL.Scheme = "https"
+	}
+	r.URL.Host = request.item.Addr
+	if len(s.PathRewrite) > 0 {
+		r.URL.Path = s.rewritePath(r.URL.Path)
+		r.URL.RawPath = ""
+	}
+
+	proto := "http"
+	if request.tls {
+		proto = "https"
+	}
+	r.Header.Set("X-Forwarded-Proto", proto)
+	r.Header.Set("X-Forwarded-Host", r.Host)
+	s.RequestHeader.apply(r.Header)
+}
+
+func (s *httpRoute) rewritePath(path string) string {
+	rest := strings.TrimPrefix(path, s.Path)
+	prefix := s.PathRewrite
+	if strings.HasSuffix(prefix, "/") && strings.HasPrefix(rest, "/") {
+		rest = rest[1:]
+	}
+	path = prefix + rest
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	return path
+}
+
+func (s *httpRoute) modifyResponse(resp *http.Response) error {
+	request := resp.Request.Context().Value(httpRequestKey).(*httpRequest)
+	request.item.dialSucceeded()
+	s.ResponseHeader.apply(resp.Header)
+
+	return nil
+}
+
+// handleError 连接目标出错时返回502，客户端取消的请求不计入目标失败次数
+func (s *httpRoute) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	request := r.Context().Value(httpRequestKey).(*httpRequest)
+	request.err = err
+	if r.Context().Err() == nil {
+		request.item.dialFailed(err, &s.target.Check)
+	}
+	w.WriteHeader(http.StatusBadGateway)
+}
+
+type httpRequest struct {
+	item *TargetAddressItem
+	tls  bool
+	err  error
+}
+
+// httpBody 统计请求的传入字节数，并按上传带宽限速
+type httpBody struct {
+	io.ReadCloser
+	count  func(n int64)
+	limits rateLimiters
+}
+
+func (s *httpBody) Read(p []byte) (int, error) {
+	n, err := s.ReadCloser.Read(p)
+	s.count(int64(n))
+	s.limits.wait(int64(n))
+
+	return n, err
+}
+
+// httpWriter 统计响应的传出字节数及状态码，并按下载带宽限速
+type httpWriter struct {
+	http.ResponseWriter
+	count  func(n int64)
+	limits rateLimiters
+	status int
+}
+
+func (s *httpWriter) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *httpWriter) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(p)
+	s.count(int64(n))
+	s.limits.wait(int64(n))
+
+	return n, err
+}
+
+func (s *httpWriter) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 用于协议升级(如websocket)
+func (s *httpWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("http.Hijacker not implemented")
+	}
+
+	return h.Hijack()
+}
+
+func (s *httpWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,116 @@
+package gproxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHttpProxy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "backend")
+		w.Header().Set("X-Backend", "1")
+		fmt.Fprintf(w, "%s|%s|%s|%s|%s|%s", r.URL.Path, r.Host,
+			r.Header.Get("X-Forwarded-For"), r.Header.Get("X-Forwarded-Proto"),
+			r.Header.Get("X-Forwarded-Host"), r.Header.Get("X-Token")+r.Header.Get("X-Internal"))
+	}))
+	defer ts.Close()
+
+	index := 0
+	newRoute := func(route Route) *httpRoute {
+		address := &TargetAddress{SourceId: "s", TargetId: route.TargetId}
+		address.SetAddress(ts.Listener.Addr().String())
+		address.Items()[0].SetAlive(true)
+		matcher, err := newRouteMatcher(index, route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index++
+		return newHttpRoute(route, matcher, address, nil, nil)
+	}
+	proxy := newHttpProxy(":80", []*httpRoute{
+		newRoute(Route{TargetId: "all"}),
+		newRoute(Route{
+			TargetId:    "api",
+			Domain:      "test.com",
+			Path:        "/api",
+			PathRewrite: "/",
+			RequestHeader: HeaderRewrite{
+				Set:    map[string]string{"X-Token": "abc"},
+				Remove: []string{"X-Internal"},
+			},
+			ResponseHeader: HeaderRewrite{
+				Set:    map[string]string{"Server": "gproxy"},
+				Remove: []string{"X-Backend"},
+			},
+		}),
+	})
+	links := make(chan *Link, 4)
+	proxy.onDisconnected = func(link *Link) { links <- link }
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go proxy.serve(ln)
+	defer proxy.server.Close()
+
+	get := func(host, path string) (*http.Response, string) {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+ln.Addr().String()+path, nil)
+		req.Host = host
+		req.Header.Set("X-Internal", "secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := get("test.com", "/api/users")
+	values := strings.Split(body, "|")
+	if len(values) != 6 || values[0] != "/users" || values[1] != "test.com" ||
+		values[2] != "127.0.0.1" || values[3] != "http" || values[4] != "test.com" || values[5] != "abc" {
+		t.Fatal("api:", body)
+	}
+	if resp.Header.Get("Server") != "gproxy" || resp.Header.Get("X-Backend") != "" {
+		t.Fatal("response header:", resp.Header)
+	}
+	select {
+	case link := <-links:
+		if link.Protocol != ProtocolHttp || link.TargetId != "api" || link.Domain != "test.com" || link.BytesOut != int64(len(body)) {
+			t.Fatal("link:", link.Protocol, link.TargetId, link.Domain, link.BytesOut)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("link expected")
+	}
+
+	// 其他域名或路径转发至默认路由，不修改路径及头部
+	resp, body = get("other.com", "/api/users")
+	values = strings.Split(body, "|")
+	if len(values) != 6 || values[0] != "/api/users" || values[5] != "secret" || resp.Header.Get("X-Backend") != "1" {
+		t.Fatal("default:", body)
+	}
+}
+
+func TestHttpRoute_RewritePath(t *testing.T) {
+	tests := []struct {
+		path, rewrite, in, out string
+	}{
+		{"/api", "/", "/api/users", "/users"},
+		{"/api", "/", "/api", "/"},
+		{"/api", "/v2", "/api/users", "/v2/users"},
+		{"", "/app", "/users", "/app/users"},
+	}
+	for _, test := range tests {
+		route := &httpRoute{Route: Route{Path: test.path, PathRewrite: test.rewrite}}
+		if v := route.rewritePath(test.in); v != test.out {
+			t.Errorf("rewrite(%s, %s, %s) = %s, want %s", test.path, test.rewrite, test.in, v, test.out)
+		}
+	}
+}
@@ -5,16 +5,38 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Link struct {
-	Id         string         `json:"id" note:"标识ID"`
-	Time       gtype.DateTime `json:"time" note:"时间"`
-	ListenAddr string         `json:"listenAddr" note:"监听地址"`
-	Domain     string         `json:"domain" note:"域名"`
-	SourceAddr string         `json:"sourceAddr" note:"传入地址"`
-	TargetAddr string         `json:"targetAddr" note:"目标地址"`
-	Status     int            `json:"status" note:"状态: 0-已连接; 1-已断开"`
+	Id          string         `json:"id" note:"标识ID"`
+	Time        gtype.DateTime `json:"time" note:"时间"`
+	Protocol    string         `json:"protocol" note:"协议: tcp、udp或http（http时每个请求为一个连接）"`
+	ListenAddr  string         `json:"listenAddr" note:"监听地址"`
+	Domain      string         `json:"domain" note:"域名"`
+	SourceAddr  string         `json:"sourceAddr" note:"传入地址"`
+	TargetAddr  string         `json:"targetAddr" note:"目标地址"`
+	Status      int            `json:"status" note:"状态: 0-已连接; 1-已断开"`
+	SourceId    string         `json:"sourceId" note:"服务器标识ID"`
+	TargetId    string         `json:"targetId" note:"目标标识ID"`
+	BytesIn     int64          `json:"bytesIn" note:"传入字节数（客户端至目标）"`
+	BytesOut    int64          `json:"bytesOut" note:"传出字节数（目标至客户端）"`
+	Duration    int64          `json:"duration" note:"持续时间（毫秒）"`
+	CloseReason string         `json:"closeReason" note:"断开原因，仅已断开时有效"`
+
+	start   time.Time
+	traffic *linkTraffic
+}
+
+// refresh 更新字节数及持续时间为当前值
+func (s *Link) refresh() {
+	if s.traffic != nil {
+		s.BytesIn = s.traffic.in()
+		s.BytesOut = s.traffic.out()
+	}
+	if !s.start.IsZero() {
+		s.Duration = int64(time.Now().Sub(s.start) / time.Millisecond)
+	}
 }
 
 type LinkFilter struct {
@@ -109,7 +131,9 @@ func (s *linkCollection) Lst(filter *LinkFilter) []*Link {
 			}
 		}
 
-		items = append(items, v)
+		item := *v
+		item.refresh()
+		items = append(items, &item)
 	}
 
 	sort.Sort(items)
@@ -0,0 +1,229 @@
+package gproxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"github.com/csby/tcpproxy"
+	"net"
+	"sync"
+)
+
+var errListenerClosed = errors.New("use of closed network connection")
+
+// proxyListener 监听地址及其路由，每个监听地址使用独立的tcpproxy.Proxy，
+// 路由变更时只替换该地址的tcpproxy.Proxy，其他地址的监听及连接不受影响；
+// UDP监听地址使用udpProxy，路由变更时只更新目标；
+// HTTP监听地址使用httpProxy，路由变更时同样接管该套接字
+type proxyListener struct {
+	address string
+	routes  []Route
+	agent   *tcpproxy.Proxy
+	socket  *sharedSocket
+	udp     *udpProxy
+	http    *httpProxy
+
+	targetAddresses []*TargetAddress
+}
+
+// retire 停止接收新连接，已有连接继续直到结束(UDP会话直接关闭)
+func (s *proxyListener) retire() {
+	if s.udp != nil {
+		s.udp.Close()
+		return
+	}
+	s.socket.Close()
+	if s.http != nil {
+		s.http.shutdown()
+	}
+}
+
+// close 停止监听并关闭tcpproxy.Proxy(或httpProxy)
+func (s *proxyListener) close() error {
+	if s.udp != nil {
+		return s.udp.Close()
+	}
+	if s.http != nil {
+		s.socket.Close()
+		s.http.shutdown()
+		return nil
+	}
+
+	err := s.agent.Close()
+	s.socket.Close()
+
+	return err
+}
+
+// itemAlive 返回地址当前的在线状态
+func (s *proxyListener) itemAlive(addrId string) (*TargetAddressItem, bool) {
+	for _, address := range s.targetAddresses {
+		for _, item := range address.Items() {
+			if item != nil && item.AddrId == addrId {
+				return item, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// targetAddress 返回目标(目标标识)的地址
+func (s *proxyListener) targetAddress(targetId string) *TargetAddress {
+	for _, address := range s.targetAddresses {
+		if address.TargetId == targetId {
+			return address
+		}
+	}
+
+	return nil
+}
+
+// sharedSocket 监听套接字，接收的连接分发给当前关联的socketListener；
+// 路由变更时新的tcpproxy.Proxy直接接管该套接字，无需重新监听端口
+type sharedSocket struct {
+	sync.Mutex
+
+	ln      net.Listener
+	current *socketListener
+	closed  bool
+}
+
+func listenSocket(network, address string) (*sharedSocket, error) {
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sharedSocket{ln: ln}
+	go s.serve()
+
+	return s, nil
+}
+
+func (s *sharedSocket) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			s.Lock()
+			closed := s.closed
+			s.Unlock()
+			if closed {
+				return
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			s.Close()
+			return
+		}
+
+		s.dispatch(conn)
+	}
+}
+
+func (s *sharedSocket) dispatch(conn net.Conn) {
+	for {
+		s.Lock()
+		current := s.current
+		s.Unlock()
+		if current == nil {
+			conn.Close()
+			return
+		}
+
+		select {
+		case current.conns <- conn:
+			return
+		case <-current.done:
+			// 已被替换或关闭，重新获取当前的socketListener
+		}
+	}
+}
+
+// attach 创建新的socketListener并替换当前的socketListener
+// tlsConfig: 不为空时为TLS终止，接收的连接先解密
+func (s *sharedSocket) attach(proxyProtocol *ProxyProtocolListener, tlsConfig *tls.Config) *socketListener {
+	l := &socketListener{
+		socket:        s,
+		conns:         make(chan net.Conn),
+		done:          make(chan struct{}),
+		proxyProtocol: proxyProtocol,
+		tlsConfig:     tlsConfig,
+	}
+
+	s.Lock()
+	previous := s.current
+	s.current = l
+	s.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+
+	return l
+}
+
+func (s *sharedSocket) detach(l *socketListener) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.current == l {
+		s.current = nil
+	}
+}
+
+func (s *sharedSocket) Close() error {
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		return nil
+	}
+	s.closed = true
+	current := s.current
+	s.current = nil
+	s.Unlock()
+
+	if current != nil {
+		current.Close()
+	}
+
+	return s.ln.Close()
+}
+
+// socketListener 提供给tcpproxy.Proxy(或httpProxy)的监听
+type socketListener struct {
+	socket        *sharedSocket
+	conns         chan net.Conn
+	done          chan struct{}
+	once          sync.Once
+	proxyProtocol *ProxyProtocolListener
+	tlsConfig     *tls.Config
+}
+
+func (s *socketListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-s.conns:
+		if s.proxyProtocol != nil {
+			conn = s.proxyProtocol.wrap(conn)
+		}
+		if s.tlsConfig != nil {
+			conn = tls.Server(conn, s.tlsConfig)
+		}
+		return conn, nil
+	case <-s.done:
+		return nil, errListenerClosed
+	}
+}
+
+func (s *socketListener) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+		s.socket.detach(s)
+	})
+
+	return nil
+}
+
+func (s *socketListener) Addr() net.Addr {
+	return s.socket.ln.Addr()
+}
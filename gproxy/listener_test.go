@@ -0,0 +1,99 @@
+package gproxy
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func acceptTimeout(t *testing.T, ln net.Listener) net.Conn {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := ln.Accept()
+		ch <- result{conn, err}
+	}()
+
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			t.Fatal("accept:", r.err)
+		}
+		return r.conn
+	case <-time.After(3 * time.Second):
+		t.Fatal("accept timeout")
+	}
+
+	return nil
+}
+
+func TestSharedSocket_Attach(t *testing.T) {
+	socket, err := listenSocket("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	addr := socket.ln.Addr().String()
+
+	first := socket.attach(nil, nil)
+	client1, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client1.Close()
+	server1 := acceptTimeout(t, first)
+	defer server1.Close()
+
+	// 新的监听接管端口后，原监听停止接收，已有连接不受影响
+	second := socket.attach(nil, nil)
+	if _, err := first.Accept(); err != errListenerClosed {
+		t.Fatal("previous listener should be closed:", err)
+	}
+
+	client2, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client2.Close()
+	server2 := acceptTimeout(t, second)
+	defer server2.Close()
+
+	buf := make([]byte, 5)
+	client1.Write([]byte("hello"))
+	if _, err := io.ReadFull(server1, buf); err != nil || string(buf) != "hello" {
+		t.Fatal("existing connection:", string(buf), err)
+	}
+
+	// 关闭后不再接收新连接
+	socket.Close()
+	if _, err := second.Accept(); err != errListenerClosed {
+		t.Fatal("listener should be closed:", err)
+	}
+	if _, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		t.Fatal("socket should be closed")
+	}
+	client1.Write([]byte("world"))
+	if _, err := io.ReadFull(server1, buf); err != nil || string(buf) != "world" {
+		t.Fatal("existing connection after close:", string(buf), err)
+	}
+}
+
+func TestGroupRoutes(t *testing.T) {
+	routes := []Route{
+		{Address: ":80", Target: "a:80"},
+		{Address: ":443", Target: "b:443"},
+		{Address: ":80", Target: "c:80"},
+		{Address: ":8080"},
+	}
+	addresses, groups := groupRoutes(routes)
+	if len(addresses) != 2 || addresses[0] != ":80" || addresses[1] != ":443" {
+		t.Fatal("addresses:", addresses)
+	}
+	if len(groups[":80"]) != 2 || groups[":80"][1].Target != "c:80" {
+		t.Fatal("groups:", groups)
+	}
+}
@@ -0,0 +1,393 @@
+package gproxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"github.com/csby/gwsf/gtype"
+	"github.com/csby/tcpproxy"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// HostRegexPrefix 正则表达式域名的前缀，如"~^api-[0-9]+\.example\.com$"
+	HostRegexPrefix = "~"
+	// HostWildcardPrefix 通配符域名的前缀，如"*.example.com"匹配其所有子域名(不包括example.com)
+	HostWildcardPrefix = "*."
+)
+
+// 域名匹配方式，数值越大越优先
+const (
+	hostAny = iota
+	hostRegex
+	hostWildcard
+	hostExact
+)
+
+// routeMatcher 路由的匹配条件: 域名、路径前缀、来源地址及TLS ALPN；
+// 多个路由匹配时: 精确域名 > 通配符域名(后缀最长的) > 正则表达式(先配置的) > 不限域名，
+// 其次路径前缀最长的、来源地址网段最小的、指定ALPN的优先，都相同时先配置的优先
+type routeMatcher struct {
+	index int
+	host  string
+	kind  int
+	regex *regexp.Regexp
+	path  string
+
+	sources []*net.IPNet
+	alpn    []string
+}
+
+func newRouteMatcher(index int, route Route) (*routeMatcher, error) {
+	s := &routeMatcher{
+		index: index,
+		path:  route.Path,
+	}
+
+	domain := strings.TrimSpace(route.Domain)
+	switch {
+	case len(domain) < 1:
+		s.kind = hostAny
+	case strings.HasPrefix(domain, HostRegexPrefix):
+		regex, err := regexp.Compile("(?i)" + domain[len(HostRegexPrefix):])
+		if err != nil {
+			return nil, fmt.Errorf("invalid domain regex '%s': %v", domain, err)
+		}
+		s.kind = hostRegex
+		s.regex = regex
+	case strings.HasPrefix(domain, HostWildcardPrefix):
+		s.kind = hostWildcard
+		s.host = strings.ToLower(domain[1:])
+	default:
+		s.kind = hostExact
+		s.host = strings.ToLower(domain)
+	}
+
+	for _, v := range route.Sources {
+		if len(strings.TrimSpace(v)) < 1 {
+			continue
+		}
+		nets := ParseCIDRs([]string{v})
+		if len(nets) < 1 {
+			return nil, fmt.Errorf("invalid source '%s'", v)
+		}
+		s.sources = append(s.sources, nets[0])
+	}
+	for _, v := range route.Alpn {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			s.alpn = append(s.alpn, v)
+		}
+	}
+
+	return s, nil
+}
+
+// CheckRouteMatch 检查路由的域名(正则表达式)及来源地址是否有效
+func CheckRouteMatch(domain string, sources []string) error {
+	_, err := newRouteMatcher(0, Route{Domain: domain, Sources: sources})
+
+	return err
+}
+
+// matchRequest 传入连接(或请求)的匹配信息
+type matchRequest struct {
+	host string
+	path string
+	ip   net.IP
+	alpn []string
+}
+
+// routeScore 匹配的优先级，按字段顺序比较
+type routeScore struct {
+	kind   int
+	suffix int
+	path   int
+	source int
+	alpn   int
+	index  int
+}
+
+func (s *routeScore) better(v *routeScore) bool {
+	if s.kind != v.kind {
+		return s.kind > v.kind
+	}
+	if s.suffix != v.suffix {
+		return s.suffix > v.suffix
+	}
+	if s.kind == hostRegex && s.index != v.index {
+		return s.index < v.index
+	}
+	if s.path != v.path {
+		return s.path > v.path
+	}
+	if s.source != v.source {
+		return s.source > v.source
+	}
+	if s.alpn != v.alpn {
+		return s.alpn > v.alpn
+	}
+
+	return s.index < v.index
+}
+
+// matchHost 域名是否匹配，不限域名的路由匹配所有域名
+func (s *routeMatcher) matchHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	switch s.kind {
+	case hostExact:
+		return host == s.host
+	case hostWildcard:
+		return strings.HasSuffix(host, s.host) && len(host) > len(s.host)
+	case hostRegex:
+		return s.regex.MatchString(host)
+	}
+
+	return true
+}
+
+// match 不匹配时返回false
+func (s *routeMatcher) match(req *matchRequest) (*routeScore, bool) {
+	score := &routeScore{
+		kind:   s.kind,
+		source: -1,
+		index:  s.index,
+	}
+	if !s.matchHost(req.host) {
+		return nil, false
+	}
+	if s.kind == hostWildcard {
+		score.suffix = len(s.host)
+	}
+
+	if len(s.path) > 0 {
+		if !strings.HasPrefix(req.path, s.path) {
+			return nil, false
+		}
+		score.path = len(s.path)
+	}
+
+	if len(s.sources) > 0 {
+		if req.ip == nil {
+			return nil, false
+		}
+		for _, v := range s.sources {
+			if !v.Contains(req.ip) {
+				continue
+			}
+			if ones, _ := v.Mask.Size(); ones > score.source {
+				score.source = ones
+			}
+		}
+		if score.source < 0 {
+			return nil, false
+		}
+	}
+
+	if len(s.alpn) > 0 {
+		for _, v := range s.alpn {
+			for _, p := range req.alpn {
+				if v == p {
+					score.alpn = 1
+				}
+			}
+		}
+		if score.alpn < 1 {
+			return nil, false
+		}
+	}
+
+	return score, true
+}
+
+// selectRoute 返回最优先匹配的路由序号，没有匹配的路由时返回-1
+func selectRoute(matchers []*routeMatcher, req *matchRequest) int {
+	selected := -1
+	var best *routeScore = nil
+	for i, matcher := range matchers {
+		score, ok := matcher.match(req)
+		if !ok {
+			continue
+		}
+		if best == nil || score.better(best) {
+			selected = i
+			best = score
+		}
+	}
+
+	return selected
+}
+
+// routeDispatcher 监听地址(tcp)的路由分发，tcpproxy读取SNI或Host后，
+// 按域名、路径、来源地址及ALPN选择路由的目标
+type routeDispatcher struct {
+	matchers []*routeMatcher
+	targets  []*TargetProxy
+
+	// TLS透传(SNI)时从ClientHello中读取客户端提供的ALPN，否则读取HTTP请求路径
+	sni bool
+
+	onRejected func(link *Link)
+}
+
+func (s *routeDispatcher) add(matcher *routeMatcher, target *TargetProxy) {
+	s.matchers = append(s.matchers, matcher)
+	s.targets = append(s.targets, target)
+}
+
+// hasHost 是否有指定域名的路由
+func (s *routeDispatcher) hasHost() bool {
+	for _, matcher := range s.matchers {
+		if matcher.kind != hostAny {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchHost 供tcpproxy匹配SNI或Host，有路由的域名匹配时返回true
+func (s *routeDispatcher) matchHost(ctx context.Context, host string) bool {
+	for _, matcher := range s.matchers {
+		if matcher.matchHost(host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HandleConn implements the tcpproxy.Target interface.
+func (s *routeDispatcher) HandleConn(src net.Conn, listenAddress, hostName string) {
+	req := &matchRequest{
+		host: hostName,
+		ip:   net.ParseIP(sourceIP(src)),
+	}
+	var peeked []byte = nil
+	if c, ok := src.(*tcpproxy.Conn); ok {
+		peeked = c.Peeked
+	}
+	if tc, ok := UnderlyingConn(src).(*tls.Conn); ok {
+		if p := tc.ConnectionState().NegotiatedProtocol; len(p) > 0 {
+			req.alpn = []string{p}
+		}
+	}
+	if s.sni {
+		req.alpn = clientHelloAlpn(peeked)
+	} else {
+		req.path = httpRequestPath(peeked)
+	}
+
+	index := selectRoute(s.matchers, req)
+	if index < 0 {
+		s.reject(src, listenAddress, hostName)
+		return
+	}
+
+	s.targets[index].HandleConn(src, listenAddress, hostName)
+}
+
+func (s *routeDispatcher) reject(src net.Conn, listenAddress, hostName string) {
+	src.Close()
+	if s.onRejected != nil {
+		go s.onRejected(&Link{
+			Id:          newGuid(),
+			Time:        gtype.DateTime(time.Now()),
+			Protocol:    ProtocolTcp,
+			ListenAddr:  listenAddress,
+			Domain:      hostName,
+			SourceAddr:  src.RemoteAddr().String(),
+			Status:      1,
+			CloseReason: "rejected: no route matched",
+		})
+	}
+}
+
+// httpRequestPath 从HTTP请求行(如"GET /path?a=1 HTTP/1.1")中读取路径
+func httpRequestPath(data []byte) string {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[:i]
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return ""
+	}
+	path := fields[1]
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+
+	return path
+}
+
+// clientHelloAlpn 从TLS ClientHello记录中读取客户端提供的ALPN协议列表
+func clientHelloAlpn(data []byte) []string {
+	// 记录头部(5) + 握手头部(4)
+	if len(data) < 9 || data[0] != 0x16 || data[5] != 0x01 {
+		return nil
+	}
+	data = data[9:]
+	// 版本(2) + 随机数(32)
+	if len(data) < 34 {
+		return nil
+	}
+	data = data[34:]
+
+	skip := func(lenSize int) bool {
+		if len(data) < lenSize {
+			return false
+		}
+		n := 0
+		for i := 0; i < lenSize; i++ {
+			n = n<<8 | int(data[i])
+		}
+		if len(data) < lenSize+n {
+			return false
+		}
+		data = data[lenSize+n:]
+		return true
+	}
+	// 会话ID、加密套件、压缩方法
+	if !skip(1) || !skip(2) || !skip(1) {
+		return nil
+	}
+	if len(data) < 2 {
+		return nil
+	}
+	extensions := data[2:]
+	if n := int(binary.BigEndian.Uint16(data)); n < len(extensions) {
+		extensions = extensions[:n]
+	}
+
+	for len(extensions) >= 4 {
+		typ := binary.BigEndian.Uint16(extensions)
+		n := int(binary.BigEndian.Uint16(extensions[2:]))
+		if len(extensions) < 4+n {
+			return nil
+		}
+		ext := extensions[4 : 4+n]
+		extensions = extensions[4+n:]
+		// application_layer_protocol_negotiation
+		if typ != 16 || len(ext) < 2 {
+			continue
+		}
+
+		protocols := make([]string, 0)
+		list := ext[2:]
+		for len(list) > 0 {
+			l := int(list[0])
+			if len(list) < 1+l {
+				break
+			}
+			protocols = append(protocols, string(list[1:1+l]))
+			list = list[1+l:]
+		}
+		return protocols
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package gproxy
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+func TestSelectRoute(t *testing.T) {
+	routes := []Route{
+		{Domain: ""},
+		{Domain: "~^shop-[0-9]+\\.test\\.com$"},
+		{Domain: "*.test.com"},
+		{Domain: "*.api.test.com"},
+		{Domain: "www.test.com"},
+		{Domain: "*.test.com", Path: "/admin"},
+		{Domain: "*.test.com", Sources: []string{"10.0.0.0/8"}},
+		{Domain: "*.test.com", Sources: []string{"10.1.0.0/16"}},
+		{Domain: "~^shop-1\\.test\\.com$"},
+		{Domain: "h2.test.com", Alpn: []string{"h2"}},
+	}
+	matchers := make([]*routeMatcher, 0)
+	for i, route := range routes {
+		matcher, err := newRouteMatcher(i, route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matchers = append(matchers, matcher)
+	}
+
+	tests := []struct {
+		req    matchRequest
+		expect int
+	}{
+		{matchRequest{host: "other.com"}, 0},
+		{matchRequest{host: "WWW.test.com"}, 4},
+		{matchRequest{host: "a.test.com"}, 2},
+		{matchRequest{host: "test.com"}, 0},
+		{matchRequest{host: "v1.api.test.com"}, 3},
+		{matchRequest{host: "a.test.com", path: "/admin/user"}, 5},
+		{matchRequest{host: "a.test.com", ip: net.ParseIP("10.2.0.1")}, 6},
+		{matchRequest{host: "a.test.com", ip: net.ParseIP("10.1.0.1")}, 7},
+		// 通配符优先于正则表达式，正则表达式按配置顺序
+		{matchRequest{host: "shop-1.test.com"}, 2},
+		{matchRequest{host: "h2.test.com"}, 2},
+		{matchRequest{host: "h2.test.com", alpn: []string{"http/1.1", "h2"}}, 9},
+	}
+	for _, test := range tests {
+		if index := selectRoute(matchers, &test.req); index != test.expect {
+			t.Error(test.req.host, test.req.path, test.req.ip, test.req.alpn, ": expect", test.expect, "but", index)
+		}
+	}
+
+	// 只有正则表达式时按配置顺序
+	regexes := []*routeMatcher{matchers[1], matchers[8]}
+	if index := selectRoute(regexes, &matchRequest{host: "shop-1.test.com"}); index != 0 {
+		t.Error("regex order:", index)
+	}
+	if index := selectRoute(matchers[1:2], &matchRequest{host: "other.com"}); index != -1 {
+		t.Error("no match:", index)
+	}
+
+	if _, err := newRouteMatcher(0, Route{Domain: "~("}); err == nil {
+		t.Error("invalid regex should fail")
+	}
+	if _, err := newRouteMatcher(0, Route{Sources: []string{"10.0.0"}}); err == nil {
+		t.Error("invalid source should fail")
+	}
+}
+
+func TestClientHelloAlpn(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		tls.Client(client, &tls.Config{
+			ServerName: "test.com",
+			NextProtos: []string{"h2", "http/1.1"},
+		}).Handshake()
+	}()
+
+	buf := make([]byte, 16*1024)
+	n := 0
+	// 读取完整的TLS记录: 头部(5) + 长度
+	for n < 5 || n < 5+(int(buf[3])<<8|int(buf[4])) {
+		c, err := server.Read(buf[n:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += c
+	}
+	client.Close()
+
+	protocols := clientHelloAlpn(buf[:n])
+	if len(protocols) != 2 || protocols[0] != "h2" || protocols[1] != "http/1.1" {
+		t.Fatal("alpn:", protocols)
+	}
+	if clientHelloAlpn([]byte("GET / HTTP/1.1\r\n")) != nil {
+		t.Fatal("alpn of non-TLS data should be nil")
+	}
+}
+
+func TestHttpRequestPath(t *testing.T) {
+	if v := httpRequestPath([]byte("GET /api/user?id=1 HTTP/1.1\r\nHost: test.com\r\n\r\n")); v != "/api/user" {
+		t.Fatal("path:", v)
+	}
+	if v := httpRequestPath(nil); v != "" {
+		t.Fatal("path:", v)
+	}
+}
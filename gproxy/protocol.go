@@ -0,0 +1,452 @@
+package gproxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PROXY协议v2签名
+var proxyProtocolV2Signature = []byte("\x0D\x0A\x0D\x0A\x00\x0D\x0A\x51\x55\x49\x54\x0A")
+
+const (
+	proxyProtocolV2CmdLocal = 0x20
+	proxyProtocolV2CmdProxy = 0x21
+
+	proxyProtocolV2FamUnspec = 0x00
+	proxyProtocolV2FamTcp4   = 0x11
+	proxyProtocolV2FamUdp4   = 0x12
+	proxyProtocolV2FamTcp6   = 0x21
+	proxyProtocolV2FamUdp6   = 0x22
+
+	proxyProtocolV2TypeAuthority = 0x02
+
+	// v1头部最大长度(包括CRLF)
+	proxyProtocolV1MaxLength = 107
+)
+
+// writeProxyHeaderV2 写入PROXY协议v2头部
+// authority: 非空时添加PP2_TYPE_AUTHORITY(如SNI或Host)
+func writeProxyHeaderV2(w io.Writer, srcAddr, dstAddr net.Addr, authority string) error {
+	buf := &bytes.Buffer{}
+	buf.Write(proxyProtocolV2Signature)
+
+	srcIP, srcPort, srcUdp := splitAddr(srcAddr)
+	dstIP, dstPort, _ := splitAddr(dstAddr)
+	if srcIP == nil || dstIP == nil {
+		buf.WriteByte(proxyProtocolV2CmdLocal)
+		buf.WriteByte(proxyProtocolV2FamUnspec)
+		binary.Write(buf, binary.BigEndian, uint16(0))
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+
+	addr := &bytes.Buffer{}
+	fam := byte(proxyProtocolV2FamTcp4)
+	if srcIP.To4() != nil && dstIP.To4() != nil {
+		if srcUdp {
+			fam = proxyProtocolV2FamUdp4
+		}
+		addr.Write(srcIP.To4())
+		addr.Write(dstIP.To4())
+	} else {
+		fam = proxyProtocolV2FamTcp6
+		if srcUdp {
+			fam = proxyProtocolV2FamUdp6
+		}
+		addr.Write(srcIP.To16())
+		addr.Write(dstIP.To16())
+	}
+	binary.Write(addr, binary.BigEndian, uint16(srcPort))
+	binary.Write(addr, binary.BigEndian, uint16(dstPort))
+
+	if len(authority) > 0 && len(authority) <= 0xffff {
+		addr.WriteByte(proxyProtocolV2TypeAuthority)
+		binary.Write(addr, binary.BigEndian, uint16(len(authority)))
+		addr.WriteString(authority)
+	}
+
+	buf.WriteByte(proxyProtocolV2CmdProxy)
+	buf.WriteByte(fam)
+	binary.Write(buf, binary.BigEndian, uint16(addr.Len()))
+	buf.Write(addr.Bytes())
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func splitAddr(addr net.Addr) (net.IP, int, bool) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP, a.Port, false
+	case *net.UDPAddr:
+		return a.IP, a.Port, true
+	default:
+		return nil, 0, false
+	}
+}
+
+// ProxyProtocolListener 接收连接时解析并去除PROXY协议头部(v1或v2)，
+// 连接的RemoteAddr和LocalAddr为头部中的原始地址
+type ProxyProtocolListener struct {
+	net.Listener
+
+	// 读取头部的超时时间，小于等于0时为5秒
+	HeaderTimeout time.Duration
+
+	// 可信的来源地址，只解析来自可信地址连接的头部，为空时不信任任何来源
+	trustedNets []*net.IPNet
+}
+
+// NewProxyProtocolListener 创建PROXY协议监听，trusted为可信的来源地址(IP或CIDR)，
+// 包含无效的IP或CIDR时返回错误；timeout为读取头部的超时时间，小于等于0时为5秒
+func NewProxyProtocolListener(ln net.Listener, trusted []string, timeout time.Duration) (*ProxyProtocolListener, error) {
+	nets, err := ParseCIDRList(trusted)
+	if err != nil {
+		return nil, err
+	}
+
+	instance := &ProxyProtocolListener{
+		Listener:      ln,
+		HeaderTimeout: timeout,
+		trustedNets:   nets,
+	}
+
+	return instance, nil
+}
+
+func (s *ProxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := s.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.wrap(conn), nil
+}
+
+func (s *ProxyProtocolListener) wrap(conn net.Conn) net.Conn {
+	if !ContainsIP(s.trustedNets, conn.RemoteAddr()) {
+		return conn
+	}
+
+	return NewProxyProtocolConn(conn, s.HeaderTimeout)
+}
+
+// NewProxyProtocolConn 创建解析PROXY协议头部的连接(不检查来源地址)，
+// timeout为读取头部的超时时间，小于等于0时为5秒
+func NewProxyProtocolConn(conn net.Conn, timeout time.Duration) *ProxyProtocolConn {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	return &ProxyProtocolConn{
+		Conn:    conn,
+		reader:  bufio.NewReader(conn),
+		timeout: timeout,
+	}
+}
+
+// ProxyProtocolConn 首次读取或获取地址时解析PROXY协议头部
+type ProxyProtocolConn struct {
+	net.Conn
+
+	reader    *bufio.Reader
+	timeout   time.Duration
+	once      sync.Once
+	err       error
+	srcAddr   net.Addr
+	dstAddr   net.Addr
+	authority string
+}
+
+func (s *ProxyProtocolConn) Read(b []byte) (int, error) {
+	s.once.Do(s.readHeader)
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	return s.reader.Read(b)
+}
+
+func (s *ProxyProtocolConn) RemoteAddr() net.Addr {
+	s.once.Do(s.readHeader)
+	if s.srcAddr != nil {
+		return s.srcAddr
+	}
+
+	return s.Conn.RemoteAddr()
+}
+
+func (s *ProxyProtocolConn) LocalAddr() net.Addr {
+	s.once.Do(s.readHeader)
+	if s.dstAddr != nil {
+		return s.dstAddr
+	}
+
+	return s.Conn.LocalAddr()
+}
+
+// Authority 头部中的PP2_TYPE_AUTHORITY(仅v2)
+func (s *ProxyProtocolConn) Authority() string {
+	s.once.Do(s.readHeader)
+	return s.authority
+}
+
+// HeaderError 解析头部时的错误
+func (s *ProxyProtocolConn) HeaderError() error {
+	s.once.Do(s.readHeader)
+	return s.err
+}
+
+// readHeader 等待头部直至超时: 可信的代理总是先发送头部，
+// 因此来自可信地址但不发送头部、且由服务端先发送数据的连接(如SMTP、FTP)在超时后读取失败
+func (s *ProxyProtocolConn) readHeader() {
+	s.Conn.SetReadDeadline(time.Now().Add(s.timeout))
+	defer s.Conn.SetReadDeadline(time.Time{})
+
+	// 头部至少为"PROXY "(v1)或16字节(v2)，不足时视为没有头部
+	peek, err := s.reader.Peek(6)
+	if err != nil {
+		if len(peek) > 0 || err == io.EOF {
+			return
+		}
+		s.err = err
+		return
+	}
+
+	if string(peek) == "PROXY " {
+		s.err = s.readHeaderV1()
+		return
+	}
+
+	if peek[0] != proxyProtocolV2Signature[0] {
+		return
+	}
+	peek, err = s.reader.Peek(len(proxyProtocolV2Signature))
+	if err != nil {
+		return
+	}
+	if bytes.Equal(peek, proxyProtocolV2Signature) {
+		s.err = s.readHeaderV2()
+	}
+}
+
+func (s *ProxyProtocolConn) readHeaderV1() error {
+	line := &strings.Builder{}
+	for {
+		b, err := s.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == '\n' {
+			break
+		}
+		line.WriteByte(b)
+		if line.Len() >= proxyProtocolV1MaxLength {
+			return fmt.Errorf("PROXY protocol v1 header too long")
+		}
+	}
+
+	// PROXY TCP4 srcIP dstIP srcPort dstPort
+	fields := strings.Fields(strings.TrimRight(line.String(), "\r"))
+	if len(fields) < 2 {
+		return fmt.Errorf("invalid PROXY protocol v1 header: %s", line.String())
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil
+	}
+	if len(fields) != 6 {
+		return fmt.Errorf("invalid PROXY protocol v1 header: %s", line.String())
+	}
+
+	srcIP, dstIP := fields[2], fields[3]
+	srcPort, dstPort := fields[4], fields[5]
+
+	src, err := newTCPAddr(srcIP, srcPort)
+	if err != nil {
+		return err
+	}
+	dst, err := newTCPAddr(dstIP, dstPort)
+	if err != nil {
+		return err
+	}
+	s.srcAddr, s.dstAddr = src, dst
+
+	return nil
+}
+
+func (s *ProxyProtocolConn) readHeaderV2() error {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(s.reader, header); err != nil {
+		return err
+	}
+	if header[12]&0xf0 != 0x20 {
+		return fmt.Errorf("PROXY protocol version %d not supported", header[12]>>4)
+	}
+
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+	data := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, data); err != nil {
+		return err
+	}
+	if header[12] == proxyProtocolV2CmdLocal {
+		return nil
+	}
+
+	var ipLength int
+	udp := false
+	switch header[13] {
+	case proxyProtocolV2FamTcp4:
+		ipLength = net.IPv4len
+	case proxyProtocolV2FamUdp4:
+		ipLength = net.IPv4len
+		udp = true
+	case proxyProtocolV2FamTcp6:
+		ipLength = net.IPv6len
+	case proxyProtocolV2FamUdp6:
+		ipLength = net.IPv6len
+		udp = true
+	default:
+		return nil
+	}
+	addrLength := 2*ipLength + 4
+	if length < addrLength {
+		return fmt.Errorf("invalid PROXY protocol v2 address length: %d", length)
+	}
+
+	srcIP := net.IP(data[0:ipLength])
+	dstIP := net.IP(data[ipLength : 2*ipLength])
+	srcPort := int(binary.BigEndian.Uint16(data[2*ipLength:]))
+	dstPort := int(binary.BigEndian.Uint16(data[2*ipLength+2:]))
+	if udp {
+		s.srcAddr = &net.UDPAddr{IP: srcIP, Port: srcPort}
+		s.dstAddr = &net.UDPAddr{IP: dstIP, Port: dstPort}
+	} else {
+		s.srcAddr = &net.TCPAddr{IP: srcIP, Port: srcPort}
+		s.dstAddr = &net.TCPAddr{IP: dstIP, Port: dstPort}
+	}
+
+	tlv := data[addrLength:]
+	for len(tlv) >= 3 {
+		l := int(binary.BigEndian.Uint16(tlv[1:3]))
+		if len(tlv) < 3+l {
+			break
+		}
+		if tlv[0] == proxyProtocolV2TypeAuthority {
+			s.authority = string(tlv[3 : 3+l])
+		}
+		tlv = tlv[3+l:]
+	}
+
+	return nil
+}
+
+func newTCPAddr(ip, port string) (*net.TCPAddr, error) {
+	addr := &net.TCPAddr{IP: net.ParseIP(ip)}
+	if addr.IP == nil {
+		return nil, fmt.Errorf("invalid ip address: %s", ip)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port: %s", port)
+	}
+	addr.Port = int(p)
+
+	return addr, nil
+}
+
+// ParseCIDRs 解析IP或CIDR列表，忽略无效项
+func ParseCIDRs(vs []string) []*net.IPNet {
+	items := make([]*net.IPNet, 0)
+	c := len(vs)
+	for i := 0; i < c; i++ {
+		item, err := parseCIDR(vs[i])
+		if err != nil || item == nil {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	return items
+}
+
+// ParseCIDRList 解析IP或CIDR列表，忽略空项，包含无效项时返回错误
+func ParseCIDRList(vs []string) ([]*net.IPNet, error) {
+	items := make([]*net.IPNet, 0)
+	c := len(vs)
+	for i := 0; i < c; i++ {
+		item, err := parseCIDR(vs[i])
+		if err != nil {
+			return nil, err
+		}
+		if item == nil {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// parseCIDR 解析IP或CIDR，空时返回nil
+func parseCIDR(v string) (*net.IPNet, error) {
+	v = strings.TrimSpace(v)
+	if len(v) < 1 {
+		return nil, nil
+	}
+	if !strings.Contains(v, "/") {
+		ip := net.ParseIP(v)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip address: %s", v)
+		}
+		if ip.To4() != nil {
+			v = v + "/32"
+		} else {
+			v = v + "/128"
+		}
+	}
+
+	_, item, err := net.ParseCIDR(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cidr: %s", v)
+	}
+
+	return item, nil
+}
+
+// ContainsIP 地址是否位于网段列表中
+func ContainsIP(nets []*net.IPNet, addr net.Addr) bool {
+	var ip net.IP = nil
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	default:
+		if addr != nil {
+			host, _, err := net.SplitHostPort(addr.String())
+			if err == nil {
+				ip = net.ParseIP(host)
+			}
+		}
+	}
+	if ip == nil {
+		return false
+	}
+
+	c := len(nets)
+	for i := 0; i < c; i++ {
+		if nets[i].Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
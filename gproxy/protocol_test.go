@@ -0,0 +1,180 @@
+package gproxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestProxyProtocolConn(header func(w io.Writer) error, payload string) *ProxyProtocolConn {
+	client, server := net.Pipe()
+	go func() {
+		defer client.Close()
+		if err := header(client); err != nil {
+			return
+		}
+		client.Write([]byte(payload))
+	}()
+
+	return &ProxyProtocolConn{
+		Conn:    server,
+		reader:  bufio.NewReader(server),
+		timeout: time.Second,
+	}
+}
+
+func TestProxyProtocolConn_V2(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("10.3.2.18"), Port: 25312}
+	dst := &net.TCPAddr{IP: net.ParseIP("192.168.1.6"), Port: 443}
+	conn := newTestProxyProtocolConn(func(w io.Writer) error {
+		return writeProxyHeaderV2(w, src, dst, "test.com")
+	}, "hello")
+
+	if conn.RemoteAddr().String() != src.String() {
+		t.Fatal("remote address:", conn.RemoteAddr())
+	}
+	if conn.LocalAddr().String() != dst.String() {
+		t.Fatal("local address:", conn.LocalAddr())
+	}
+	if conn.Authority() != "test.com" {
+		t.Fatal("authority:", conn.Authority())
+	}
+	data, err := ioutil.ReadAll(conn)
+	if err != nil || string(data) != "hello" {
+		t.Fatal("payload:", string(data), err)
+	}
+}
+
+func TestProxyProtocolConn_V1(t *testing.T) {
+	conn := newTestProxyProtocolConn(func(w io.Writer) error {
+		_, err := io.WriteString(w, "PROXY TCP4 10.3.2.18 192.168.1.6 25312 443\r\n")
+		return err
+	}, "hello")
+
+	if conn.RemoteAddr().String() != "10.3.2.18:25312" {
+		t.Fatal("remote address:", conn.RemoteAddr())
+	}
+	if conn.LocalAddr().String() != "192.168.1.6:443" {
+		t.Fatal("local address:", conn.LocalAddr())
+	}
+	data, err := ioutil.ReadAll(conn)
+	if err != nil || string(data) != "hello" {
+		t.Fatal("payload:", string(data), err)
+	}
+}
+
+func TestProxyProtocolConn_V1RoundTrip(t *testing.T) {
+	src := &testAddrConn{
+		remote: &net.TCPAddr{IP: net.ParseIP("10.3.2.18"), Port: 25312},
+		local:  &net.TCPAddr{IP: net.ParseIP("192.168.1.6"), Port: 443},
+	}
+	dp := &TargetProxy{ProxyProtocolVersion: 1}
+
+	header := &bytes.Buffer{}
+	if err := dp.sendProxyHeader(header, src, ""); err != nil {
+		t.Fatal(err)
+	}
+	if header.String() != "PROXY TCP4 10.3.2.18 192.168.1.6 25312 443\r\n" {
+		t.Fatalf("header: %q", header.String())
+	}
+
+	conn := newTestProxyProtocolConn(func(w io.Writer) error {
+		_, err := w.Write(header.Bytes())
+		return err
+	}, "hello")
+	if conn.RemoteAddr().String() != src.remote.String() {
+		t.Fatal("remote address:", conn.RemoteAddr())
+	}
+	if conn.LocalAddr().String() != src.local.String() {
+		t.Fatal("local address:", conn.LocalAddr())
+	}
+}
+
+func TestProxyProtocolListener_Trusted(t *testing.T) {
+	peer := &testAddrConn{
+		remote: &net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 5000},
+	}
+
+	ln, err := NewProxyProtocolListener(nil, []string{"10.0.0.0/8", "192.168.1.1"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ln.wrap(peer).(*ProxyProtocolConn); !ok {
+		t.Fatal("header of trusted peer should be parsed")
+	}
+
+	untrusted := &testAddrConn{
+		remote: &net.TCPAddr{IP: net.ParseIP("172.16.1.1"), Port: 5000},
+	}
+	if _, ok := ln.wrap(untrusted).(*ProxyProtocolConn); ok {
+		t.Fatal("header of untrusted peer should not be parsed")
+	}
+
+	// 为空时不信任任何来源
+	ln, err = NewProxyProtocolListener(nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ln.wrap(peer).(*ProxyProtocolConn); ok {
+		t.Fatal("header should not be parsed without trusted proxies")
+	}
+	literal := &ProxyProtocolListener{}
+	if _, ok := literal.wrap(peer).(*ProxyProtocolConn); ok {
+		t.Fatal("header should not be parsed without trusted proxies")
+	}
+
+	// 包含无效项时返回错误
+	_, err = NewProxyProtocolListener(nil, []string{"10.0.0.0/8", "10.0.0.0/33"}, 0)
+	if err == nil {
+		t.Fatal("invalid cidr should be rejected")
+	}
+}
+
+func TestProxyProtocolListener_HeaderTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	peer := &testAddrConn{
+		Conn:   server,
+		remote: &net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 5000},
+	}
+
+	ln, err := NewProxyProtocolListener(nil, []string{"10.0.0.0/8"}, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := ln.wrap(peer)
+
+	// 可信地址的连接未发送头部时等待至超时
+	start := time.Now()
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("read should fail without header")
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Fatal("header timeout:", elapsed)
+	}
+}
+
+type testAddrConn struct {
+	net.Conn
+
+	remote net.Addr
+	local  net.Addr
+}
+
+func (s *testAddrConn) RemoteAddr() net.Addr { return s.remote }
+func (s *testAddrConn) LocalAddr() net.Addr  { return s.local }
+
+func TestProxyProtocolConn_None(t *testing.T) {
+	conn := newTestProxyProtocolConn(func(w io.Writer) error {
+		return nil
+	}, "GET / HTTP/1.1\r\n\r\n")
+
+	data, err := ioutil.ReadAll(conn)
+	if err != nil || string(data) != "GET / HTTP/1.1\r\n\r\n" {
+		t.Fatal("payload:", string(data), err)
+	}
+}
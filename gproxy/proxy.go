@@ -3,7 +3,9 @@ package gproxy
 import (
 	"context"
 	"crypto/rand"
+	"crypto/tls"
 	"fmt"
+	"github.com/csby/gwsf/gtype"
 	"github.com/csby/tcpproxy"
 	"io"
 	"log"
@@ -14,7 +16,7 @@ import (
 type TargetProxy struct {
 	// Addr is the TCP address to proxy to.
 	//Addr    string
-	Address TargetAddress
+	Address *TargetAddress
 
 	// KeepAlivePeriod sets the period between TCP keep alives.
 	// If zero, a default is used. To disable, use a negative number.
@@ -42,25 +44,60 @@ type TargetProxy struct {
 	// inserted ahead of the client's traffic. The DialProxy target
 	// must explicitly support and expect the PROXY header; there is
 	// no graceful downgrade.
-	// If zero, no PROXY header is sent. Currently, version 1 is supported.
+	// If zero, no PROXY header is sent. Currently, version 1 and 2 are supported.
+	// Version 2 carries the hostName (SNI or HTTP Host) as PP2_TYPE_AUTHORITY.
 	ProxyProtocolVersion int
 
-	OnConnected    func(id, addr, domain, source, target string)
-	OnDisconnected func(id, addr, domain, source, target string)
+	// TargetTls optionally specifies the TLS configuration to
+	// re-encrypt the connection to the target, after the PROXY header.
+	// If ServerName is empty, the hostName of the incoming conn is used.
+	TargetTls *tls.Config
+
+	OnConnected    func(link *Link)
+	OnDisconnected func(link *Link)
+
+	// OnRejected optionally reports the incoming conn rejected
+	// by the access control, with the reason as CloseReason.
+	OnRejected func(link *Link)
+
+	// traffics optionally accumulates the bytes of each connection
+	// into the totals of its server and target.
+	traffics *trafficCollection
+
+	// connections optionally tracks the active connections
+	// so that they can be drained or force-closed on stop.
+	connections *connectionCollection
+
+	// access checks the source address of the incoming conn
+	// in order (server, target) before dialing.
+	access []*accessControl
+
+	// bandwidth optionally throttles the copy loop of each
+	// connection (server, target, and per source IP).
+	bandwidth []*bandwidthControl
 }
 
 // HandleConn implements the Target interface.
 func (dp *TargetProxy) HandleConn(src net.Conn, listenAddress, hostName string) {
+	for _, access := range dp.access {
+		release, reason := access.acquire(src.RemoteAddr())
+		if len(reason) > 0 {
+			dp.reject(src, listenAddress, hostName, reason)
+			return
+		}
+		defer release()
+	}
+	limits := &throttle{}
+	for _, bandwidth := range dp.bandwidth {
+		defer bandwidth.acquire(src.RemoteAddr(), limits)()
+	}
+
 	ctx := context.Background()
 	var cancel context.CancelFunc
 	if dp.DialTimeout >= 0 {
 		ctx, cancel = context.WithTimeout(ctx, dp.dialTimeout())
 	}
-	addr := dp.Address.GetAddress()
-	addr.IncreaseCount()
-	defer addr.DecreaseCount()
-
-	dst, err := dp.dialContext()(ctx, "tcp", addr.Addr)
+	dst, addr, err := dp.dial(ctx, sourceIP(src))
 	if cancel != nil {
 		cancel()
 	}
@@ -68,16 +105,17 @@ func (dp *TargetProxy) HandleConn(src net.Conn, listenAddress, hostName string)
 		dp.onDialError()(src, addr.Addr, err)
 		return
 	}
+	defer addr.DecreaseCount()
 	defer goCloseConn(dst)
 
-	if err = dp.sendProxyHeader(dst, src); err != nil {
+	if err = dp.sendProxyHeader(dst, src, hostName); err != nil {
 		dp.onDialError()(src, addr.Addr, err)
 		return
 	}
 	defer goCloseConn(src)
 
 	if ka := dp.keepAlivePeriod(); ka > 0 {
-		if c, ok := UnderlyingConn(src).(*net.TCPConn); ok {
+		if c, ok := tcpConn(src).(*net.TCPConn); ok {
 			c.SetKeepAlive(true)
 			c.SetKeepAlivePeriod(ka)
 		}
@@ -87,20 +125,107 @@ func (dp *TargetProxy) HandleConn(src net.Conn, listenAddress, hostName string)
 		}
 	}
 
-	id := newGuid()
-	srcAddr := src.RemoteAddr().String()
-	dstAddr := dst.RemoteAddr().String()
+	if dp.TargetTls != nil {
+		cfg := dp.TargetTls
+		if len(cfg.ServerName) < 1 {
+			cfg = cfg.Clone()
+			cfg.ServerName = hostName
+		}
+		dst = tls.Client(dst, cfg)
+	}
+
+	link := &Link{
+		Id:         newGuid(),
+		Time:       gtype.DateTime(time.Now()),
+		Protocol:   ProtocolTcp,
+		ListenAddr: listenAddress,
+		Domain:     hostName,
+		SourceAddr: src.RemoteAddr().String(),
+		TargetAddr: dst.RemoteAddr().String(),
+		Status:     0,
+		SourceId:   dp.Address.SourceId,
+		TargetId:   dp.Address.TargetId,
+		start:      time.Now(),
+	}
+	if dp.traffics != nil {
+		link.traffic = dp.traffics.newLink(link.SourceId, link.TargetId)
+	} else {
+		link.traffic = &linkTraffic{}
+	}
+	link.traffic.open()
+	pair := dp.connections.add(src, dst)
+	defer dp.connections.remove(pair)
 	if dp.OnConnected != nil {
-		go dp.OnConnected(id, listenAddress, hostName, srcAddr, dstAddr)
+		connected := *link
+		go dp.OnConnected(&connected)
 	}
 
-	ec := make(chan error, 1)
-	go proxyCopy(ec, src, dst)
-	go proxyCopy(ec, dst, src)
+	ec := make(chan copyResult, 2)
+	go proxyCopy(ec, src, dst, false, link.traffic.addOut, limits.download)
+	go proxyCopy(ec, dst, src, true, link.traffic.addIn, limits.upload)
+	result := <-ec
+
+	// close both sides to stop the other direction, and wait for it
+	// so that the byte counts are complete.
+	src.Close()
+	dst.Close()
 	<-ec
+	link.traffic.shut()
 
+	link.Time = gtype.DateTime(time.Now())
+	link.Status = 1
+	link.CloseReason = result.reason()
+	link.refresh()
 	if dp.OnDisconnected != nil {
-		go dp.OnDisconnected(id, listenAddress, hostName, srcAddr, dstAddr)
+		go dp.OnDisconnected(link)
+	}
+}
+
+// dial connects to the address selected by the balance strategy.
+// On failure it retries the next alive address (spare targets)
+// within the dial timeout, and returns the last tried address.
+// The count of the returned address is increased on success.
+func (dp *TargetProxy) dial(ctx context.Context, source string) (net.Conn, *TargetAddressItem, error) {
+	addr := dp.Address.SelectAddress(source)
+	tried := make(map[*TargetAddressItem]bool)
+	for {
+		tried[addr] = true
+		addr.IncreaseCount()
+		dst, err := dp.dialContext()(ctx, "tcp", addr.Addr)
+		if err == nil {
+			addr.dialSucceeded()
+			return dst, addr, nil
+		}
+		addr.DecreaseCount()
+		addr.dialFailed(err, &dp.Address.Check)
+
+		next := dp.Address.nextAddress(tried, source)
+		if next == nil || ctx.Err() != nil {
+			return nil, addr, err
+		}
+		log.Printf("tcpproxy: error dialing %q: %v, failover to %q", addr.Addr, err, next.Addr)
+		addr = next
+	}
+}
+
+func (dp *TargetProxy) reject(src net.Conn, listenAddress, hostName, reason string) {
+	src.Close()
+	if dp.traffics != nil {
+		dp.traffics.reject(dp.Address.SourceId, dp.Address.TargetId)
+	}
+	if dp.OnRejected != nil {
+		go dp.OnRejected(&Link{
+			Id:          newGuid(),
+			Time:        gtype.DateTime(time.Now()),
+			Protocol:    ProtocolTcp,
+			ListenAddr:  listenAddress,
+			Domain:      hostName,
+			SourceAddr:  src.RemoteAddr().String(),
+			Status:      1,
+			SourceId:    dp.Address.SourceId,
+			TargetId:    dp.Address.TargetId,
+			CloseReason: "rejected: " + reason,
+		})
 	}
 }
 
@@ -132,7 +257,11 @@ func (dp *TargetProxy) onDialError() func(src net.Conn, dstAddr string, dstDialE
 
 func goCloseConn(c net.Conn) { go c.Close() }
 
-func (dp *TargetProxy) sendProxyHeader(w io.Writer, src net.Conn) error {
+func sourceIP(c net.Conn) string {
+	return addrIP(c.RemoteAddr())
+}
+
+func (dp *TargetProxy) sendProxyHeader(w io.Writer, src net.Conn, hostName string) error {
 	switch dp.ProxyProtocolVersion {
 	case 0:
 		return nil
@@ -154,8 +283,11 @@ func (dp *TargetProxy) sendProxyHeader(w io.Writer, src net.Conn) error {
 		if srcAddr.IP.To4() == nil {
 			family = "TCP6"
 		}
-		_, err := fmt.Fprintf(w, "PROXY %s %s %d %s %d\r\n", family, srcAddr.IP, srcAddr.Port, dstAddr.IP, dstAddr.Port)
+		// PROXY family srcIP dstIP srcPort dstPort
+		_, err := fmt.Fprintf(w, "PROXY %s %s %s %d %d\r\n", family, srcAddr.IP, dstAddr.IP, srcAddr.Port, dstAddr.Port)
 		return err
+	case 2:
+		return writeProxyHeaderV2(w, src.RemoteAddr(), src.LocalAddr(), hostName)
 	default:
 		return fmt.Errorf("PROXY protocol version %d not supported", dp.ProxyProtocolVersion)
 	}
@@ -177,6 +309,16 @@ func UnderlyingConn(c net.Conn) net.Conn {
 	return c
 }
 
+// tcpConn returns the raw connection of c for socket options,
+// unwrapping *Conn and *ProxyProtocolConn.
+func tcpConn(c net.Conn) net.Conn {
+	c = UnderlyingConn(c)
+	if wrap, ok := c.(*ProxyProtocolConn); ok {
+		return wrap.Conn
+	}
+	return c
+}
+
 func newGuid() string {
 	uuid := make([]byte, 16)
 	n, err := io.ReadFull(rand.Reader, uuid)
@@ -190,14 +332,40 @@ func newGuid() string {
 	return fmt.Sprintf("%x%x%x%x%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
 }
 
+// proxyCopyChunk is the size of each splice copy, after which
+// the byte counts are updated.
+const proxyCopyChunk = 32 * 1024
+
+type copyResult struct {
+	// true: copying from client to target
+	fromClient bool
+	err        error
+}
+
+func (s copyResult) reason() string {
+	side := "target"
+	if s.fromClient {
+		side = "client"
+	}
+	if s.err == nil {
+		return side + " closed"
+	}
+
+	return fmt.Sprintf("%s error: %v", side, s.err)
+}
+
 // proxyCopy is the function that copies bytes around.
 // It's a named function instead of a func literal so users get
 // named goroutines in debug goroutine stack dumps.
-func proxyCopy(ec chan<- error, dst, src net.Conn) {
+// The limits throttle the bytes copied, if any.
+func proxyCopy(ec chan<- copyResult, dst, src net.Conn, fromClient bool, count func(n int64), limits rateLimiters) {
 	// Before we unwrap src and/or dst, copy any buffered data.
 	if wc, ok := src.(*tcpproxy.Conn); ok && len(wc.Peeked) > 0 {
-		if _, err := dst.Write(wc.Peeked); err != nil {
-			ec <- err
+		n, err := dst.Write(wc.Peeked)
+		count(int64(n))
+		limits.wait(int64(n))
+		if err != nil {
+			ec <- copyResult{fromClient: fromClient, err: err}
 			return
 		}
 		wc.Peeked = nil
@@ -208,6 +376,20 @@ func proxyCopy(ec chan<- error, dst, src net.Conn) {
 	src = UnderlyingConn(src)
 	dst = UnderlyingConn(dst)
 
-	_, err := io.Copy(dst, src)
-	ec <- err
+	// Copy in chunks: io.CopyN keeps the splice optimization
+	// (*net.TCPConn.ReadFrom accepts *io.LimitedReader) while
+	// the byte counts stay up to date for long-lived connections.
+	chunk := limits.chunk(proxyCopyChunk)
+	for {
+		n, err := io.CopyN(dst, src, chunk)
+		count(n)
+		limits.wait(n)
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			ec <- copyResult{fromClient: fromClient, err: err}
+			return
+		}
+	}
 }
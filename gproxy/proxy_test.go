@@ -0,0 +1,124 @@
+package gproxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTargetProxy_HandleConn(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	address := &TargetAddress{SourceId: "s", TargetId: "t"}
+	address.SetAddress(ln.Addr().String())
+	links := make(chan *Link, 1)
+	dp := &TargetProxy{
+		Address:        address,
+		OnDisconnected: func(link *Link) { links <- link },
+		traffics:       newTrafficCollection(),
+	}
+
+	client, server := net.Pipe()
+	go dp.HandleConn(server, ":80", "test.com")
+
+	buf := make([]byte, 5)
+	client.Write([]byte("hello"))
+	if _, err := io.ReadFull(client, buf); err != nil || string(buf) != "hello" {
+		t.Fatal("echo:", string(buf), err)
+	}
+	client.Close()
+
+	select {
+	case link := <-links:
+		if link.BytesIn != 5 || link.BytesOut != 5 {
+			t.Fatal("bytes:", link.BytesIn, link.BytesOut)
+		}
+		if link.CloseReason != "client closed" {
+			t.Fatal("close reason:", link.CloseReason)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("disconnected timeout")
+	}
+
+	summary := dp.traffics.summary()
+	if len(summary.Targets) != 1 || summary.Targets[0].BytesIn != 5 || summary.Targets[0].Actives != 0 {
+		t.Fatal("target traffic:", summary.Targets)
+	}
+}
+
+func TestTargetProxy_Failover(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	// 已关闭的端口
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	address := &TargetAddress{
+		SourceId: "s",
+		TargetId: "t",
+		Balance:  BalanceRoundRobin,
+		Check:    HealthCheck{Failures: 1, Cooldown: time.Minute},
+	}
+	address.SetAddress(closed.Addr().String())
+	address.AddAddress([]string{ln.Addr().String()})
+	items := address.Items()
+	for _, item := range items {
+		item.alive = true
+	}
+	dp := &TargetProxy{Address: address}
+
+	for i := 0; i < 2; i++ {
+		dst, addr, err := dp.dial(context.Background(), "")
+		if err != nil {
+			t.Fatal("dial:", err)
+		}
+		dst.Close()
+		addr.DecreaseCount()
+		if addr != items[1] {
+			t.Fatal("failover address:", addr.Addr)
+		}
+	}
+	if items[0].IstAlive() {
+		t.Fatal("failed address should be marked dead")
+	}
+
+	// 冷却时间内检测通过也不恢复
+	items[0].setCheckResult(nil, &address.Check)
+	if items[0].IstAlive() {
+		t.Fatal("address should not be alive in cooldown")
+	}
+}
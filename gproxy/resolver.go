@@ -0,0 +1,379 @@
+package gproxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SrvPrefix SRV记录目标地址的前缀，如"srv://_http._tcp.example.com"，
+	// 按SRV记录的目标及端口转发，忽略配置的端口
+	SrvPrefix = "srv://"
+
+	dnsTypeA     = 1
+	dnsTypeCNAME = 5
+	dnsTypeAAAA  = 28
+	dnsTypeSRV   = 33
+
+	dnsTimeout = 2 * time.Second
+)
+
+// IsSrvAddress 是否为SRV记录目标地址
+func IsSrvAddress(v string) bool {
+	return strings.HasPrefix(strings.ToLower(v), SrvPrefix)
+}
+
+// resolvedAddress 域名解析后的目标地址
+type resolvedAddress struct {
+	Addr   string
+	Weight int
+}
+
+// resolveHost 解析目标地址，返回地址列表及TTL(0表示未知)，测试时可替换
+var resolveHost = func(ctx context.Context, host, port string, srv bool) ([]resolvedAddress, time.Duration, error) {
+	if srv {
+		return lookupSrv(ctx, host)
+	}
+
+	ips, ttl, err := lookupIP(ctx, host)
+	if err != nil {
+		return nil, 0, err
+	}
+	addrs := make([]resolvedAddress, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, resolvedAddress{Addr: net.JoinHostPort(ip, port)})
+	}
+
+	return addrs, ttl, nil
+}
+
+// lookupIP 优先直接查询DNS服务器以获取记录的TTL，失败时使用系统解析(如hosts文件及搜索域)
+func lookupIP(ctx context.Context, host string) ([]string, time.Duration, error) {
+	if strings.Contains(host, ".") {
+		ips := make([]string, 0)
+		ttl := time.Duration(0)
+		for _, qtype := range []uint16{dnsTypeA, dnsTypeAAAA} {
+			records, err := dnsLookup(ctx, host, qtype)
+			if err != nil {
+				break
+			}
+			for _, record := range records {
+				if record.Type == qtype {
+					ips = append(ips, record.Value)
+				}
+				ttl = minTTL(ttl, record.TTL)
+			}
+		}
+		if len(ips) > 0 {
+			sort.Strings(ips)
+			return ips, ttl, nil
+		}
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, 0, err
+	}
+	ips := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP.String())
+	}
+	sort.Strings(ips)
+
+	return ips, 0, nil
+}
+
+// lookupSrv 只使用优先级最高(Priority最小)的记录，记录的权重作为地址权重
+func lookupSrv(ctx context.Context, name string) ([]resolvedAddress, time.Duration, error) {
+	type srv struct {
+		target   string
+		port     uint16
+		priority uint16
+		weight   uint16
+	}
+	items := make([]srv, 0)
+	ttl := time.Duration(0)
+
+	records, err := dnsLookup(ctx, name, dnsTypeSRV)
+	if err == nil {
+		for _, record := range records {
+			ttl = minTTL(ttl, record.TTL)
+			if record.Type == dnsTypeSRV {
+				items = append(items, srv{record.Value, record.Port, record.Priority, record.Weight})
+			}
+		}
+	}
+	if len(items) < 1 {
+		_, srvs, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, 0, err
+		}
+		ttl = 0
+		for _, v := range srvs {
+			items = append(items, srv{v.Target, v.Port, v.Priority, v.Weight})
+		}
+	}
+	if len(items) < 1 {
+		return nil, 0, fmt.Errorf("no SRV record for %s", name)
+	}
+
+	priority := items[0].priority
+	for _, item := range items {
+		if item.priority < priority {
+			priority = item.priority
+		}
+	}
+	addrs := make([]resolvedAddress, 0)
+	for _, item := range items {
+		if item.priority != priority {
+			continue
+		}
+		ips, ipTTL, err := lookupIP(ctx, strings.TrimSuffix(item.target, "."))
+		if err != nil {
+			continue
+		}
+		ttl = minTTL(ttl, ipTTL)
+		for _, ip := range ips {
+			addrs = append(addrs, resolvedAddress{
+				Addr:   net.JoinHostPort(ip, strconv.Itoa(int(item.port))),
+				Weight: int(item.weight),
+			})
+		}
+	}
+	if len(addrs) < 1 {
+		return nil, 0, fmt.Errorf("no address for SRV record %s", name)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Addr < addrs[j].Addr })
+
+	return addrs, ttl, nil
+}
+
+func minTTL(a, b time.Duration) time.Duration {
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+
+	return a
+}
+
+// dnsRecord 应答记录，Value为IP地址(A/AAAA)或域名(CNAME/SRV)
+type dnsRecord struct {
+	Type     uint16
+	TTL      time.Duration
+	Value    string
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+}
+
+// dnsLookup 依次向/etc/resolv.conf中的DNS服务器查询(UDP)
+func dnsLookup(ctx context.Context, name string, qtype uint16) ([]dnsRecord, error) {
+	servers := dnsServers()
+	if len(servers) < 1 {
+		return nil, fmt.Errorf("no dns server")
+	}
+
+	var err error = nil
+	for _, server := range servers {
+		var records []dnsRecord
+		records, err = dnsQuery(ctx, server, name, qtype)
+		if err == nil {
+			return records, nil
+		}
+	}
+
+	return nil, err
+}
+
+func dnsServers() []string {
+	file, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	servers := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		if net.ParseIP(fields[1]) != nil {
+			servers = append(servers, net.JoinHostPort(fields[1], "53"))
+		}
+	}
+
+	return servers
+}
+
+func dnsQuery(ctx context.Context, server, name string, qtype uint16) ([]dnsRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, dnsTimeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	id := make([]byte, 2)
+	rand.Read(id)
+	query, err := newDnsQuery(binary.BigEndian.Uint16(id), name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if n < 2 || binary.BigEndian.Uint16(buf) != binary.BigEndian.Uint16(id) {
+			continue
+		}
+		return parseDnsResponse(buf[:n])
+	}
+}
+
+func newDnsQuery(id uint16, name string, qtype uint16) ([]byte, error) {
+	msg := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	// 期望递归
+	binary.BigEndian.PutUint16(msg[2:], 0x0100)
+	binary.BigEndian.PutUint16(msg[4:], 1)
+
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) < 1 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid domain name: %s", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, byte(qtype>>8), byte(qtype), 0, 1)
+
+	return msg, nil
+}
+
+func parseDnsResponse(msg []byte) ([]dnsRecord, error) {
+	if len(msg) < 12 {
+		return nil, fmt.Errorf("dns response too short")
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&0x0200 != 0 {
+		return nil, fmt.Errorf("dns response truncated")
+	}
+	if rcode := flags & 0x000f; rcode != 0 {
+		return nil, fmt.Errorf("dns response code %d", rcode)
+	}
+	qdCount := int(binary.BigEndian.Uint16(msg[4:]))
+	anCount := int(binary.BigEndian.Uint16(msg[6:]))
+
+	offset := 12
+	var err error = nil
+	for i := 0; i < qdCount; i++ {
+		if _, offset, err = parseDnsName(msg, offset); err != nil {
+			return nil, err
+		}
+		offset += 4
+	}
+
+	records := make([]dnsRecord, 0, anCount)
+	for i := 0; i < anCount; i++ {
+		if _, offset, err = parseDnsName(msg, offset); err != nil {
+			return nil, err
+		}
+		if offset+10 > len(msg) {
+			return nil, fmt.Errorf("dns record too short")
+		}
+		record := dnsRecord{
+			Type: binary.BigEndian.Uint16(msg[offset:]),
+			TTL:  time.Duration(binary.BigEndian.Uint32(msg[offset+4:])) * time.Second,
+		}
+		length := int(binary.BigEndian.Uint16(msg[offset+8:]))
+		offset += 10
+		if offset+length > len(msg) {
+			return nil, fmt.Errorf("dns record data too short")
+		}
+		data := msg[offset : offset+length]
+
+		switch record.Type {
+		case dnsTypeA, dnsTypeAAAA:
+			if length != net.IPv4len && length != net.IPv6len {
+				return nil, fmt.Errorf("invalid dns address length %d", length)
+			}
+			record.Value = net.IP(data).String()
+		case dnsTypeCNAME:
+			if record.Value, _, err = parseDnsName(msg, offset); err != nil {
+				return nil, err
+			}
+		case dnsTypeSRV:
+			if length < 7 {
+				return nil, fmt.Errorf("dns SRV record too short")
+			}
+			record.Priority = binary.BigEndian.Uint16(data[0:])
+			record.Weight = binary.BigEndian.Uint16(data[2:])
+			record.Port = binary.BigEndian.Uint16(data[4:])
+			if record.Value, _, err = parseDnsName(msg, offset+6); err != nil {
+				return nil, err
+			}
+		}
+		offset += length
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// parseDnsName 解析(可能压缩的)域名，返回域名及其后的偏移
+func parseDnsName(msg []byte, offset int) (string, int, error) {
+	labels := make([]string, 0)
+	next := -1
+	for jumps := 0; ; {
+		if offset >= len(msg) {
+			return "", 0, fmt.Errorf("dns name out of range")
+		}
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(msg) {
+				return "", 0, fmt.Errorf("dns name pointer out of range")
+			}
+			jumps++
+			if jumps > 16 {
+				return "", 0, fmt.Errorf("dns name too many pointers")
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3fff)
+		default:
+			if offset+1+length > len(msg) {
+				return "", 0, fmt.Errorf("dns label out of range")
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
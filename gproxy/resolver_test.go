@@ -0,0 +1,151 @@
+package gproxy
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseDnsResponse(t *testing.T) {
+	query, err := newDnsQuery(0x1234, "_http._tcp.example.com", dnsTypeSRV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary.BigEndian.Uint16(query) != 0x1234 {
+		t.Fatal("id:", query[:2])
+	}
+	name, offset, err := parseDnsName(query, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "_http._tcp.example.com." || offset+4 != len(query) {
+		t.Fatal("name:", name, offset)
+	}
+
+	// 应答: 标志0x8180，1个问题，2个记录(SRV及A)，记录名称使用压缩指针(0xc00c)
+	msg := append([]byte{}, query...)
+	binary.BigEndian.PutUint16(msg[2:], 0x8180)
+	binary.BigEndian.PutUint16(msg[6:], 2)
+	srv := []byte{0, 10, 0, 5, 0x1f, 0x90, 3, 'w', 'e', 'b', 0xc0, 23}
+	msg = append(msg, 0xc0, 12, 0, dnsTypeSRV, 0, 1, 0, 0, 0, 60, 0, byte(len(srv)))
+	msg = append(msg, srv...)
+	msg = append(msg, 0xc0, 12, 0, dnsTypeA, 0, 1, 0, 0, 0, 30, 0, 4, 10, 0, 0, 1)
+
+	records, err := parseDnsResponse(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatal("records:", records)
+	}
+	if records[0].Type != dnsTypeSRV || records[0].Value != "web.example.com." ||
+		records[0].Port != 8080 || records[0].Priority != 10 || records[0].Weight != 5 ||
+		records[0].TTL != time.Minute {
+		t.Fatal("srv:", records[0])
+	}
+	if records[1].Type != dnsTypeA || records[1].Value != "10.0.0.1" || records[1].TTL != 30*time.Second {
+		t.Fatal("a:", records[1])
+	}
+
+	// 错误码
+	binary.BigEndian.PutUint16(msg[2:], 0x8183)
+	if _, err = parseDnsResponse(msg); err == nil {
+		t.Fatal("error expected for NXDOMAIN")
+	}
+}
+
+func TestTargetAddress_Resolve(t *testing.T) {
+	mutex := sync.Mutex{}
+	addrs := []resolvedAddress{{Addr: "10.0.0.1:80"}, {Addr: "10.0.0.2:80"}}
+	old := resolveHost
+	resolveHost = func(ctx context.Context, host, port string, srv bool) ([]resolvedAddress, time.Duration, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if host != "backend.local" || port != "80" || srv {
+			t.Error("resolve:", host, port, srv)
+		}
+		return append([]resolvedAddress{}, addrs...), time.Second, nil
+	}
+	defer func() { resolveHost = old }()
+
+	address := &TargetAddress{
+		SourceId: "s",
+		TargetId: "t",
+		Passive:  true,
+	}
+	address.SetAddress("backend.local:80")
+	address.AddAddress([]string{"192.168.1.1:80"})
+	items := address.Items()
+	if len(items) != 2 || items[0].Addr != "backend.local:80" {
+		t.Fatal("items before resolving:", items)
+	}
+	hostId := items[0].HostId
+
+	resolve := func(now time.Time) []*TargetAddressItem {
+		address.doResolve(now)
+		for i := 0; i < 100; i++ {
+			address.RLock()
+			resolving := address.resolving
+			address.RUnlock()
+			if !resolving {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return address.Items()
+	}
+
+	// 解析的每个地址为一个地址项，保留配置地址的标识
+	items = resolve(time.Now())
+	if len(items) != 3 || items[0].Addr != "10.0.0.1:80" || items[1].Addr != "10.0.0.2:80" {
+		t.Fatal("items after resolving:", items)
+	}
+	if items[0].HostId != hostId || items[0].AddrId == hostId || items[0].AddrId == items[1].AddrId {
+		t.Fatal("ids:", items[0].HostId, items[0].AddrId, items[1].AddrId)
+	}
+	if !items[0].IstAlive() {
+		t.Fatal("passive resolved address should be alive")
+	}
+	if alive, ok := address.HostAlive(hostId); !alive || !ok {
+		t.Fatal("host alive:", alive, ok)
+	}
+
+	// 排空配置地址时同时排空其解析的地址
+	address.SetDraining(hostId, true)
+	if !items[0].IsDraining() || !items[1].IsDraining() || items[2].IsDraining() {
+		t.Fatal("draining should apply to resolved addresses")
+	}
+
+	// 重新解析后沿用未变化地址的状态，新地址继承排空状态
+	first := items[0]
+	first.IncreaseCount()
+	mutex.Lock()
+	addrs = []resolvedAddress{{Addr: "10.0.0.1:80"}, {Addr: "10.0.0.3:80"}}
+	mutex.Unlock()
+	items = resolve(time.Now().Add(2 * time.Second))
+	if len(items) != 3 || items[0] != first || items[0].Count() != 1 || items[1].Addr != "10.0.0.3:80" {
+		t.Fatal("items after re-resolving:", items)
+	}
+	if !items[1].IsDraining() {
+		t.Fatal("new resolved address should inherit draining")
+	}
+
+	// 未到期时不重新解析
+	mutex.Lock()
+	addrs = []resolvedAddress{{Addr: "10.0.0.4:80"}}
+	mutex.Unlock()
+	items = resolve(time.Now())
+	if len(items) != 3 || items[1].Addr != "10.0.0.3:80" {
+		t.Fatal("should not resolve before expiration:", items)
+	}
+
+	// 路由更新时沿用原解析结果
+	updated := &TargetAddress{SourceId: "s", TargetId: "t"}
+	updated.SetAddress("backend.local:80")
+	updated.inherit(address)
+	if items = updated.Items(); len(items) != 2 || items[1].Addr != "10.0.0.3:80" {
+		t.Fatal("inherited items:", items)
+	}
+}
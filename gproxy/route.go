@@ -1,6 +1,16 @@
 package gproxy
 
-import "strings"
+import (
+	"strings"
+	"time"
+)
+
+const (
+	ProtocolTcp = "tcp"
+	ProtocolUdp = "udp"
+	// HTTP(七层)转发，逐个请求匹配路由并选择目标地址
+	ProtocolHttp = "http"
+)
 
 // Route 转发路由
 type Route struct {
@@ -15,22 +25,105 @@ type Route struct {
 
 	// 监听地址，如"192.168.1.1:80", ":80"
 	Address string
+	// 协议，ProtocolTcp(默认)、ProtocolUdp或ProtocolHttp，按监听地址生效
+	// udp时按监听地址只转发至第一个路由的目标，忽略Domain、Path、IsTls及Version
+	// http时解析每个请求，按域名及路径匹配路由，IsTls时须同时TLS终止，忽略Version
+	Protocol string
+	// UDP会话空闲超时时间，小于等于0时为60秒
+	IdleTimeout time.Duration
 
-	// 转发域名，如"my.test.com", ""(全部转发)
+	// 转发域名，如"my.test.com", ""(全部转发)；
+	// 也可以是通配符(如"*.test.com")或正则表达式(以"~"开头，如"~^shop-[0-9]+\.test\.com$")，
+	// 多个路由匹配时的优先顺序见routeMatcher
 	Domain string
 
 	// 转发路径，如"/document", ""(所有路径)
-	// 目前仅http有效，https暂不支持
+	// http或TLS终止时有效，TLS透传(SNI)时不支持
 	Path string
 
-	// 目标地址，如"172.16.100.85:8080"
+	// 目标地址，如"172.16.100.85:8080"；
+	// 也可以是域名(如"backend.local:8080")或SRV记录(如"srv://_http._tcp.backend.local")，
+	// 定期重新解析，解析的每个地址分别进行健康检测及负载均衡
 	Target string
 	// 备用目标地址
 	SpareTargets []string
+	// 域名重新解析的最大间隔，DNS记录的TTL较小时按TTL，小于等于0时为30秒
+	ResolveInterval time.Duration
+
+	// 负载均衡策略
+	Balance Balance
+	// 目标地址权重，小于1时视为1
+	Weight int
+	// 备用目标地址权重，与SpareTargets一一对应
+	SpareWeights []int
+
+	// 健康检测
+	Check HealthCheck
+
+	// 来源地址(IP或CIDR)，为空时匹配所有来源
+	Sources []string
+	// TLS ALPN协议(如"h2", "http/1.1")，为空时匹配所有连接；
+	// TLS透传(SNI)时匹配客户端提供的协议，TLS终止时匹配协商的协议
+	Alpn []string
 
 	// 版本号: 0-不添加头部；
 	//1-添加代理头部（PROXY family srcIP srcPort targetIP targetPort）
+	//2-添加PROXY协议v2二进制头部（包含SNI或Host）
 	Version int
+
+	// TLS终止: 由代理解密(按SNI选择证书)后按域名及路径转发(同http)，
+	// 仅IsTls时有效，按监听地址生效
+	Terminate bool
+	// TLS终止时使用的证书
+	Certificates []Certificate
+	// TLS终止或http时是否使用TLS连接目标(重新加密)
+	Encrypt bool
+	// 重新加密时是否跳过目标证书验证
+	SkipVerify bool
+
+	// 访问控制，按监听地址生效
+	Access AccessPolicy
+	// 访问控制，仅对该目标生效
+	TargetAccess AccessPolicy
+
+	// 带宽限制，按监听地址生效，tcp及http有效
+	Bandwidth BandwidthPolicy
+	// 带宽限制，仅对该目标生效
+	TargetBandwidth BandwidthPolicy
+
+	// 路径前缀替换，非空时将请求路径中匹配的Path前缀替换为该值，"/"表示去除前缀，仅http有效
+	PathRewrite string
+	// 转发至目标的请求头部修改，仅http有效
+	RequestHeader HeaderRewrite
+	// 返回至客户端的响应头部修改，仅http有效
+	ResponseHeader HeaderRewrite
+
+	// 是否接收并去除传入连接的PROXY协议头部(v1或v2)，按监听地址生效
+	AcceptProxy bool
+	// 读取PROXY协议头部的超时时间，小于等于0时为5秒
+	AcceptProxyTimeout time.Duration
+	// 可信的代理地址(IP或CIDR)，为空时不信任任何来源
+	TrustedProxies []string
+}
+
+// Weights 目标地址及备用目标地址的权重
+func (s *Route) Weights() []int {
+	weights := make([]int, 0)
+	weights = append(weights, s.Weight)
+
+	c := len(s.SpareTargets)
+	for i := 0; i < c; i++ {
+		if len(s.SpareTargets[i]) < 1 {
+			continue
+		}
+		if i < len(s.SpareWeights) {
+			weights = append(weights, s.SpareWeights[i])
+		} else {
+			weights = append(weights, 0)
+		}
+	}
+
+	return weights
 }
 
 func (s *Route) Targets() string {
@@ -48,3 +141,20 @@ func (s *Route) Targets() string {
 
 	return sb.String()
 }
+
+// serverName 重新加密时验证目标证书的域名，通配符或正则表达式域名时为空(使用传入连接的域名)
+func (s *Route) serverName() string {
+	if strings.HasPrefix(s.Domain, HostWildcardPrefix) || strings.HasPrefix(s.Domain, HostRegexPrefix) {
+		return ""
+	}
+
+	return s.Domain
+}
+
+func (s *Route) IsUdp() bool {
+	return s.Protocol == ProtocolUdp
+}
+
+func (s *Route) IsHttp() bool {
+	return s.Protocol == ProtocolHttp
+}
@@ -1,10 +1,14 @@
 package gproxy
 
 import (
+	"crypto/tls"
 	"fmt"
 	"github.com/csby/gwsf/gtype"
 	"github.com/csby/tcpproxy"
 	"net"
+	"reflect"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,12 +22,21 @@ type Server struct {
 	OnTargetAliveChanged     func(item *TargetAddressItem)
 	OnTargetConnCountChanged func(item *TargetAddressItem, increase bool)
 
-	agent           *tcpproxy.Proxy
+	// 停止服务时等待已有连接结束的超时时间，超时后强制关闭；
+	// 小于等于0时立即关闭所有连接
+	DrainTimeout time.Duration
+
+	mutex           sync.Mutex
+	statusMutex     sync.RWMutex // 保护status, 停止时等待连接结束期间不持有mutex
 	status          Status
 	err             interface{}
 	startTime       gtype.DateTime
 	targetAddresses []*TargetAddress
 	isAliveChecking bool
+	listeners       map[string]*proxyListener
+	traffics        *trafficCollection
+	connections     *connectionCollection
+	drains          map[string]bool
 }
 
 func (s *Server) Start() error {
@@ -34,105 +47,494 @@ func (s *Server) Start() error {
 		}
 	}()
 
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	if s.status != StatusStopped {
 		return fmt.Errorf("server is %s", s.status)
 	}
 
-	s.targetAddresses = make([]*TargetAddress, 0)
+	if s.traffics == nil {
+		s.traffics = newTrafficCollection()
+	}
+	if s.connections == nil {
+		s.connections = newConnectionCollection()
+	}
 	routes := s.Routes
 	count := len(routes)
 	if count < 1 {
 		return fmt.Errorf("routes is empty")
 	}
 
-	s.agent = &tcpproxy.Proxy{}
+	s.setStatus(StatusStarting)
+	listeners := make(map[string]*proxyListener)
+	addresses, groups := groupRoutes(routes)
+	for _, address := range addresses {
+		listener, err := s.newListener(address, groups[address], nil)
+		if err != nil {
+			for _, v := range listeners {
+				v.close()
+			}
+			s.err = err
+			s.setStatus(StatusStopped)
+			s.LogError("start proxy server error:", err)
+			return err
+		}
+		listeners[address] = listener
+	}
+	s.setListeners(listeners)
+
+	s.err = nil
+	s.startTime = gtype.DateTime(time.Now())
+	s.setStatus(StatusRunning)
+
+	if s.isAliveChecking == false {
+		s.isAliveChecking = true
+		go s.doAliveChecking()
+	}
+
+	return nil
+}
+
+// Stop 停止监听并等待已有连接结束(最长DrainTimeout)，等待期间不持有锁，
+// 摘流、在线状态查询及更新路由等操作不受影响
+func (s *Server) Stop() error {
+	s.mutex.Lock()
+	if s.status != StatusRunning {
+		s.mutex.Unlock()
+		return fmt.Errorf("server has be %s", s.status)
+	}
+
+	s.setStatus(StatusStopping)
+	var err error = nil
+	for _, listener := range s.listeners {
+		e := listener.close()
+		if e != nil {
+			err = e
+		}
+	}
+	s.setListeners(make(map[string]*proxyListener))
+	connections := s.connections
+	timeout := s.DrainTimeout
+	s.mutex.Unlock()
+
+	// 已停止接收新连接，等待已有连接结束
+	if connections != nil {
+		count := connections.count()
+		if count > 0 && timeout > 0 {
+			s.LogInfo(fmt.Sprintf("proxy: waiting for %d connection(s) to finish, timeout: %v", count, timeout))
+			connections.wait(timeout)
+		}
+		count = connections.closeAll()
+		if count > 0 {
+			s.LogInfo(fmt.Sprintf("proxy: %d connection(s) force closed", count))
+		}
+	}
+
+	s.mutex.Lock()
+	s.setStatus(StatusStopped)
+	s.mutex.Unlock()
+
+	return err
+}
+
+func (s *Server) Restart() error {
+	if s.status == StatusRunning {
+		s.Stop()
+	}
+
+	return s.Start()
+}
+
+// Apply 更新路由，服务运行时只对有变化的监听地址生效，不中断已有连接:
+// 路由未变的监听地址保持不变；
+// 新增的监听地址开始监听；
+// 路由有变化的监听地址由新路由接管端口，已有连接继续直到结束；
+// 删除的监听地址停止监听，已有连接继续直到结束。
+func (s *Server) Apply(routes []Route) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Routes = routes
+	if s.status != StatusRunning {
+		return nil
+	}
+
+	errs := make([]string, 0)
+	listeners := make(map[string]*proxyListener)
+	addresses, groups := groupRoutes(routes)
+	for _, address := range addresses {
+		items := groups[address]
+		old, ok := s.listeners[address]
+		if ok && reflect.DeepEqual(old.routes, items) {
+			listeners[address] = old
+			continue
+		}
+
+		listener, err := s.newListener(address, items, old)
+		if err != nil {
+			s.LogError(fmt.Sprintf("proxy(listen=%s): apply routes error: %v", address, err))
+			errs = append(errs, fmt.Sprintf("%s: %v", address, err))
+			if ok {
+				listeners[address] = old
+			}
+			continue
+		}
+		listeners[address] = listener
+		if ok {
+			s.LogInfo(fmt.Sprintf("proxy(listen=%s): routes changed", address))
+		} else {
+			s.LogInfo(fmt.Sprintf("proxy(listen=%s): listener added", address))
+		}
+	}
+
+	for address, old := range s.listeners {
+		if _, ok := listeners[address]; ok {
+			continue
+		}
+		old.retire()
+		s.LogInfo(fmt.Sprintf("proxy(listen=%s): listener removed", address))
+	}
+	s.setListeners(listeners)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// newListener 创建监听地址的tcpproxy.Proxy(或udpProxy、httpProxy)，
+// old不为空时接管其监听端口，并沿用其目标地址的在线状态
+func (s *Server) newListener(address string, routes []Route, old *proxyListener) (*proxyListener, error) {
+	if len(routes) > 0 && routes[0].IsUdp() {
+		return s.newUdpListener(address, routes, old)
+	}
+
+	listener := &proxyListener{
+		address:         address,
+		routes:          routes,
+		agent:           &tcpproxy.Proxy{},
+		targetAddresses: make([]*TargetAddress, 0),
+	}
+	if old != nil {
+		listener.socket = old.socket
+	} else {
+		socket, err := listenSocket("tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		listener.socket = socket
+	}
+
+	var tlsConfig *tls.Config = nil
+	terminate := routes[0].IsTls && routes[0].Terminate
+	if routes[0].IsHttp() && routes[0].IsTls && !terminate {
+		if old == nil {
+			listener.socket.Close()
+		}
+		return nil, fmt.Errorf("http over tls requires tls termination")
+	}
+	if terminate {
+		cfg, err := newTerminateConfig(routes[0].Certificates)
+		if err != nil {
+			if old == nil {
+				listener.socket.Close()
+			}
+			return nil, err
+		}
+		tlsConfig = cfg
+	}
+
+	matchers := make([]*routeMatcher, 0, len(routes))
+	for index, route := range routes {
+		matcher, err := newRouteMatcher(index, route)
+		if err != nil {
+			if old == nil {
+				listener.socket.Close()
+			}
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+
+	var proxyProtocol *ProxyProtocolListener = nil
+	for _, route := range routes {
+		if !route.AcceptProxy {
+			continue
+		}
+		pp, err := NewProxyProtocolListener(nil, route.TrustedProxies, route.AcceptProxyTimeout)
+		if err != nil {
+			if old == nil {
+				listener.socket.Close()
+			}
+			return nil, fmt.Errorf("invalid trusted proxies: %v", err)
+		}
+		proxyProtocol = pp
+		if len(pp.trustedNets) > 0 {
+			s.LogInfo(fmt.Sprintf("proxy(listen=%s): accept PROXY protocol header from %v", address, route.TrustedProxies))
+		} else {
+			s.LogWarning(fmt.Sprintf("proxy(listen=%s): no trusted proxies, PROXY protocol header is not accepted", address))
+		}
+		break
+	}
+	access := newAccessControl(routes[0].Access)
+	if access != nil {
+		s.LogInfo(fmt.Sprintf("proxy(listen=%s): access %s", address, routes[0].Access.String()))
+	}
+	bandwidth := newBandwidthControl(routes[0].Bandwidth)
+	if bandwidth != nil {
+		s.LogInfo(fmt.Sprintf("proxy(listen=%s): bandwidth %s", address, routes[0].Bandwidth.String()))
+	}
+	isHttp := routes[0].IsHttp()
+	httpRoutes := make([]*httpRoute, 0)
+	dispatcher := &routeDispatcher{
+		sni:        routes[0].IsTls && !terminate,
+		onRejected: s.onRejected,
+	}
+	count := len(routes)
 	for index := 0; index < count; index++ {
 		route := routes[index]
-		if len(route.Target) < 1 {
+		targetAddress := s.newTargetAddress(route, old)
+		listener.targetAddresses = append(listener.targetAddresses, targetAddress)
+
+		if isHttp {
+			httpRoutes = append(httpRoutes, newHttpRoute(route, matchers[index], targetAddress,
+				[]*accessControl{access, newAccessControl(route.TargetAccess)},
+				[]*bandwidthControl{bandwidth, newBandwidthControl(route.TargetBandwidth)}))
+			s.LogInfo(fmt.Sprintf("proxy(http, tls=%v, encrypt=%v, balance=%s, check=%s, access=%s, bandwidth=%s, rewrite=%s, sources=%v, alpn=%v): %s%s, %s => %s",
+				route.IsTls, route.Encrypt, route.Balance, route.Check.String(), route.TargetAccess.String(), route.TargetBandwidth.String(), route.PathRewrite,
+				route.Sources, route.Alpn, route.Domain, route.Path, route.Address, route.Targets()))
 			continue
 		}
-		address := &TargetAddress{
-			SourceId:     route.SourceId,
-			TargetId:     route.TargetId,
-			AliveChanged: s.OnTargetAliveChanged,
-			CountChanged: s.OnTargetConnCountChanged,
-		}
-		address.SetAddress(route.Target)
-		address.AddAddress(route.SpareTargets)
-		s.targetAddresses = append(s.targetAddresses, address)
 
 		dest := &TargetProxy{
-			Address:              *address,
+			Address:              targetAddress,
 			ProxyProtocolVersion: route.Version,
 			OnConnected:          s.onConnected,
 			OnDisconnected:       s.onDisconnected,
+			OnRejected:           s.onRejected,
+			traffics:             s.traffics,
+			connections:          s.connections,
+			access:               []*accessControl{access, newAccessControl(route.TargetAccess)},
+			bandwidth:            []*bandwidthControl{bandwidth, newBandwidthControl(route.TargetBandwidth)},
+		}
+		if terminate && route.Encrypt {
+			dest.TargetTls = newEncryptConfig(route.serverName(), route.SkipVerify)
 		}
 
+		dispatcher.add(matchers[index], dest)
 		path := ""
-		if len(route.Domain) > 0 {
-			if route.IsTls {
-				s.agent.AddSNIRoute(route.Address, route.Domain, dest)
-			} else {
-				s.agent.AddHTTPHostRoute(route.Address, route.Domain, route.Path, dest)
-				path = route.Path
+		if !dispatcher.sni {
+			path = route.Path
+		}
+
+		mode := fmt.Sprint(route.IsTls)
+		if terminate {
+			mode = "terminate"
+			if route.Encrypt {
+				mode = "terminate+encrypt"
 			}
-		} else {
-			s.agent.AddRoute(route.Address, dest)
 		}
+		s.LogInfo(fmt.Sprintf("proxy(version=%d, tls=%s, balance=%s, check=%s, access=%s, bandwidth=%s, sources=%v, alpn=%v): %s%s, %s => %s",
+			route.Version, mode, route.Balance, route.Check.String(), route.TargetAccess.String(), route.TargetBandwidth.String(),
+			route.Sources, route.Alpn, route.Domain, path, route.Address, route.Targets()))
+	}
+	if !isHttp {
+		// tcpproxy读取SNI(或Host)后由dispatcher选择路由，没有读取时(如非TLS的客户端)同样由dispatcher选择；
+		// 非TLS且路由均不限域名时不读取Host，以支持服务端先发送数据的协议
+		if dispatcher.sni {
+			listener.agent.AddSNIMatchRoute(address, dispatcher.matchHost, dispatcher)
+		} else if dispatcher.hasHost() {
+			listener.agent.AddHTTPHostMatchRoute(address, dispatcher.matchHost, dispatcher)
+		}
+		listener.agent.AddRoute(address, dispatcher)
+	}
 
-		s.LogInfo(fmt.Sprintf("proxy(version=%d, tls=%v): %s%s, %s => %s",
-			route.Version, route.IsTls, route.Domain, path, route.Address, route.Targets()))
+	socket := listener.socket
+	if isHttp {
+		listener.agent = nil
+		listener.http = newHttpProxy(address, httpRoutes)
+		listener.http.SetLog(s.GetLog())
+		listener.http.traffics = s.traffics
+		listener.http.connections = s.connections
+		listener.http.onConnected = s.onConnected
+		listener.http.onDisconnected = s.onDisconnected
+		listener.http.onRejected = s.onRejected
+		go listener.http.serve(socket.attach(proxyProtocol, tlsConfig))
+	} else {
+		listener.agent.ListenFunc = func(network, laddr string) (net.Listener, error) {
+			return socket.attach(proxyProtocol, tlsConfig), nil
+		}
+		err := listener.agent.Start()
+		if err != nil {
+			if old == nil {
+				socket.Close()
+			}
+			return nil, err
+		}
 	}
 
-	s.setStatus(StatusStarting)
-	err := s.agent.Start()
-	if err != nil {
-		s.err = err
-		s.setStatus(StatusStopped)
-		s.LogError("start proxy server error:", err)
-		return err
+	// 接管端口后，原HTTP转发不再接收新请求，处理中的请求继续直到结束
+	if old != nil && old.http != nil {
+		old.http.shutdown()
 	}
-	s.err = nil
-	s.startTime = gtype.DateTime(time.Now())
-	s.setStatus(StatusRunning)
 
-	if s.isAliveChecking == false {
-		s.isAliveChecking = true
-		go s.doAliveChecking()
+	return listener, nil
+}
+
+// newUdpListener 创建UDP监听，只转发至第一个路由的目标；
+// old不为空时沿用其监听及已有会话，新会话使用新的目标
+func (s *Server) newUdpListener(address string, routes []Route, old *proxyListener) (*proxyListener, error) {
+	route := routes[0]
+	if len(routes) > 1 {
+		s.LogWarning(fmt.Sprintf("udp proxy(listen=%s): %d routes, only the first one is used", address, len(routes)))
 	}
 
-	go func() {
-		s.agent.Wait()
-		s.setStatus(StatusStopped)
-	}()
+	listener := &proxyListener{
+		address:         address,
+		routes:          routes,
+		targetAddresses: make([]*TargetAddress, 0),
+	}
+	targetAddress := s.newTargetAddress(route, old)
+	listener.targetAddresses = append(listener.targetAddresses, targetAddress)
+
+	access := []*accessControl{newAccessControl(route.Access), newAccessControl(route.TargetAccess)}
+	if old != nil && old.udp != nil {
+		listener.udp = old.udp
+		listener.udp.update(targetAddress, route.IdleTimeout, access)
+	} else {
+		udp, err := listenUdp(route.Address)
+		if err != nil {
+			return nil, err
+		}
+		udp.SetLog(s.GetLog())
+		udp.traffics = s.traffics
+		udp.onConnected = s.onConnected
+		udp.onDisconnected = s.onDisconnected
+		udp.onRejected = s.onRejected
+		udp.update(targetAddress, route.IdleTimeout, access)
+		go udp.serve()
+		listener.udp = udp
+	}
 
-	return nil
+	s.LogInfo(fmt.Sprintf("proxy(udp, balance=%s, idle=%v, access=%s): %s => %s",
+		route.Balance, route.IdleTimeout, route.Access.String(), route.Address, route.Targets()))
+
+	return listener, nil
 }
 
-func (s *Server) Stop() error {
-	if s.status != StatusRunning {
-		return fmt.Errorf("server has be %s", s.status)
+// newTargetAddress 创建路由的目标地址，沿用old中相同地址的在线状态
+func (s *Server) newTargetAddress(route Route, old *proxyListener) *TargetAddress {
+	targetAddress := &TargetAddress{
+		SourceId:        route.SourceId,
+		TargetId:        route.TargetId,
+		Balance:         route.Balance,
+		Check:           route.Check,
+		Passive:         route.IsUdp(),
+		ResolveInterval: route.ResolveInterval,
+		AliveChanged:    s.OnTargetAliveChanged,
+		CountChanged:    s.OnTargetConnCountChanged,
 	}
+	targetAddress.SetAddress(route.Target)
+	targetAddress.AddAddress(route.SpareTargets)
+	targetAddress.SetWeights(route.Weights())
+	if old != nil {
+		targetAddress.inherit(old.targetAddress(route.TargetId))
+	}
+	for _, item := range targetAddress.Items() {
+		if old != nil {
+			if oldItem, ok := old.itemAlive(item.AddrId); ok {
+				item.SetAlive(oldItem.IstAlive())
+				continue
+			}
+		}
+		if targetAddress.Passive {
+			item.SetAlive(true)
+		}
+	}
+	targetAddress.setDrains(s.drains)
+	targetAddress.doResolve(time.Now())
 
-	s.setStatus(StatusStopping)
-	s.targetAddresses = make([]*TargetAddress, 0)
-	return s.agent.Close()
+	return targetAddress
 }
 
-func (s *Server) Restart() error {
-	if s.status == StatusRunning {
-		s.setStatus(StatusStopping)
-		s.agent.Close()
+// Drain 设置目标地址(地址标识，包括其解析的所有地址)的排空状态:
+// 排空时新连接分配给其他可用地址，已有连接继续直到结束；
+// 该状态在路由更新后保持不变
+func (s *Server) Drain(addrId string, draining bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.drains == nil {
+		s.drains = make(map[string]bool)
+	}
+	if draining {
+		s.drains[addrId] = true
+	} else {
+		delete(s.drains, addrId)
 	}
 
-	for s.status != StatusStopped {
-		time.Sleep(100)
+	for _, targetAddress := range s.targetAddresses {
+		targetAddress.SetDraining(addrId, draining)
 	}
+}
 
-	return s.Start()
+// HostAlive 目标地址(地址标识)是否在线，域名或SRV记录解析的地址中有在线的地址即为在线
+func (s *Server) HostAlive(addrId string) bool {
+	s.mutex.Lock()
+	targetAddresses := s.targetAddresses
+	s.mutex.Unlock()
+
+	for _, targetAddress := range targetAddresses {
+		if alive, ok := targetAddress.HostAlive(addrId); ok {
+			return alive
+		}
+	}
+
+	return false
+}
+
+func (s *Server) setListeners(listeners map[string]*proxyListener) {
+	targetAddresses := make([]*TargetAddress, 0)
+	for _, listener := range listeners {
+		targetAddresses = append(targetAddresses, listener.targetAddresses...)
+	}
+
+	s.listeners = listeners
+	s.targetAddresses = targetAddresses
+}
+
+// groupRoutes 按监听地址分组，监听地址保持路由中的顺序；
+// UDP监听地址添加"udp/"前缀，以便与TCP监听相同的端口
+func groupRoutes(routes []Route) ([]string, map[string][]Route) {
+	addresses := make([]string, 0)
+	groups := make(map[string][]Route)
+	count := len(routes)
+	for index := 0; index < count; index++ {
+		route := routes[index]
+		if len(route.Target) < 1 {
+			continue
+		}
+
+		address := route.Address
+		if route.IsUdp() {
+			address = "udp/" + address
+		}
+		items, ok := groups[address]
+		if !ok {
+			addresses = append(addresses, address)
+		}
+		groups[address] = append(items, route)
+	}
+
+	return addresses, groups
 }
 
 func (s *Server) Result() *Result {
+	s.statusMutex.RLock()
+	defer s.statusMutex.RUnlock()
+
 	result := &Result{Status: s.status}
 	if s.status == StatusRunning {
 		result.StartTime = &s.startTime
@@ -146,45 +548,55 @@ func (s *Server) Result() *Result {
 	return result
 }
 
+// Traffics 自启动以来各服务器及目标的流量统计
+func (s *Server) Traffics() *TrafficSummary {
+	if s.traffics == nil {
+		return &TrafficSummary{
+			Servers: make([]*Traffic, 0),
+			Targets: make([]*Traffic, 0),
+		}
+	}
+
+	return s.traffics.summary()
+}
+
+func (s *Server) isRunning() bool {
+	s.statusMutex.RLock()
+	defer s.statusMutex.RUnlock()
+
+	return s.status == StatusRunning
+}
+
 func (s *Server) setStatus(status Status) {
+	s.statusMutex.Lock()
 	if s.status == status {
+		s.statusMutex.Unlock()
 		return
 	}
 	s.status = status
+	s.statusMutex.Unlock()
 
 	if s.StatusChanged != nil {
 		s.StatusChanged(status)
 	}
 }
 
-func (s *Server) onConnected(id, addr, domain, source, target string) {
+func (s *Server) onConnected(link *Link) {
 	if s.OnConnected != nil {
-		s.OnConnected(Link{
-			Id:         id,
-			Time:       gtype.DateTime(time.Now()),
-			ListenAddr: addr,
-			Domain:     domain,
-			SourceAddr: source,
-			TargetAddr: target,
-			Status:     0,
-		})
+		s.OnConnected(*link)
 	}
 }
 
-func (s *Server) onDisconnected(id, addr, domain, source, target string) {
+func (s *Server) onDisconnected(link *Link) {
 	if s.OnDisconnected != nil {
-		s.OnDisconnected(Link{
-			Id:         id,
-			Time:       gtype.DateTime(time.Now()),
-			ListenAddr: addr,
-			Domain:     domain,
-			SourceAddr: source,
-			TargetAddr: target,
-			Status:     1,
-		})
+		s.OnDisconnected(*link)
 	}
 }
 
+func (s *Server) onRejected(link *Link) {
+	s.LogWarning(fmt.Sprintf("proxy(listen=%s): %s %s", link.ListenAddr, link.SourceAddr, link.CloseReason))
+}
+
 func (s *Server) onTargetConnCountChanged(item *TargetAddressItem, increase bool) {
 	if s.OnTargetConnCountChanged != nil {
 		s.OnTargetConnCountChanged(item, increase)
@@ -198,39 +610,34 @@ func (s *Server) onTargetAliveChanged(item *TargetAddressItem) {
 }
 
 func (s *Server) isAlive(addr string) error {
-	if len(addr) < 1 {
-		return fmt.Errorf("address is empty")
-	}
-
-	timeout := 500 * time.Millisecond
-	conn, err := net.DialTimeout("tcp", addr, timeout)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
-	return nil
+	check := &HealthCheck{}
+	return check.Check(addr)
 }
 
 func (s *Server) doAliveChecking() {
 	defer func() {
 		if err := recover(); err != nil {
+			s.mutex.Lock()
 			s.isAliveChecking = false
+			s.mutex.Unlock()
 		}
 	}()
 
-	interval := 5 * time.Second
+	interval := time.Second
 	for {
 		time.Sleep(interval)
 
-		if s.status != StatusRunning {
+		if !s.isRunning() {
 			continue
 		}
 
+		now := time.Now()
+		s.mutex.Lock()
 		targetAddresses := s.targetAddresses
+		s.mutex.Unlock()
 		tc := len(targetAddresses)
 		for ti := 0; ti < tc; ti++ {
-			if s.status != StatusRunning {
+			if !s.isRunning() {
 				break
 			}
 
@@ -239,21 +646,8 @@ func (s *Server) doAliveChecking() {
 				continue
 			}
 
-			items := targetAddress.Items()
-			c := len(items)
-			for i := 0; i < c; i++ {
-				item := items[i]
-				if item == nil {
-					continue
-				}
-				err := s.isAlive(item.Addr)
-				if err != nil {
-					item.SetAlive(false)
-				} else {
-					item.SetAlive(true)
-				}
-			}
+			targetAddress.doResolve(now)
+			targetAddress.doCheck(now)
 		}
-
 	}
 }
@@ -2,6 +2,7 @@ package gproxy
 
 import (
 	"testing"
+	"time"
 )
 
 func TestServer_IsAlive(t *testing.T) {
@@ -9,3 +10,22 @@ func TestServer_IsAlive(t *testing.T) {
 	err := s.isAlive("192.168.1.1:443")
 	t.Log(err)
 }
+
+// 在线检测与启动、停止并发执行，需使用-race运行
+func TestServer_AliveChecking(t *testing.T) {
+	s := &Server{
+		Routes: []Route{
+			{Address: "127.0.0.1:0", Target: "127.0.0.1:1"},
+		},
+	}
+	deadline := time.Now().Add(1500 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		if err := s.Start(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if err := s.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package gproxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/csby/gsecurity/gcrt"
+)
+
+// Certificate TLS终止时使用的证书(PFX)
+type Certificate struct {
+	// 证书文件路径
+	File string
+	// 证书密码
+	Password string
+}
+
+// newTerminateConfig 创建TLS终止的配置，按客户端SNI自动选择证书
+func newTerminateConfig(certificates []Certificate) (*tls.Config, error) {
+	cfg := &tls.Config{
+		Certificates: make([]tls.Certificate, 0),
+		NextProtos:   []string{"http/1.1"},
+	}
+
+	c := len(certificates)
+	for i := 0; i < c; i++ {
+		item := certificates[i]
+		pfx := &gcrt.Pfx{}
+		err := pfx.FromFile(item.File, item.Password)
+		if err != nil {
+			return nil, fmt.Errorf("load certificate '%s' fail: %v", item.File, err)
+		}
+		cfg.Certificates = append(cfg.Certificates, pfx.TlsCertificates()...)
+	}
+	if len(cfg.Certificates) < 1 {
+		return nil, fmt.Errorf("certificate is empty")
+	}
+
+	return cfg, nil
+}
+
+// newEncryptConfig 创建重新加密连接目标的配置
+func newEncryptConfig(serverName string, skipVerify bool) *tls.Config {
+	return &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: skipVerify,
+	}
+}
@@ -0,0 +1,69 @@
+package gproxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSocketListener_Terminate(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	socket, err := listenSocket("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	ln := socket.attach(nil, &tls.Config{Certificates: ts.TLS.Certificates})
+
+	go func() {
+		conn, err := tls.Dial("tcp", socket.ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("hello"))
+	}()
+
+	conn := acceptTimeout(t, ln)
+	defer conn.Close()
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Fatal("plaintext:", string(buf), err)
+	}
+}
+
+func TestTargetProxy_Encrypt(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer ts.Close()
+
+	address := &TargetAddress{SourceId: "s", TargetId: "t"}
+	address.SetAddress(ts.Listener.Addr().String())
+	dp := &TargetProxy{
+		Address:   address,
+		TargetTls: newEncryptConfig("", true),
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go dp.HandleConn(server, ":443", "test.com")
+
+	go io.WriteString(client, "GET / HTTP/1.1\r\nHost: test.com\r\nConnection: close\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Fatal("response:", resp.StatusCode, string(body))
+	}
+}
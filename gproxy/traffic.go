@@ -0,0 +1,165 @@
+package gproxy
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Traffic 流量统计
+type Traffic struct {
+	Id          string `json:"id" note:"标识ID（服务器或目标）"`
+	Connections int64  `json:"connections" note:"累计连接数"`
+	Actives     int64  `json:"actives" note:"当前连接数"`
+	BytesIn     int64  `json:"bytesIn" note:"传入字节数（客户端至目标）"`
+	BytesOut    int64  `json:"bytesOut" note:"传出字节数（目标至客户端）"`
+	Rejects     int64  `json:"rejects" note:"拒绝连接数（访问控制）"`
+}
+
+func (s *Traffic) snapshot() *Traffic {
+	return &Traffic{
+		Id:          s.Id,
+		Connections: atomic.LoadInt64(&s.Connections),
+		Actives:     atomic.LoadInt64(&s.Actives),
+		BytesIn:     atomic.LoadInt64(&s.BytesIn),
+		BytesOut:    atomic.LoadInt64(&s.BytesOut),
+		Rejects:     atomic.LoadInt64(&s.Rejects),
+	}
+}
+
+// TrafficSummary 服务器及目标的流量统计
+type TrafficSummary struct {
+	Servers []*Traffic `json:"servers" note:"服务器（监听端口），标识ID为服务器ID"`
+	Targets []*Traffic `json:"targets" note:"目标，标识ID为目标ID"`
+}
+
+type trafficCollection struct {
+	sync.RWMutex
+
+	servers map[string]*Traffic
+	targets map[string]*Traffic
+}
+
+func newTrafficCollection() *trafficCollection {
+	return &trafficCollection{
+		servers: make(map[string]*Traffic),
+		targets: make(map[string]*Traffic),
+	}
+}
+
+func (s *trafficCollection) get(items map[string]*Traffic, id string) *Traffic {
+	s.RLock()
+	item, ok := items[id]
+	s.RUnlock()
+	if ok {
+		return item
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	item, ok = items[id]
+	if !ok {
+		item = &Traffic{Id: id}
+		items[id] = item
+	}
+
+	return item
+}
+
+// newLink 创建连接的流量计数，同时累计到所属服务器及目标
+func (s *trafficCollection) newLink(sourceId, targetId string) *linkTraffic {
+	return &linkTraffic{
+		parents: []*Traffic{
+			s.get(s.servers, sourceId),
+			s.get(s.targets, targetId),
+		},
+	}
+}
+
+// reject 累计所属服务器及目标的拒绝连接数
+func (s *trafficCollection) reject(sourceId, targetId string) {
+	atomic.AddInt64(&s.get(s.servers, sourceId).Rejects, 1)
+	atomic.AddInt64(&s.get(s.targets, targetId).Rejects, 1)
+}
+
+func (s *trafficCollection) summary() *TrafficSummary {
+	s.RLock()
+	defer s.RUnlock()
+
+	return &TrafficSummary{
+		Servers: trafficSnapshots(s.servers),
+		Targets: trafficSnapshots(s.targets),
+	}
+}
+
+func trafficSnapshots(items map[string]*Traffic) []*Traffic {
+	results := make([]*Traffic, 0, len(items))
+	for _, v := range items {
+		results = append(results, v.snapshot())
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Id < results[j].Id
+	})
+
+	return results
+}
+
+type linkTraffic struct {
+	bytesIn  int64
+	bytesOut int64
+
+	parents []*Traffic
+}
+
+func (s *linkTraffic) open() {
+	if s == nil {
+		return
+	}
+	for _, p := range s.parents {
+		atomic.AddInt64(&p.Connections, 1)
+		atomic.AddInt64(&p.Actives, 1)
+	}
+}
+
+func (s *linkTraffic) shut() {
+	if s == nil {
+		return
+	}
+	for _, p := range s.parents {
+		atomic.AddInt64(&p.Actives, -1)
+	}
+}
+
+func (s *linkTraffic) addIn(n int64) {
+	if s == nil || n == 0 {
+		return
+	}
+	atomic.AddInt64(&s.bytesIn, n)
+	for _, p := range s.parents {
+		atomic.AddInt64(&p.BytesIn, n)
+	}
+}
+
+func (s *linkTraffic) addOut(n int64) {
+	if s == nil || n == 0 {
+		return
+	}
+	atomic.AddInt64(&s.bytesOut, n)
+	for _, p := range s.parents {
+		atomic.AddInt64(&p.BytesOut, n)
+	}
+}
+
+func (s *linkTraffic) in() int64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&s.bytesIn)
+}
+
+func (s *linkTraffic) out() int64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&s.bytesOut)
+}
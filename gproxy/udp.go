@@ -0,0 +1,351 @@
+package gproxy
+
+import (
+	"fmt"
+	"github.com/csby/gwsf/gtype"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// udpProxy UDP转发，按客户端地址建立会话，
+// 每个会话使用独立的套接字连接目标，空闲超时后关闭
+type udpProxy struct {
+	gtype.Base
+	sync.RWMutex
+
+	address     string
+	conn        *net.UDPConn
+	target      *TargetAddress
+	idleTimeout time.Duration
+	access      []*accessControl
+	sessions    map[string]*udpSession
+	closed      bool
+
+	traffics       *trafficCollection
+	onConnected    func(link *Link)
+	onDisconnected func(link *Link)
+	onRejected     func(link *Link)
+}
+
+func listenUdp(address string) (*udpProxy, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &udpProxy{
+		address:  address,
+		conn:     conn,
+		sessions: make(map[string]*udpSession),
+	}, nil
+}
+
+// update 更新目标及访问控制，已有会话保持原目标直到结束
+func (s *udpProxy) update(target *TargetAddress, idleTimeout time.Duration, access []*accessControl) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.target = target
+	s.idleTimeout = idleTimeout
+	s.access = access
+}
+
+func (s *udpProxy) serve() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if s.isClosed() {
+				return
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			s.Close()
+			return
+		}
+
+		session := s.getSession(addr)
+		if session == nil {
+			continue
+		}
+		session.forward(buf[:n])
+	}
+}
+
+func (s *udpProxy) isClosed() bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.closed
+}
+
+func (s *udpProxy) getSession(addr *net.UDPAddr) *udpSession {
+	key := addr.String()
+	s.RLock()
+	session, ok := s.sessions[key]
+	target := s.target
+	idleTimeout := s.idleTimeout
+	access := s.access
+	s.RUnlock()
+	if ok {
+		return session
+	}
+	if target == nil {
+		return nil
+	}
+
+	releases := make([]func(), 0, len(access))
+	release := func() {
+		for _, v := range releases {
+			v()
+		}
+	}
+	for _, v := range access {
+		r, reason := v.acquire(addr)
+		if len(reason) > 0 {
+			release()
+			s.reject(target, key, reason)
+			return nil
+		}
+		releases = append(releases, r)
+	}
+
+	item, conn, err := s.dial(target, addr.IP.String())
+	if err != nil {
+		release()
+		return nil
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = time.Minute
+	}
+
+	link := &Link{
+		Id:         newGuid(),
+		Time:       gtype.DateTime(time.Now()),
+		Protocol:   ProtocolUdp,
+		ListenAddr: s.address,
+		SourceAddr: key,
+		TargetAddr: item.Addr,
+		Status:     0,
+		SourceId:   target.SourceId,
+		TargetId:   target.TargetId,
+		start:      time.Now(),
+	}
+	if s.traffics != nil {
+		link.traffic = s.traffics.newLink(link.SourceId, link.TargetId)
+	} else {
+		link.traffic = &linkTraffic{}
+	}
+	session = &udpSession{
+		key:         key,
+		proxy:       s,
+		client:      addr,
+		conn:        conn,
+		item:        item,
+		link:        link,
+		release:     release,
+		idleTimeout: idleTimeout,
+		active:      time.Now().UnixNano(),
+	}
+
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		conn.Close()
+		release()
+		return nil
+	}
+	s.sessions[key] = session
+	s.Unlock()
+
+	item.IncreaseCount()
+	link.traffic.open()
+	if s.onConnected != nil {
+		connected := *link
+		go s.onConnected(&connected)
+	}
+	go session.serve()
+
+	return session
+}
+
+// dial 连接按负载均衡策略选择的目标地址，出错时依次尝试其他地址
+func (s *udpProxy) dial(target *TargetAddress, source string) (*TargetAddressItem, *net.UDPConn, error) {
+	selected := target.SelectAddress(source)
+	if selected == nil {
+		return nil, nil, fmt.Errorf("target address is empty")
+	}
+
+	items := []*TargetAddressItem{selected}
+	for _, item := range target.Items() {
+		if item != nil && item != selected && !item.IsDraining() {
+			items = append(items, item)
+		}
+	}
+
+	var err error = nil
+	for _, item := range items {
+		var conn *net.UDPConn
+		conn, err = dialUdp(item.Addr)
+		if err == nil {
+			return item, conn, nil
+		}
+		item.markFailed(err)
+		s.LogError(fmt.Sprintf("udp proxy(listen=%s): dial %s error: %v", s.address, item.Addr, err))
+	}
+
+	return nil, nil, err
+}
+
+func (s *udpProxy) reject(target *TargetAddress, source, reason string) {
+	if s.traffics != nil {
+		s.traffics.reject(target.SourceId, target.TargetId)
+	}
+	if s.onRejected != nil {
+		go s.onRejected(&Link{
+			Id:          newGuid(),
+			Time:        gtype.DateTime(time.Now()),
+			Protocol:    ProtocolUdp,
+			ListenAddr:  s.address,
+			SourceAddr:  source,
+			Status:      1,
+			SourceId:    target.SourceId,
+			TargetId:    target.TargetId,
+			CloseReason: "rejected: " + reason,
+		})
+	}
+}
+
+func dialUdp(address string) (*net.UDPConn, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return net.DialUDP("udp", nil, addr)
+}
+
+func (s *udpProxy) removeSession(session *udpSession) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.sessions[session.key] == session {
+		delete(s.sessions, session.key)
+	}
+}
+
+// Close 停止监听并关闭所有会话
+func (s *udpProxy) Close() error {
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		return nil
+	}
+	s.closed = true
+	sessions := make([]*udpSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.Unlock()
+
+	err := s.conn.Close()
+	for _, session := range sessions {
+		session.close("server stopped")
+	}
+
+	return err
+}
+
+type udpSession struct {
+	key         string
+	proxy       *udpProxy
+	client      *net.UDPAddr
+	conn        *net.UDPConn
+	item        *TargetAddressItem
+	link        *Link
+	release     func()
+	idleTimeout time.Duration
+
+	// 最后活动时间(UnixNano)
+	active  int64
+	closing int32
+	once    sync.Once
+}
+
+// forward 转发客户端数据至目标
+func (s *udpSession) forward(data []byte) {
+	atomic.StoreInt64(&s.active, time.Now().UnixNano())
+	n, err := s.conn.Write(data)
+	s.link.traffic.addIn(int64(n))
+	if err != nil {
+		s.fail(err)
+	}
+}
+
+// serve 转发目标数据至客户端，直到空闲超时或出错
+func (s *udpSession) serve() {
+	buf := make([]byte, 64*1024)
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		n, err := s.conn.Read(buf)
+		if err != nil {
+			if atomic.LoadInt32(&s.closing) != 0 {
+				return
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				active := time.Unix(0, atomic.LoadInt64(&s.active))
+				if time.Now().Sub(active) < s.idleTimeout {
+					continue
+				}
+				s.close("idle timeout")
+				return
+			}
+			s.fail(err)
+			return
+		}
+
+		atomic.StoreInt64(&s.active, time.Now().UnixNano())
+		n, err = s.proxy.conn.WriteToUDP(buf[:n], s.client)
+		s.link.traffic.addOut(int64(n))
+		if err != nil {
+			s.close(fmt.Sprintf("client error: %v", err))
+			return
+		}
+	}
+}
+
+// fail 目标出错(如端口不可达)，标记目标离线并关闭会话
+func (s *udpSession) fail(err error) {
+	if atomic.LoadInt32(&s.closing) != 0 {
+		return
+	}
+	s.item.markFailed(err)
+	s.close(fmt.Sprintf("target error: %v", err))
+}
+
+func (s *udpSession) close(reason string) {
+	s.once.Do(func() {
+		atomic.StoreInt32(&s.closing, 1)
+		s.conn.Close()
+		s.proxy.removeSession(s)
+		s.item.DecreaseCount()
+		s.release()
+
+		link := s.link
+		link.traffic.shut()
+		link.Time = gtype.DateTime(time.Now())
+		link.Status = 1
+		link.CloseReason = reason
+		link.refresh()
+		if s.proxy.onDisconnected != nil {
+			go s.proxy.onDisconnected(link)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package gproxy
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUdpProxy(t *testing.T) {
+	echo, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := echo.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteToUDP(buf[:n], addr)
+		}
+	}()
+
+	proxy, err := listenUdp("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+	links := make(chan *Link, 1)
+	proxy.onDisconnected = func(link *Link) { links <- link }
+	address := &TargetAddress{SourceId: "s", TargetId: "t", Passive: true}
+	address.SetAddress(echo.LocalAddr().String())
+	proxy.update(address, 300*time.Millisecond, nil)
+	go proxy.serve()
+
+	client, err := net.DialUDP("udp", nil, proxy.conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 16)
+	for _, v := range []string{"hello", "world"} {
+		client.Write([]byte(v))
+		n, err := client.Read(buf)
+		if err != nil || string(buf[:n]) != v {
+			t.Fatal("echo:", string(buf[:n]), err)
+		}
+	}
+
+	select {
+	case link := <-links:
+		if link.Protocol != ProtocolUdp || link.BytesIn != 10 || link.BytesOut != 10 {
+			t.Fatal("link:", link.Protocol, link.BytesIn, link.BytesOut)
+		}
+		if link.CloseReason != "idle timeout" {
+			t.Fatal("close reason:", link.CloseReason)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("idle timeout expected")
+	}
+}
@@ -0,0 +1,110 @@
+package grouter
+
+import (
+	"github.com/csby/gwsf/gtype"
+	"net/http"
+)
+
+// Group returns a sub-router, the routes registered by which share the path
+// prefix, the document and the middlewares of the group.
+// The middlewares of the group wrap the middlewares of each route.
+func (s *Router) Group(prefix string, middlewares ...gtype.Middleware) gtype.Router {
+	return &group{
+		router:      s,
+		prefix:      prefix,
+		middlewares: middlewares,
+	}
+}
+
+type group struct {
+	router      *Router
+	prefix      string
+	middlewares []gtype.Middleware
+}
+
+func (s *group) Group(prefix string, middlewares ...gtype.Middleware) gtype.Router {
+	return &group{
+		router:      s.router,
+		prefix:      s.prefix + prefix,
+		middlewares: s.join(middlewares),
+	}
+}
+
+// Use adds the middlewares of the group,
+// which apply to the routes registered after.
+func (s *group) Use(middlewares ...gtype.Middleware) {
+	s.middlewares = s.join(middlewares)
+}
+
+func (s *group) GET(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
+	s.Handle(http.MethodGet, uri, preHandle, httpHandle, docHandle, middlewares...)
+}
+
+func (s *group) HEAD(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
+	s.Handle(http.MethodHead, uri, preHandle, httpHandle, docHandle, middlewares...)
+}
+
+func (s *group) OPTIONS(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
+	s.Handle(http.MethodOptions, uri, preHandle, httpHandle, docHandle, middlewares...)
+}
+
+func (s *group) POST(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
+	s.Handle(http.MethodPost, uri, preHandle, httpHandle, docHandle, middlewares...)
+}
+
+func (s *group) PUT(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
+	s.Handle(http.MethodPut, uri, preHandle, httpHandle, docHandle, middlewares...)
+}
+
+func (s *group) PATCH(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
+	s.Handle(http.MethodPatch, uri, preHandle, httpHandle, docHandle, middlewares...)
+}
+
+func (s *group) DELETE(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
+	s.Handle(http.MethodDelete, uri, preHandle, httpHandle, docHandle, middlewares...)
+}
+
+// Handle registers the handle with the prefixed path, and the middlewares
+// of the group followed by the middlewares of the route.
+func (s *group) Handle(method string, uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
+	s.router.Handle(method, s.uri(uri), preHandle, httpHandle, docHandle, s.join(middlewares)...)
+}
+
+func (s *group) ServeFiles(uri gtype.Uri, preHandle gtype.HttpHandle, root http.FileSystem, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
+	s.router.ServeFiles(s.uri(uri), preHandle, root, docHandle, s.join(middlewares)...)
+}
+
+func (s *group) Document() gtype.Doc {
+	return s.router.Document()
+}
+
+func (s *group) uri(uri gtype.Uri) gtype.Uri {
+	if len(s.prefix) < 1 || uri == nil {
+		return uri
+	}
+
+	return &groupUri{
+		Uri:  uri,
+		path: s.prefix + uri.Path(),
+	}
+}
+
+// join returns a new slice of the middlewares of the group followed by the middlewares.
+func (s *group) join(middlewares []gtype.Middleware) []gtype.Middleware {
+	items := make([]gtype.Middleware, 0, len(s.middlewares)+len(middlewares))
+	items = append(items, s.middlewares...)
+	items = append(items, middlewares...)
+
+	return items
+}
+
+// groupUri is the uri with the path prefix of the group.
+type groupUri struct {
+	gtype.Uri
+
+	path string
+}
+
+func (s *groupUri) Path() string {
+	return s.path
+}
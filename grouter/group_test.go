@@ -0,0 +1,108 @@
+package grouter
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGroup_Prefix(t *testing.T) {
+	router := New()
+	api := router.Group("/api")
+	api.GET(testUri("/users"), nil, testHandle("users"), nil)
+	api.GET(testUri("/users/:id"), nil, testHandle("user"), nil)
+	router.GET(testUri("/users"), nil, testHandle("root"), nil)
+
+	tests := map[string]string{
+		"/api/users":   "users",
+		"/api/users/7": "user:7",
+		"/users":       "root",
+	}
+	for path, want := range tests {
+		w := serve(router, http.MethodGet, path)
+		if w.Body.String() != want {
+			t.Errorf("%s: body = %q, want %q", path, w.Body.String(), want)
+		}
+	}
+	if w := serve(router, http.MethodGet, "/api"); w.Code != http.StatusNotFound {
+		t.Error("group prefix should not be routed:", w.Code)
+	}
+}
+
+func TestGroup_Nested(t *testing.T) {
+	router := New()
+	router.Use(testMiddleware("global"))
+	api := router.Group("/api", testMiddleware("api"))
+	v1 := api.Group("/v1", testMiddleware("v1"))
+	v1.GET(testUri("/items"), nil, testHandle("items"), nil, testMiddleware("route"))
+	api.Use(testMiddleware("late"))
+	api.GET(testUri("/status"), nil, testHandle("status"), nil)
+
+	tests := map[string]string{
+		"/api/v1/items": "global>api>v1>route>items",
+		"/api/status":   "global>api>late>status",
+	}
+	for path, want := range tests {
+		w := serve(router, http.MethodGet, path)
+		if w.Body.String() != want {
+			t.Errorf("%s: body = %q, want %q", path, w.Body.String(), want)
+		}
+	}
+}
+
+func TestGroup_Methods(t *testing.T) {
+	router := New()
+	g := router.Group("/api")
+	g.PUT(testUri("/item"), nil, testHandle("put"), nil)
+	g.PATCH(testUri("/item"), nil, testHandle("patch"), nil)
+	g.DELETE(testUri("/item"), nil, testHandle("delete"), nil)
+	g.HEAD(testUri("/item"), nil, testHandle("head"), nil)
+	g.OPTIONS(testUri("/item"), nil, testHandle("options"), nil)
+	g.POST(testUri("/item"), nil, testHandle("post"), nil)
+	g.GET(testUri("/item"), nil, testHandle("get"), nil)
+
+	tests := map[string]string{
+		http.MethodPut:     "put",
+		http.MethodPatch:   "patch",
+		http.MethodDelete:  "delete",
+		http.MethodHead:    "head",
+		http.MethodOptions: "options",
+		http.MethodPost:    "post",
+		http.MethodGet:     "get",
+	}
+	for method, want := range tests {
+		w := serve(router, method, "/api/item")
+		if w.Body.String() != want {
+			t.Errorf("%s: body = %q, want %q", method, w.Body.String(), want)
+		}
+	}
+}
+
+func TestRouter_Methods(t *testing.T) {
+	router := New()
+	router.PUT(testUri("/item"), nil, testHandle("put"), nil)
+	router.PATCH(testUri("/item"), nil, testHandle("patch"), nil)
+	router.DELETE(testUri("/item"), nil, testHandle("delete"), nil)
+	router.HEAD(testUri("/item"), nil, testHandle("head"), nil)
+
+	tests := map[string]string{
+		http.MethodPut:    "put",
+		http.MethodPatch:  "patch",
+		http.MethodDelete: "delete",
+		http.MethodHead:   "head",
+	}
+	for method, want := range tests {
+		w := serve(router, method, "/item")
+		if w.Body.String() != want {
+			t.Errorf("%s: body = %q, want %q", method, w.Body.String(), want)
+		}
+	}
+
+	w := serve(router, http.MethodPost, "/item")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Error("post:", w.Code)
+	}
+	w = serve(router, http.MethodOptions, "/item")
+	if allow := w.Header().Get("Allow"); allow != "DELETE, HEAD, OPTIONS, PATCH, PUT" {
+		t.Error("allow:", allow)
+	}
+}
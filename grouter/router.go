@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // Handle is a function that can be registered to a route to handle HTTP
@@ -86,6 +87,24 @@ type Router struct {
 
 	// Document
 	Doc gtype.Doc
+
+	// global middlewares, see Use
+	middlewares []gtype.Middleware
+	// registered routes, recomposed with the global middlewares by Use
+	routes []*route
+	mutex  sync.Mutex
+}
+
+// route is a registered route. The chain is the handle wrapped by the global
+// middlewares, composed at registration and recomposed by Use, so that Serve
+// does not build the chain per request.
+type route struct {
+	handle gtype.HttpHandle
+	chain  atomic.Value // gtype.HttpHandle
+}
+
+func (r *route) serve(ctx gtype.Context, ps gtype.Params) {
+	r.chain.Load().(gtype.HttpHandle)(ctx, ps)
 }
 
 // New returns a new initialized Router.
@@ -116,38 +135,38 @@ func (s *Router) putParams(ps *gtype.Params) {
 }
 
 // GET is a shortcut for router.Handle(http.MethodGet, path, handle)
-func (s *Router) GET(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle) {
-	s.Handle(http.MethodGet, uri, preHandle, httpHandle, docHandle)
+func (s *Router) GET(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
+	s.Handle(http.MethodGet, uri, preHandle, httpHandle, docHandle, middlewares...)
 }
 
 // HEAD is a shortcut for router.Handle(http.MethodHead, path, handle)
-func (s *Router) HEAD(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle) {
-	s.Handle(http.MethodHead, uri, preHandle, httpHandle, docHandle)
+func (s *Router) HEAD(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
+	s.Handle(http.MethodHead, uri, preHandle, httpHandle, docHandle, middlewares...)
 }
 
 // OPTIONS is a shortcut for router.Handle(http.MethodOptions, path, handle)
-func (s *Router) OPTIONS(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle) {
-	s.Handle(http.MethodOptions, uri, preHandle, httpHandle, docHandle)
+func (s *Router) OPTIONS(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
+	s.Handle(http.MethodOptions, uri, preHandle, httpHandle, docHandle, middlewares...)
 }
 
 // POST is a shortcut for router.Handle(http.MethodPost, path, handle)
-func (s *Router) POST(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle) {
-	s.Handle(http.MethodPost, uri, preHandle, httpHandle, docHandle)
+func (s *Router) POST(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
+	s.Handle(http.MethodPost, uri, preHandle, httpHandle, docHandle, middlewares...)
 }
 
 // PUT is a shortcut for router.Handle(http.MethodPut, path, handle)
-func (s *Router) PUT(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle) {
-	s.Handle(http.MethodPut, uri, preHandle, httpHandle, docHandle)
+func (s *Router) PUT(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
+	s.Handle(http.MethodPut, uri, preHandle, httpHandle, docHandle, middlewares...)
 }
 
 // PATCH is a shortcut for router.Handle(http.MethodPatch, path, handle)
-func (s *Router) PATCH(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle) {
-	s.Handle(http.MethodPatch, uri, preHandle, httpHandle, docHandle)
+func (s *Router) PATCH(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
+	s.Handle(http.MethodPatch, uri, preHandle, httpHandle, docHandle, middlewares...)
 }
 
 // DELETE is a shortcut for router.Handle(http.MethodDelete, path, handle)
-func (s *Router) DELETE(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle) {
-	s.Handle(http.MethodDelete, uri, preHandle, httpHandle, docHandle)
+func (s *Router) DELETE(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
+	s.Handle(http.MethodDelete, uri, preHandle, httpHandle, docHandle, middlewares...)
 }
 
 // Handle registers a new request handle with the given path and method.
@@ -158,7 +177,9 @@ func (s *Router) DELETE(uri gtype.Uri, preHandle, httpHandle gtype.HttpHandle, d
 // This function is intended for bulk loading and to allow the usage of less
 // frequently used, non-standardized or custom methods (e.g. for internal
 // communication with a proxy).
-func (s *Router) Handle(method string, uri gtype.Uri, before, handle gtype.HttpHandle, docHandle gtype.DocHandle) {
+//
+// The middlewares wrap the before and the handle, inside the global middlewares.
+func (s *Router) Handle(method string, uri gtype.Uri, before, handle gtype.HttpHandle, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
 	varsCount := uint16(0)
 
 	if method == "" {
@@ -184,7 +205,13 @@ func (s *Router) Handle(method string, uri gtype.Uri, before, handle gtype.HttpH
 		s.globalAllowed = s.allowed("*", "")
 	}
 
-	root.addRoute(path, handle, before)
+	r := &route{handle: gtype.ChainMiddlewares(joinHandle(before, handle), middlewares...)}
+	root.addRoute(path, r.serve, nil)
+
+	s.mutex.Lock()
+	r.chain.Store(gtype.ChainMiddlewares(r.handle, s.middlewares...))
+	s.routes = append(s.routes, r)
+	s.mutex.Unlock()
 
 	// Update maxParams
 	if paramsCount := countParams(path); paramsCount+varsCount > s.maxParams {
@@ -203,6 +230,7 @@ func (s *Router) Handle(method string, uri gtype.Uri, before, handle gtype.HttpH
 	if docHandle != nil {
 		if s.Doc != nil {
 			if s.Doc.Enable() {
+				s.Doc.SetMiddlewares(method, uri, middlewares)
 				docHandle(s.Doc, method, uri)
 				s.Doc.Log(docHandle, method, uri)
 			}
@@ -221,7 +249,7 @@ func (s *Router) Handle(method string, uri gtype.Uri, before, handle gtype.HttpH
 // use http.Dir:
 //
 //	router.ServeFiles("/src/*filepath", http.Dir("/var/www"))
-func (s *Router) ServeFiles(uri gtype.Uri, preHandle gtype.HttpHandle, root http.FileSystem, docHandle gtype.DocHandle) {
+func (s *Router) ServeFiles(uri gtype.Uri, preHandle gtype.HttpHandle, root http.FileSystem, docHandle gtype.DocHandle, middlewares ...gtype.Middleware) {
 	path := uri.Path()
 	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
 		panic("path must end with /*filepath in path '" + path + "'")
@@ -258,7 +286,36 @@ func (s *Router) ServeFiles(uri gtype.Uri, preHandle gtype.HttpHandle, root http
 
 		fileServer := http.FileServer(root)
 		fileServer.ServeHTTP(w, req)
-	}, docHandle)
+	}, docHandle, middlewares...)
+}
+
+// Use adds the global middlewares, which apply to all routes (including the
+// routes registered before) and wrap the middlewares of groups and routes.
+func (s *Router) Use(middlewares ...gtype.Middleware) {
+	s.mutex.Lock()
+	s.middlewares = append(s.middlewares, middlewares...)
+	for _, r := range s.routes {
+		r.chain.Store(gtype.ChainMiddlewares(r.handle, s.middlewares...))
+	}
+	s.mutex.Unlock()
+
+	if s.Doc != nil {
+		s.Doc.UseMiddlewares(middlewares...)
+	}
+}
+
+// joinHandle returns the handle calling before and then handle,
+// unless the request is handled already.
+func joinHandle(before, handle gtype.HttpHandle) gtype.HttpHandle {
+	return func(ctx gtype.Context, ps gtype.Params) {
+		if before != nil {
+			before(ctx, ps)
+		}
+		if ctx.IsHandled() {
+			return
+		}
+		handle(ctx, ps)
+	}
 }
 
 func (s *Router) recv(w http.ResponseWriter, req *http.Request) {
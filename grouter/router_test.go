@@ -0,0 +1,125 @@
+package grouter
+
+import (
+	"github.com/csby/gwsf/gtype"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testContext 仅实现路由使用的方法
+type testContext struct {
+	gtype.Context
+
+	w       http.ResponseWriter
+	r       *http.Request
+	handled bool
+}
+
+func (s *testContext) Request() *http.Request {
+	return s.r
+}
+
+func (s *testContext) Response() http.ResponseWriter {
+	return s.w
+}
+
+func (s *testContext) SetHandled(v bool) {
+	s.handled = v
+}
+
+func (s *testContext) IsHandled() bool {
+	return s.handled
+}
+
+func serve(router *Router, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.Serve(&testContext{w: w, r: httptest.NewRequest(method, path, nil)})
+
+	return w
+}
+
+func testUri(path string) gtype.Uri {
+	return (&gtype.Path{}).Uri(path)
+}
+
+// testMiddleware 在响应中依次记录中间件名称
+func testMiddleware(name string) gtype.Middleware {
+	return gtype.NewMiddleware(name, "", func(next gtype.HttpHandle) gtype.HttpHandle {
+		return func(ctx gtype.Context, ps gtype.Params) {
+			ctx.Response().Write([]byte(name + ">"))
+			next(ctx, ps)
+		}
+	})
+}
+
+func testHandle(name string) gtype.HttpHandle {
+	return func(ctx gtype.Context, ps gtype.Params) {
+		ctx.Response().Write([]byte(name))
+		for _, p := range ps {
+			ctx.Response().Write([]byte(":" + p.Value))
+		}
+	}
+}
+
+func TestRouter_Use(t *testing.T) {
+	router := New()
+	router.GET(testUri("/before"), nil, testHandle("before"), nil, testMiddleware("route"))
+	router.Use(testMiddleware("g1"))
+	router.Use(testMiddleware("g2"))
+	router.GET(testUri("/after"), nil, testHandle("after"), nil)
+
+	tests := map[string]string{
+		"/before": "g1>g2>route>before",
+		"/after":  "g1>g2>after",
+	}
+	for path, want := range tests {
+		w := serve(router, http.MethodGet, path)
+		if w.Body.String() != want {
+			t.Errorf("%s: body = %q, want %q", path, w.Body.String(), want)
+		}
+	}
+}
+
+func TestRouter_PreHandle(t *testing.T) {
+	router := New()
+	router.Use(testMiddleware("g"))
+	router.GET(testUri("/deny"), func(ctx gtype.Context, ps gtype.Params) {
+		ctx.Response().Write([]byte("deny"))
+		ctx.SetHandled(true)
+	}, testHandle("handle"), nil, testMiddleware("route"))
+
+	w := serve(router, http.MethodGet, "/deny")
+	if w.Body.String() != "g>route>deny" {
+		t.Fatal("body:", w.Body.String())
+	}
+}
+
+func TestRouter_UseConcurrent(t *testing.T) {
+	router := New()
+	router.GET(testUri("/item/:id"), nil, testHandle("item"), nil)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			router.Use(gtype.NewMiddleware("nop", "", func(next gtype.HttpHandle) gtype.HttpHandle {
+				return next
+			}))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			w := serve(router, http.MethodGet, "/item/1")
+			if !strings.HasSuffix(w.Body.String(), "item:1") {
+				t.Error("body:", w.Body.String())
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,82 @@
+package gserver
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/csby/gwsf/gcfg"
+	"github.com/csby/gwsf/gtype"
+	"io"
+	"net/http"
+)
+
+const (
+	defaultCompressionThreshold = 1024
+)
+
+var defaultCompressionEncodings = []string{
+	gtype.EncodingBrotli,
+	gtype.EncodingGzip,
+	gtype.EncodingDeflate,
+}
+
+// compression 接口响应压缩
+type compression struct {
+	threshold int // 全局压缩阈值, 小于0表示不压缩
+	encodings []string
+}
+
+func newCompression(cfg *gcfg.Compression) *compression {
+	instance := &compression{
+		threshold: -1,
+		encodings: defaultCompressionEncodings,
+	}
+	if cfg == nil {
+		return instance
+	}
+
+	if cfg.Enabled {
+		instance.threshold = cfg.Threshold
+		if instance.threshold <= 0 {
+			instance.threshold = defaultCompressionThreshold
+		}
+	}
+	if len(cfg.Encodings) > 0 {
+		instance.encodings = cfg.Encodings
+	}
+
+	return instance
+}
+
+// writer 根据Accept-Encoding设置压缩头部并返回压缩输出, 不压缩时返回nil
+func (s *compression) writer(w http.ResponseWriter, r *http.Request, threshold, size int) io.WriteCloser {
+	if threshold < 0 || r == nil {
+		return nil
+	}
+	header := w.Header()
+	if len(header.Get("Content-Encoding")) > 0 {
+		return nil
+	}
+	header.Add("Vary", "Accept-Encoding")
+	if size < threshold {
+		return nil
+	}
+
+	encoding := gtype.NegotiateEncoding(r.Header.Get("Accept-Encoding"), s.encodings)
+	var writer io.WriteCloser
+	switch encoding {
+	case gtype.EncodingBrotli:
+		writer = brotli.NewWriterLevel(w, brotli.DefaultCompression)
+	case gtype.EncodingGzip:
+		writer, _ = gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	case gtype.EncodingDeflate:
+		writer, _ = flate.NewWriter(w, flate.DefaultCompression)
+	default:
+		return nil
+	}
+
+	header.Set("Content-Encoding", encoding)
+	header.Del("Content-Length")
+
+	return writer
+}
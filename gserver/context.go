@@ -1,10 +1,13 @@
 package gserver
 
 import (
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"github.com/csby/gwsf/gtype"
+	"github.com/vmihailenco/msgpack/v5"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -23,6 +26,8 @@ type context struct {
 	instance    string
 	forwardFrom string
 	handled     bool
+	corsEnabled bool
+	compression *compression
 
 	certificate  gtype.Certificate
 	queries      gtype.QueryCollection
@@ -134,16 +139,25 @@ func (s *context) GetSoapAction() string {
 	return ""
 }
 
+// allowAnyOrigin 未启用跨域访问策略时允许任意来源, 启用时由策略输出跨域头部
+func (s *context) allowAnyOrigin() {
+	if s.corsEnabled {
+		return
+	}
+
+	s.response.Header().Add("Access-Control-Allow-Origin", "*")
+}
+
 func (s *context) OutputJson(v interface{}) {
 	s.outputFormat = gtype.ArgsFmtJson
 	data, err := json.Marshal(v)
 	if err != nil {
 		fmt.Fprint(s.response, err)
 	} else {
-		s.response.Header().Add("Access-Control-Allow-Origin", "*")
+		s.allowAnyOrigin()
 		s.response.Header().Set("Content-Type", "application/json;charset=utf-8")
-		s.response.Write(data)
 		s.output = data
+		s.write(data)
 	}
 
 }
@@ -172,10 +186,10 @@ func (s *context) OutputXml(v interface{}) {
 		}
 	}
 
-	s.response.Header().Add("Access-Control-Allow-Origin", "*")
+	s.allowAnyOrigin()
 	s.response.Header().Set("Content-Type", "application/xml;charset=utf-8")
 	if len(s.output) > 0 {
-		s.response.Write(s.output)
+		s.write(s.output)
 	}
 }
 
@@ -203,10 +217,102 @@ func (s *context) OutputSoap(v interface{}) {
 		}
 	}
 
-	s.response.Header().Add("Access-Control-Allow-Origin", "*")
+	s.allowAnyOrigin()
 	s.response.Header().Set("Content-Type", "application/soap+xml; charset=utf-8")
 	if len(s.output) > 0 {
-		s.response.Write(s.output)
+		s.write(s.output)
+	}
+}
+
+func (s *context) OutputMsgPack(v interface{}) {
+	s.outputFormat = gtype.ArgsFmtMsgPack
+	if s.response == nil {
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := msgpack.NewEncoder(buf)
+	encoder.SetCustomStructTag("json")
+	err := encoder.Encode(v)
+	if err != nil {
+		fmt.Fprint(s.response, err)
+		s.output = []byte(err.Error())
+		return
+	}
+	s.output = buf.Bytes()
+
+	s.allowAnyOrigin()
+	s.response.Header().Set("Content-Type", gtype.ContentTypeMsgPack)
+	s.write(s.output)
+}
+
+// outputResult 根据Accept头部输出JSON(默认)、XML或MessagePack格式的结果
+func (s *context) outputResult(result *gtype.Result) {
+	format := gtype.ArgsFmtJson
+	if s.request != nil {
+		format = gtype.NegotiateFormat(s.request.Header.Get("Accept"))
+	}
+	if s.response != nil {
+		s.response.Header().Add("Vary", "Accept")
+	}
+
+	switch format {
+	case gtype.ArgsFmtXml:
+		data, err := xml.Marshal(result)
+		if err != nil {
+			// 结果无法转换为XML(如数据为map)时以XML格式输出错误, 不改变协商的格式
+			data, err = xml.Marshal(s.formatError(result, err))
+		}
+		if err != nil {
+			s.outputFormat = gtype.ArgsFmtXml
+			if s.response != nil {
+				s.response.WriteHeader(http.StatusNotAcceptable)
+			}
+			return
+		}
+		s.OutputXml(data)
+		return
+	case gtype.ArgsFmtMsgPack:
+		s.OutputMsgPack(result)
+		return
+	}
+
+	s.OutputJson(result)
+}
+
+// formatError 返回结果无法按协商的格式输出时的错误结果
+func (s *context) formatError(result *gtype.Result, err error) *gtype.Result {
+	v := &gtype.Result{
+		Code:   gtype.ErrInternal.Code(),
+		Elapse: result.Elapse,
+		Serial: result.Serial,
+	}
+	v.Error.Summary = gtype.ErrInternal.Summary()
+	v.Error.Detail = fmt.Sprintf("output result fail: %v", err)
+	s.outputCode = &v.Code
+
+	return v
+}
+
+// write 输出内容, 根据全局配置或接口设置(CompressionMiddleware)及Accept-Encoding压缩
+func (s *context) write(data []byte) {
+	var writer io.WriteCloser
+	if s.compression != nil {
+		threshold := s.compression.threshold
+		if v, ok := s.keys[gtype.CtxCompression].(int); ok {
+			threshold = v
+		}
+		writer = s.compression.writer(s.response, s.request, threshold, len(data))
+	}
+	if code, ok := s.keys[gtype.CtxStatusCode].(int); ok && code > 0 {
+		s.response.WriteHeader(code)
+	}
+
+	if writer != nil {
+		writer.Write(data)
+		writer.Close()
+	} else {
+		s.response.Write(data)
 	}
 }
 
@@ -219,7 +325,7 @@ func (s *context) Success(data interface{}) {
 	}
 	s.outputCode = &result.Code
 
-	s.OutputJson(result)
+	s.outputResult(result)
 }
 
 func (s *context) Error(err gtype.Error, detail ...interface{}) {
@@ -238,7 +344,7 @@ func (s *context) Error(err gtype.Error, detail ...interface{}) {
 
 	s.outputCode = &result.Code
 
-	s.OutputJson(result)
+	s.outputResult(result)
 }
 
 func (s *context) ErrorWithData(data interface{}, err gtype.Error, detail ...interface{}) {
@@ -258,7 +364,7 @@ func (s *context) ErrorWithData(data interface{}, err gtype.Error, detail ...int
 
 	s.outputCode = &result.Code
 
-	s.OutputJson(result)
+	s.outputResult(result)
 }
 
 func (s *context) IsError() bool {
@@ -0,0 +1,58 @@
+package gserver
+
+import (
+	"encoding/xml"
+	"github.com/csby/gwsf/gtype"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestContext(accept string) (*context, *httptest.ResponseRecorder) {
+	r := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+	r.Header.Set("Accept", accept)
+	w := httptest.NewRecorder()
+
+	return &context{response: w, request: r, keys: make(map[string]interface{})}, w
+}
+
+func TestContext_OutputResult(t *testing.T) {
+	tests := []struct {
+		accept      string
+		contentType string
+	}{
+		{"", "application/json"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "application/json"},
+		{"application/xml", "application/xml"},
+	}
+	for _, test := range tests {
+		ctx, w := newTestContext(test.accept)
+		ctx.Success("ok")
+		if v := w.Header().Get("Content-Type"); !strings.HasPrefix(v, test.contentType) {
+			t.Errorf("%s: content type = %q, want %q", test.accept, v, test.contentType)
+		}
+		if v := w.Header().Get("Vary"); v != "Accept" {
+			t.Errorf("%s: vary = %q", test.accept, v)
+		}
+	}
+}
+
+func TestContext_OutputResultXmlError(t *testing.T) {
+	ctx, w := newTestContext("application/xml")
+	ctx.Success(map[string]int{"count": 1})
+
+	if v := w.Header().Get("Content-Type"); !strings.HasPrefix(v, "application/xml") {
+		t.Fatal("content type:", v)
+	}
+	result := &gtype.Result{}
+	if err := xml.Unmarshal(w.Body.Bytes(), result); err != nil {
+		t.Fatal("body should be xml:", err, w.Body.String())
+	}
+	if result.Code != gtype.ErrInternal.Code() || len(result.Error.Detail) < 1 {
+		t.Error("error result expected:", w.Body.String())
+	}
+	if ctx.outputCode == nil || *ctx.outputCode != gtype.ErrInternal.Code() {
+		t.Error("output code:", ctx.outputCode)
+	}
+}
@@ -0,0 +1,98 @@
+package gserver
+
+import (
+	"fmt"
+	"github.com/csby/gwsf/gcfg"
+	"net/http"
+	"strings"
+)
+
+var defaultCorsMethods = []string{
+	http.MethodGet,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodHead,
+	http.MethodOptions,
+}
+
+// cors 跨域访问策略, 未启用时为nil
+type cors struct {
+	cfg           *gcfg.Cors
+	methods       string
+	headers       string
+	exposeHeaders string
+	maxAge        string
+}
+
+func newCors(cfg *gcfg.Cors) *cors {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+
+	instance := &cors{cfg: cfg}
+	methods := cfg.Methods
+	if len(methods) < 1 {
+		methods = defaultCorsMethods
+	}
+	instance.methods = strings.ToUpper(strings.Join(methods, ","))
+	instance.headers = strings.Join(cfg.Headers, ",")
+	instance.exposeHeaders = strings.Join(cfg.ExposeHeaders, ",")
+	if cfg.MaxAge > 0 {
+		instance.maxAge = fmt.Sprint(cfg.MaxAge)
+	}
+
+	return instance
+}
+
+// apply 输出跨域响应头部, 预检请求时直接回应并返回true
+func (s *cors) apply(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) < 1 {
+		return false
+	}
+	preflight := r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0
+
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	if !s.cfg.AllowOrigin(origin) {
+		if preflight {
+			w.WriteHeader(http.StatusForbidden)
+			return true
+		}
+		return false
+	}
+
+	if s.cfg.AllowAnyOrigin() {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if s.cfg.Credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if !preflight {
+		if len(s.exposeHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", s.exposeHeaders)
+		}
+		return false
+	}
+
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	header.Set("Access-Control-Allow-Methods", s.methods)
+	headers := s.headers
+	if len(headers) < 1 {
+		headers = r.Header.Get("Access-Control-Request-Headers")
+	}
+	if len(headers) > 0 {
+		header.Set("Access-Control-Allow-Headers", headers)
+	}
+	if len(s.maxAge) > 0 {
+		header.Set("Access-Control-Max-Age", s.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return true
+}
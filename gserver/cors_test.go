@@ -0,0 +1,168 @@
+package gserver
+
+import (
+	"github.com/csby/gwsf/gcfg"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func corsRequest(s *cors, method, origin string, headers map[string]string) (*httptest.ResponseRecorder, bool) {
+	r := httptest.NewRequest(method, "/api/test", nil)
+	if len(origin) > 0 {
+		r.Header.Set("Origin", origin)
+	}
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	handled := s.apply(w, r)
+
+	return w, handled
+}
+
+func hasVary(w *httptest.ResponseRecorder, value string) bool {
+	for _, v := range w.Header()["Vary"] {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestCors_Disabled(t *testing.T) {
+	if newCors(nil) != nil || newCors(&gcfg.Cors{}) != nil {
+		t.Fatal("cors should be nil when disabled")
+	}
+}
+
+func TestCors_Preflight(t *testing.T) {
+	s := newCors(&gcfg.Cors{
+		Enabled: true,
+		Origins: []string{"https://*.example.com"},
+		Methods: []string{"get", "post"},
+		MaxAge:  600,
+	})
+
+	w, handled := corsRequest(s, http.MethodOptions, "https://www.example.com", map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "X-Token",
+	})
+	if !handled {
+		t.Fatal("preflight should be handled")
+	}
+	if w.Code != http.StatusNoContent {
+		t.Error("status:", w.Code)
+	}
+	header := w.Header()
+	if v := header.Get("Access-Control-Allow-Origin"); v != "https://www.example.com" {
+		t.Error("allow origin:", v)
+	}
+	if v := header.Get("Access-Control-Allow-Methods"); v != "GET,POST" {
+		t.Error("allow methods:", v)
+	}
+	if v := header.Get("Access-Control-Allow-Headers"); v != "X-Token" {
+		t.Error("allow headers:", v)
+	}
+	if v := header.Get("Access-Control-Max-Age"); v != "600" {
+		t.Error("max age:", v)
+	}
+	if v := header.Get("Access-Control-Allow-Credentials"); v != "" {
+		t.Error("allow credentials:", v)
+	}
+	for _, v := range []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"} {
+		if !hasVary(w, v) {
+			t.Error("vary missing:", v)
+		}
+	}
+}
+
+func TestCors_Request(t *testing.T) {
+	s := newCors(&gcfg.Cors{
+		Enabled:       true,
+		Origins:       []string{"https://www.example.com"},
+		ExposeHeaders: []string{"X-RateLimit-Remaining"},
+	})
+
+	w, handled := corsRequest(s, http.MethodGet, "https://www.example.com", nil)
+	if handled {
+		t.Fatal("simple request should not be handled")
+	}
+	header := w.Header()
+	if v := header.Get("Access-Control-Allow-Origin"); v != "https://www.example.com" {
+		t.Error("allow origin:", v)
+	}
+	if v := header.Get("Access-Control-Expose-Headers"); v != "X-RateLimit-Remaining" {
+		t.Error("expose headers:", v)
+	}
+	if v := header.Get("Access-Control-Allow-Methods"); v != "" {
+		t.Error("allow methods:", v)
+	}
+	if !hasVary(w, "Origin") {
+		t.Error("vary missing: Origin")
+	}
+
+	w, handled = corsRequest(s, http.MethodGet, "", nil)
+	if handled || len(w.Header()) > 0 {
+		t.Error("request without origin should not be changed:", w.Header())
+	}
+}
+
+func TestCors_DisallowedOrigin(t *testing.T) {
+	s := newCors(&gcfg.Cors{
+		Enabled: true,
+		Origins: []string{"https://*.example.com"},
+	})
+
+	for _, origin := range []string{"https://evil.com", "https://example.com", "http://www.example.com"} {
+		w, handled := corsRequest(s, http.MethodGet, origin, nil)
+		if handled {
+			t.Error(origin, ": request should not be handled")
+		}
+		if v := w.Header().Get("Access-Control-Allow-Origin"); v != "" {
+			t.Error(origin, ": allow origin:", v)
+		}
+		if !hasVary(w, "Origin") {
+			t.Error(origin, ": vary missing: Origin")
+		}
+
+		w, handled = corsRequest(s, http.MethodOptions, origin, map[string]string{
+			"Access-Control-Request-Method": "GET",
+		})
+		if !handled || w.Code != http.StatusForbidden {
+			t.Error(origin, ": preflight:", handled, w.Code)
+		}
+		if v := w.Header().Get("Access-Control-Allow-Methods"); v != "" {
+			t.Error(origin, ": allow methods:", v)
+		}
+	}
+}
+
+func TestCors_Wildcard(t *testing.T) {
+	s := newCors(&gcfg.Cors{
+		Enabled: true,
+		Origins: []string{"*"},
+	})
+	w, _ := corsRequest(s, http.MethodGet, "https://any.com", nil)
+	if v := w.Header().Get("Access-Control-Allow-Origin"); v != "*" {
+		t.Error("allow origin:", v)
+	}
+
+	// 携带凭据时不能使用*, 按请求来源回应
+	s = newCors(&gcfg.Cors{
+		Enabled:     true,
+		Origins:     []string{"*"},
+		Credentials: true,
+	})
+	w, _ = corsRequest(s, http.MethodGet, "https://any.com", nil)
+	if v := w.Header().Get("Access-Control-Allow-Origin"); v != "https://any.com" {
+		t.Error("allow origin with credentials:", v)
+	}
+	if v := w.Header().Get("Access-Control-Allow-Credentials"); v != "true" {
+		t.Error("allow credentials:", v)
+	}
+	if !hasVary(w, "Origin") {
+		t.Error("vary missing: Origin")
+	}
+}
@@ -0,0 +1,199 @@
+package gserver
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// forwarded 经过代理服务器转发时的客户端信息
+type forwarded struct {
+	ip    string // 客户端地址
+	proto string // 客户端请求的协议
+	host  string // 客户端请求的主机
+	from  string // X-Forwarded-From
+}
+
+// parseForwarded 请求来自可信代理服务器时，从右到左解析Forwarded(RFC 7239)或X-Forwarded-For头部，
+// 客户端地址为第一个不可信的地址(全部可信时为最左边的地址)；否则忽略转发头部，客户端地址为连接地址
+func parseForwarded(r *http.Request, trusted []*net.IPNet) *forwarded {
+	result := &forwarded{}
+	result.ip, _, _ = net.SplitHostPort(r.RemoteAddr)
+	if len(result.ip) < 1 {
+		result.ip = r.RemoteAddr
+	}
+	if !containsIP(trusted, result.ip) {
+		return result
+	}
+	result.from = r.Header.Get("X-Forwarded-From")
+
+	elements := parseForwardedElements(r.Header["Forwarded"])
+	if len(elements) > 0 {
+		for i := len(elements) - 1; i >= 0; i-- {
+			element := elements[i]
+			if v, ok := element["proto"]; ok {
+				result.proto = v
+			}
+			if v, ok := element["host"]; ok {
+				result.host = v
+			}
+
+			ip := forwardedNodeIP(element["for"])
+			if len(ip) < 1 {
+				break
+			}
+			result.ip = ip
+			if !containsIP(trusted, ip) {
+				break
+			}
+		}
+
+		return result
+	}
+
+	items := splitHeaderValues(r.Header["X-Forwarded-For"])
+	hop := -1
+	for i := len(items) - 1; i >= 0; i-- {
+		ip := forwardedNodeIP(items[i])
+		if len(ip) < 1 {
+			break
+		}
+		result.ip = ip
+		hop = i
+		if !containsIP(trusted, ip) {
+			break
+		}
+	}
+	if len(items) > 0 {
+		result.proto = hopHeaderValue(r.Header["X-Forwarded-Proto"], hop, len(items))
+		result.host = hopHeaderValue(r.Header["X-Forwarded-Host"], hop, len(items))
+	}
+
+	return result
+}
+
+// parseForwardedElements 解析Forwarded头部，每个元素为参数名(小写)及参数值
+// Forwarded: for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"
+func parseForwardedElements(values []string) []map[string]string {
+	elements := make([]map[string]string, 0)
+	for _, value := range values {
+		element := make(map[string]string)
+		pair := &strings.Builder{}
+		quoted := false
+		escaped := false
+
+		end := func(endElement bool) {
+			kv := strings.SplitN(strings.TrimSpace(pair.String()), "=", 2)
+			pair.Reset()
+			if len(kv) == 2 {
+				element[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+			}
+			if endElement {
+				if len(element) > 0 {
+					elements = append(elements, element)
+				}
+				element = make(map[string]string)
+			}
+		}
+
+		for _, c := range value {
+			if escaped {
+				pair.WriteRune(c)
+				escaped = false
+				continue
+			}
+			if quoted {
+				if c == '\\' {
+					escaped = true
+				} else if c == '"' {
+					quoted = false
+				} else {
+					pair.WriteRune(c)
+				}
+				continue
+			}
+
+			switch c {
+			case '"':
+				quoted = true
+			case ';':
+				end(false)
+			case ',':
+				end(true)
+			default:
+				pair.WriteRune(c)
+			}
+		}
+		end(true)
+	}
+
+	return elements
+}
+
+// forwardedNodeIP 返回节点标识中的IP地址，未知(unknown)或隐藏(_xxx)时返回空
+// 192.0.2.43, 192.0.2.43:47011, [2001:db8:cafe::17]:4711, 2001:db8:cafe::17
+func forwardedNodeIP(node string) string {
+	v := strings.TrimSpace(node)
+	if strings.HasPrefix(v, "[") {
+		i := strings.Index(v, "]")
+		if i < 0 {
+			return ""
+		}
+		v = v[1:i]
+	} else if strings.Count(v, ":") == 1 {
+		v = v[:strings.Index(v, ":")]
+	}
+
+	ip := net.ParseIP(v)
+	if ip == nil {
+		return ""
+	}
+
+	return ip.String()
+}
+
+func containsIP(nets []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	c := len(nets)
+	for i := 0; i < c; i++ {
+		if nets[i].Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitHeaderValues 按逗号拆分头部(可能有多个)的值
+func splitHeaderValues(values []string) []string {
+	items := make([]string, 0)
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if len(item) > 0 {
+				items = append(items, item)
+			}
+		}
+	}
+
+	return items
+}
+
+// hopHeaderValue 返回X-Forwarded-Proto或X-Forwarded-Host中与客户端地址对应的值：
+// 值的个数与X-Forwarded-For相同时取同一位置(hop)的值，否则取最右边(最近的代理服务器设置)的值
+func hopHeaderValue(values []string, hop, count int) string {
+	items := splitHeaderValues(values)
+	c := len(items)
+	if c < 1 {
+		return ""
+	}
+	if c == count && hop >= 0 && hop < c {
+		return items[hop]
+	}
+
+	return items[c-1]
+}
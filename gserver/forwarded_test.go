@@ -0,0 +1,169 @@
+package gserver
+
+import (
+	"github.com/csby/gwsf/gproxy"
+	"net/http"
+	"testing"
+)
+
+func TestParseForwarded(t *testing.T) {
+	trusted := gproxy.ParseCIDRs([]string{"10.0.0.0/8", "2001:db8:cafe::/48"})
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string][]string
+		ip      string
+		proto   string
+		host    string
+	}{
+		{
+			name:   "untrusted peer",
+			remote: "172.16.0.1:5000",
+			headers: map[string][]string{
+				"X-Forwarded-For":   {"1.2.3.4"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Forwarded-Host":  {"evil.com"},
+				"Forwarded":         {"for=1.2.3.4;proto=https"},
+			},
+			ip: "172.16.0.1",
+		},
+		{
+			name:   "trusted peer",
+			remote: "10.0.0.1:5000",
+			headers: map[string][]string{
+				"X-Forwarded-For":   {"1.2.3.4"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Forwarded-Host":  {"example.com"},
+			},
+			ip:    "1.2.3.4",
+			proto: "https",
+			host:  "example.com",
+		},
+		{
+			name:    "trusted peer without headers",
+			remote:  "10.0.0.1:5000",
+			headers: map[string][]string{},
+			ip:      "10.0.0.1",
+		},
+		{
+			name:   "multi-hop",
+			remote: "10.0.0.1:5000",
+			headers: map[string][]string{
+				"X-Forwarded-For": {"1.2.3.4, 5.6.7.8", "10.0.0.2"},
+			},
+			ip: "5.6.7.8",
+		},
+		{
+			name:   "multi-hop all trusted",
+			remote: "10.0.0.1:5000",
+			headers: map[string][]string{
+				"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"},
+			},
+			ip: "10.0.0.3",
+		},
+		{
+			name:   "spoofed leading entries",
+			remote: "10.0.0.1:5000",
+			headers: map[string][]string{
+				"X-Forwarded-For":   {"10.0.0.9, 6.6.6.6, 1.2.3.4, 10.0.0.2"},
+				"X-Forwarded-Proto": {"ftp, ws, https, http"},
+				"X-Forwarded-Host":  {"evil.com, evil.com, example.com, inner.local"},
+			},
+			ip:    "1.2.3.4",
+			proto: "https",
+			host:  "example.com",
+		},
+		{
+			name:   "spoofed proto without matching hops",
+			remote: "10.0.0.1:5000",
+			headers: map[string][]string{
+				"X-Forwarded-For":   {"6.6.6.6, 1.2.3.4"},
+				"X-Forwarded-Proto": {"ftp, ws, https"},
+				"X-Forwarded-Host":  {"evil.com", "example.com"},
+			},
+			ip:    "1.2.3.4",
+			proto: "https",
+			host:  "example.com",
+		},
+		{
+			name:   "invalid entry",
+			remote: "10.0.0.1:5000",
+			headers: map[string][]string{
+				"X-Forwarded-For": {"1.2.3.4, bad, 10.0.0.2"},
+			},
+			ip: "10.0.0.2",
+		},
+		{
+			name:   "forwarded",
+			remote: "10.0.0.1:5000",
+			headers: map[string][]string{
+				"Forwarded":       {"for=6.6.6.6;proto=ftp;host=evil.com, for=1.2.3.4;proto=https;host=example.com", "for=10.0.0.2;proto=http"},
+				"X-Forwarded-For": {"9.9.9.9"},
+			},
+			ip:    "1.2.3.4",
+			proto: "https",
+			host:  "example.com",
+		},
+		{
+			name:   "forwarded quoted ipv6",
+			remote: "10.0.0.1:5000",
+			headers: map[string][]string{
+				"Forwarded": {`For="[2001:db8:beef::17]:4711";Proto=https;Host="example.com:8443", for="[2001:db8:cafe::1]"`},
+			},
+			ip:    "2001:db8:beef::17",
+			proto: "https",
+			host:  "example.com:8443",
+		},
+		{
+			name:   "forwarded quoted escape",
+			remote: "10.0.0.1:5000",
+			headers: map[string][]string{
+				"Forwarded": {`for="1.2.3.4:80";host="a\"b,c;d"`},
+			},
+			ip:   "1.2.3.4",
+			host: `a"b,c;d`,
+		},
+		{
+			name:   "forwarded obfuscated",
+			remote: "10.0.0.1:5000",
+			headers: map[string][]string{
+				"Forwarded": {"for=1.2.3.4, for=_hidden;proto=https, for=10.0.0.2"},
+			},
+			ip:    "10.0.0.2",
+			proto: "https",
+		},
+		{
+			name:   "forwarded unknown",
+			remote: "10.0.0.1:5000",
+			headers: map[string][]string{
+				"Forwarded": {"for=unknown"},
+			},
+			ip: "10.0.0.1",
+		},
+		{
+			name:   "ipv6 peer",
+			remote: "[2001:db8:cafe::2]:5000",
+			headers: map[string][]string{
+				"X-Forwarded-For": {"2001:db8::1"},
+			},
+			ip: "2001:db8::1",
+		},
+	}
+
+	for _, test := range tests {
+		r := &http.Request{RemoteAddr: test.remote, Header: http.Header{}}
+		for k, v := range test.headers {
+			r.Header[k] = v
+		}
+		fwd := parseForwarded(r, trusted)
+		if fwd.ip != test.ip {
+			t.Errorf("%s: ip = %q, want %q", test.name, fwd.ip, test.ip)
+		}
+		if fwd.proto != test.proto {
+			t.Errorf("%s: proto = %q, want %q", test.name, fwd.proto, test.proto)
+		}
+		if fwd.host != test.host {
+			t.Errorf("%s: host = %q, want %q", test.name, fwd.host, test.host)
+		}
+	}
+}
@@ -1,23 +1,29 @@
 package gserver
 
 import (
+	gocontext "context"
 	"fmt"
 	"github.com/csby/gsecurity/gcrt"
 	"github.com/csby/gwsf/gcfg"
 	"github.com/csby/gwsf/gdoc"
 	"github.com/csby/gwsf/gheartbeat"
+	"github.com/csby/gwsf/glimit"
 	"github.com/csby/gwsf/gopt"
+	"github.com/csby/gwsf/gproxy"
 	"github.com/csby/gwsf/grouter"
 	"github.com/csby/gwsf/gtype"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 func newHandler(log gtype.Log, cfg *gcfg.Config, hdl gtype.Handler) (*handler, error) {
 	instance := &handler{handler: hdl, cfg: cfg, router: grouter.New()}
 	instance.SetLog(log)
+	instance.conns = &hijackedConns{items: make(map[*hijackedConn]bool)}
 
 	clusterIndex := uint64(0)
 	documentEnabled := false
@@ -33,10 +39,20 @@ func newHandler(log gtype.Log, cfg *gcfg.Config, hdl gtype.Handler) (*handler, e
 
 		appSiteCount = len(cfg.Site.Apps)
 		instance.router.NotFound = &notFound{root: cfg.Site.Root.Path}
+		instance.cors = newCors(&cfg.Cors)
+		instance.compression = newCompression(&cfg.Compression)
+		instance.trustedProxies = gproxy.ParseCIDRs(cfg.TrustedProxies)
 	}
 
 	instance.rid = gtype.NewRand(clusterIndex)
 	instance.router.Doc = gdoc.NewDoc(documentEnabled)
+	if cfg != nil && cfg.RateLimit.Enabled {
+		instance.limiter = glimit.NewLimiter(log, "router", &cfg.RateLimit)
+		instance.router.Use(instance.limiter.Middleware())
+		if log != nil {
+			log.Info("rate limit is enabled: rules=", len(cfg.RateLimit.Rules), ", cluster=", cfg.RateLimit.Cluster)
+		}
+	}
 
 	instance.router.Doc.OnFunctionReady(func(index int, method, path, name string) {
 		if log != nil {
@@ -45,6 +61,7 @@ func newHandler(log gtype.Log, cfg *gcfg.Config, hdl gtype.Handler) (*handler, e
 	})
 
 	otpHandler := gopt.NewHandler(log, cfg, gopt.WebPath, gopt.ApiPath, gdoc.WebPath)
+	instance.opt = otpHandler
 	otpHandler.Init(instance.router,
 		func(opt gtype.Option) {
 			if hdl != nil {
@@ -79,9 +96,11 @@ func newHandler(log gtype.Log, cfg *gcfg.Config, hdl gtype.Handler) (*handler, e
 	}
 
 	for appSiteIndex := 0; appSiteIndex < appSiteCount; appSiteIndex++ {
-		appSite := cfg.Site.Apps[appSiteIndex]
+		appSite := &cfg.Site.Apps[appSiteIndex]
 		appPath := gtype.Path{Prefix: appSite.Uri}
-		instance.router.ServeFiles(appPath.Uri("/*filepath"), nil, http.Dir(appSite.Path), nil)
+		app := newSiteApp(appSite)
+		instance.router.GET(appPath.Uri("/*filepath"), nil, app.serve, nil)
+		instance.router.HEAD(appPath.Uri("/*filepath"), nil, app.serve, nil)
 		log.Info(fmt.Sprintf("webapp [%d/%d] '%s' is ready: uri=%s, path=%s",
 			appSiteIndex+1, appSiteCount,
 			appSite.Name, appSite.Uri, appSite.Path))
@@ -96,11 +115,25 @@ type handler struct {
 	cfg     *gcfg.Config
 	handler gtype.Handler
 
-	router *grouter.Router
-	rid    gtype.Rand
+	router  *grouter.Router
+	rid     gtype.Rand
+	opt     gopt.Handler
+	limiter *glimit.Limiter
+
+	mutex          sync.RWMutex
+	cors           *cors
+	compression    *compression
+	trustedProxies []*net.IPNet
+
+	active int32 // 处理中的请求数(包括WebSocket连接)
+	conns  *hijackedConns
 }
 
 func (s *handler) ServeHTTP(w http.ResponseWriter, r *http.Request, caCrt *gcrt.Crt, serverCrt *gcrt.Pfx) {
+	atomic.AddInt32(&s.active, 1)
+	defer atomic.AddInt32(&s.active, -1)
+
+	w = &response{ResponseWriter: w, conns: s.conns}
 	ctx := s.newContext(w, r)
 	ctx.certificate.Ca = caCrt
 	ctx.certificate.Server = serverCrt
@@ -133,6 +166,17 @@ func (s *handler) ServeHTTP(w http.ResponseWriter, r *http.Request, caCrt *gcrt.
 	}(ctx)
 
 	ctx.path = r.URL.Path
+	s.mutex.RLock()
+	cors := s.cors
+	s.mutex.RUnlock()
+	if cors != nil {
+		ctx.corsEnabled = true
+		if cors.apply(w, r) {
+			ctx.SetHandled(true)
+			return
+		}
+	}
+
 	s.beforeRouting(ctx)
 	if ctx.IsHandled() {
 		return
@@ -146,6 +190,56 @@ func (s *handler) ServeHTTP(w http.ResponseWriter, r *http.Request, caCrt *gcrt.
 	s.router.Serve(ctx)
 }
 
+// reload 应用重新加载的配置(gcfg.Config.Reload): 跨域访问、响应压缩及接口限流规则
+func (s *handler) reload() {
+	if s.cfg != nil {
+		s.mutex.Lock()
+		s.cors = newCors(&s.cfg.Cors)
+		s.compression = newCompression(&s.cfg.Compression)
+		s.trustedProxies = gproxy.ParseCIDRs(s.cfg.TrustedProxies)
+		s.mutex.Unlock()
+
+		if s.limiter != nil {
+			s.limiter.Reload(&s.cfg.RateLimit)
+		} else if s.cfg.RateLimit.Enabled {
+			s.LogWarning("rate limit was disabled at startup, restart is required to enable it")
+		}
+	}
+
+	if h, ok := s.handler.(gtype.ReloadHandler); ok {
+		h.Reload()
+	}
+}
+
+// shutdown 在监听已关闭后调用: 结束WebSocket等被接管的连接并等待处理中的请求结束,
+// 超时(ctx结束)时强制关闭连接; 然后停止反向代理及扩展的组件
+func (s *handler) shutdown(ctx gocontext.Context) {
+	s.conns.interrupt()
+	s.waitActive(ctx)
+
+	if h, ok := s.opt.(gtype.ShutdownHandler); ok {
+		h.Shutdown(ctx)
+	}
+	if h, ok := s.handler.(gtype.ShutdownHandler); ok {
+		h.Shutdown(ctx)
+	}
+}
+
+func (s *handler) waitActive(ctx gocontext.Context) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for atomic.LoadInt32(&s.active) > 0 {
+		select {
+		case <-ctx.Done():
+			s.LogWarning("shutdown timeout: ", atomic.LoadInt32(&s.active), " request(s) in progress, ",
+				s.conns.closeAll(), " connection(s) force closed")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func (s *handler) beforeRouting(ctx *context) {
 	if s.handler == nil {
 		return
@@ -191,10 +285,13 @@ func (s *handler) serve(ctx *context) {
 }
 
 func (s *handler) newContext(w http.ResponseWriter, r *http.Request) *context {
-	ctx := &context{response: w, request: r}
+	s.mutex.RLock()
+	ctx := &context{response: w, request: r, compression: s.compression}
+	fwd := parseForwarded(r, s.trustedProxies)
+	s.mutex.RUnlock()
 	ctx.method = r.Method
 	ctx.afterInput = s.afterInput
-	ctx.schema = r.Header.Get("X-Forwarded-Proto")
+	ctx.schema = fwd.proto
 	if len(ctx.schema) < 1 {
 		if r.TLS != nil {
 			ctx.schema = "https"
@@ -210,7 +307,7 @@ func (s *handler) newContext(w http.ResponseWriter, r *http.Request) *context {
 			}
 		}
 	}
-	ctx.host = r.Header.Get("X-Forwarded-Host")
+	ctx.host = fwd.host
 	if len(ctx.host) < 1 {
 		ctx.host = r.Host
 	}
@@ -219,11 +316,8 @@ func (s *handler) newContext(w http.ResponseWriter, r *http.Request) *context {
 	ctx.enterTime = time.Now()
 	ctx.path = r.URL.Path
 	ctx.rid = s.rid.New()
-	ctx.rip = r.Header.Get("X-Forwarded-For")
-	if len(ctx.rip) < 1 {
-		ctx.rip, _, _ = net.SplitHostPort(r.RemoteAddr)
-	}
-	ctx.forwardFrom = r.Header.Get("X-Forwarded-From")
+	ctx.rip = fwd.ip
+	ctx.forwardFrom = fwd.from
 	ctx.token = r.Header.Get("token")
 	ctx.node = r.Header.Get("node")
 	ctx.instance = r.Header.Get("instance")
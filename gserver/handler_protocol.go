@@ -2,14 +2,14 @@ package gserver
 
 import (
 	"github.com/csby/gsecurity/gcrt"
+	"github.com/csby/gwsf/gcert"
 	"net/http"
 )
 
 type protocol struct {
 	handler *handler
 
-	caCrt     *gcrt.Crt
-	serverCrt *gcrt.Pfx
+	crt *gcert.Store
 }
 
 func (s *protocol) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -17,5 +17,12 @@ func (s *protocol) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.handler.ServeHTTP(w, r, s.caCrt, s.serverCrt)
+	var caCrt *gcrt.Crt
+	var serverCrt *gcrt.Pfx
+	if s.crt != nil {
+		caCrt = s.crt.Ca()
+		serverCrt = s.crt.Pfx()
+	}
+
+	s.handler.ServeHTTP(w, r, caCrt, serverCrt)
 }
@@ -1,15 +1,23 @@
 package gserver
 
 import (
+	gocontext "context"
 	"crypto/tls"
 	"fmt"
-	"github.com/csby/gsecurity/gcrt"
+	"github.com/csby/gwsf/gcert"
 	"github.com/csby/gwsf/gcfg"
 	"github.com/csby/gwsf/gtype"
 	"net"
 	"net/http"
-	"strings"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultShutdownTimeout = 30 * time.Second
 )
 
 type host struct {
@@ -20,6 +28,14 @@ type host struct {
 	httpServer  *http.Server
 	httpsServer *http.Server
 	cloudServer *http.Server
+
+	mutex    sync.Mutex
+	handler  *handler
+	closing  bool
+	stopping chan struct{} // 开始关闭时关闭
+	stopped  chan struct{} // 关闭完成时关闭
+
+	trusted *proxyTrusted
 }
 
 func (s *host) Run() error {
@@ -27,6 +43,13 @@ func (s *host) Run() error {
 		return fmt.Errorf(s.LogError("invalid configure: nil"))
 	}
 
+	s.mutex.Lock()
+	s.closing = false
+	s.stopping = make(chan struct{})
+	s.stopped = make(chan struct{})
+	s.mutex.Unlock()
+	defer s.waitShutdown()
+
 	wg := &sync.WaitGroup{}
 
 	if s.httpHandler != nil {
@@ -35,6 +58,10 @@ func (s *host) Run() error {
 			s.LogError("newHandler error: ", err)
 			return err
 		}
+		s.mutex.Lock()
+		s.handler = router
+		s.mutex.Unlock()
+		go s.watchReload(router, s.stopping)
 
 		// http
 		if s.cfg.Http.Enabled {
@@ -44,7 +71,7 @@ func (s *host) Run() error {
 				defer s.LogInfo("http server stopped")
 
 				err := s.runHttp(router)
-				if err != nil {
+				if err != nil && err != http.ErrServerClosed {
 					s.LogError("http server error: ", err)
 				}
 
@@ -59,7 +86,7 @@ func (s *host) Run() error {
 				defer s.LogInfo("https server stopped")
 
 				err := s.runHttps(router)
-				if err != nil {
+				if err != nil && err != http.ErrServerClosed {
 					s.LogError("https server error: ", err)
 				}
 			}()
@@ -73,7 +100,7 @@ func (s *host) Run() error {
 				defer s.LogInfo("cloud server stopped")
 
 				err := s.runCloud(router)
-				if err != nil {
+				if err != nil && err != http.ErrServerClosed {
 					s.LogError("cloud server error: ", err)
 				}
 			}()
@@ -84,29 +111,112 @@ func (s *host) Run() error {
 	return nil
 }
 
-func (s *host) Close() (err error) {
-	if s.httpServer != nil {
-		e := s.httpServer.Close()
-		if e != nil {
-			err = e
-		}
+// Close 关闭服务, 最长等待配置的关闭超时时间
+func (s *host) Close() error {
+	timeout := defaultShutdownTimeout
+	if s.cfg != nil && s.cfg.Svc.ShutdownTimeout > 0 {
+		timeout = time.Duration(s.cfg.Svc.ShutdownTimeout) * time.Second
 	}
 
-	if s.httpsServer != nil {
-		e := s.httpsServer.Close()
-		if e != nil {
-			err = e
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), timeout)
+	defer cancel()
+
+	return s.Shutdown(ctx)
+}
+
+// Shutdown 关闭所有监听并等待处理中的请求结束, 然后结束WebSocket连接, 停止反向代理、节点转发及集群连接等组件;
+// ctx结束时强制关闭剩余的连接
+func (s *host) Shutdown(ctx gocontext.Context) error {
+	s.mutex.Lock()
+	if s.closing || s.stopped == nil {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closing = true
+	close(s.stopping)
+	servers := []*http.Server{s.httpServer, s.httpsServer, s.cloudServer}
+	router := s.handler
+	stopped := s.stopped
+	s.mutex.Unlock()
+	defer close(stopped)
+
+	s.LogInfo("server is shutting down")
+
+	var err error
+	errMutex := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	for _, server := range servers {
+		if server == nil {
+			continue
 		}
+
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+
+			e := server.Shutdown(ctx)
+			if e != nil {
+				server.Close()
+
+				errMutex.Lock()
+				err = e
+				errMutex.Unlock()
+			}
+		}(server)
+	}
+	wg.Wait()
+
+	if router != nil {
+		router.shutdown(ctx)
 	}
+	s.LogInfo("server has been shut down")
 
-	if s.cloudServer != nil {
-		e := s.cloudServer.Close()
-		if e != nil {
-			err = e
+	return err
+}
+
+// waitShutdown 关闭过程中等待关闭完成, 保证Run返回时处理中的请求已结束
+func (s *host) waitShutdown() {
+	s.mutex.Lock()
+	closing := s.closing
+	stopped := s.stopped
+	s.mutex.Unlock()
+
+	if closing && stopped != nil {
+		<-stopped
+	}
+}
+
+// watchReload 收到SIGHUP信号时重新加载配置
+func (s *host) watchReload(router *handler, stopping chan struct{}) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-stopping:
+			return
+		case <-ch:
+			s.reload(router)
 		}
 	}
+}
 
-	return
+func (s *host) reload(router *handler) {
+	if s.cfg.Load == nil {
+		s.LogWarning("reload configure ignored: load function is nil")
+		return
+	}
+
+	cfg, err := s.cfg.Load()
+	if err != nil {
+		s.LogError("reload configure fail: ", err)
+		return
+	}
+
+	s.cfg.Reload(cfg)
+	router.reload()
+	s.LogInfo("configure has been reloaded")
 }
 
 func (s *host) runHttp(handler *handler) error {
@@ -119,17 +229,22 @@ func (s *host) runHttp(handler *handler) error {
 	addr := fmt.Sprintf("%s:%d", s.cfg.Http.Address, s.cfg.Http.Port)
 	s.LogInfo("http server running on \"", addr, "\"")
 
-	s.httpServer = &http.Server{
+	server := &http.Server{
 		Addr: addr,
 		Handler: &protocol{
 			handler: handler,
 		},
 	}
-	if s.cfg.Http.BehindProxy {
-		s.httpServer.ProxyRemoteAddr = s.getRemoteAddr
+	ln, err := s.listen(addr, s.cfg.Http.BehindProxy)
+	if err != nil {
+		return err
+	}
+	if !s.setServer(&s.httpServer, server) {
+		ln.Close()
+		return http.ErrServerClosed
 	}
-	err := s.httpServer.ListenAndServe()
-	s.httpServer = nil
+	err = server.Serve(ln)
+	s.setServer(&s.httpServer, nil)
 
 	return err
 }
@@ -141,50 +256,47 @@ func (s *host) runHttps(handler *handler) error {
 		}
 	}()
 
-	caFilePath := s.cfg.Https.Cert.Ca.File
-	s.LogInfo("https server ca file: ", caFilePath)
-	pfxFilePath := s.cfg.Https.Cert.Server.File
-	s.LogInfo("https server pfx file: ", pfxFilePath)
-	pfx := &gcrt.Pfx{}
-	err := pfx.FromFile(pfxFilePath, s.cfg.Https.Cert.Server.Password)
+	crt := gcert.NewStore(s.GetLog(), "https server", func() *gcfg.Crt {
+		crt := &gcfg.Crt{}
+		gcfg.Read(func() {
+			*crt = s.cfg.Https.Cert
+		})
+		return crt
+	})
+	err := crt.Load()
 	if err != nil {
-		return fmt.Errorf("load pfx file fail: %v", err)
+		return err
+	}
+
+	clientAuth := tls.NoClientCert
+	if s.cfg.Https.RequestClientCert {
+		clientAuth = tls.RequireAndVerifyClientCert
+	} else if s.cfg.Https.AcceptClientCert {
+		clientAuth = tls.VerifyClientCertIfGiven
 	}
 
 	serverHandler := &protocol{
-		handler:   handler,
-		serverCrt: pfx,
+		handler: handler,
+		crt:     crt,
 	}
 	addr := fmt.Sprintf("%s:%d", s.cfg.Https.Address, s.cfg.Https.Port)
-	s.httpsServer = &http.Server{
-		Addr:    addr,
-		Handler: serverHandler,
-		TLSConfig: &tls.Config{
-			Certificates: pfx.TlsCertificates(),
-			ClientAuth:   tls.NoClientCert,
-		},
-	}
-	if s.cfg.Https.BehindProxy {
-		s.httpsServer.ProxyRemoteAddr = s.getRemoteAddr
-	}
-	if s.cfg.Https.RequestClientCert {
-		s.httpsServer.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
-	} else if s.cfg.Https.AcceptClientCert {
-		s.httpsServer.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   serverHandler,
+		TLSConfig: crt.ServerTlsConfig(clientAuth),
 	}
-	if len(caFilePath) > 0 {
-		crt := &gcrt.Crt{}
-		err = crt.FromFile(caFilePath)
-		if err != nil {
-			return fmt.Errorf("load ca file fail: %v", err)
-		}
-		serverHandler.caCrt = crt
-		s.httpsServer.TLSConfig.ClientCAs = crt.Pool()
+	ln, err := s.listen(addr, s.cfg.Https.BehindProxy)
+	if err != nil {
+		return err
 	}
 
 	s.LogInfo("https server running on \"", addr, "\"")
-	err = s.httpsServer.ListenAndServeTLS("", "")
-	s.httpsServer = nil
+	if !s.setServer(&s.httpsServer, server) {
+		ln.Close()
+		return http.ErrServerClosed
+	}
+	err = server.ServeTLS(ln, "", "")
+	s.setServer(&s.httpsServer, nil)
 
 	return err
 }
@@ -196,95 +308,83 @@ func (s *host) runCloud(handler *handler) error {
 		}
 	}()
 
-	caFilePath := s.cfg.Cloud.Cert.Ca.File
-	s.LogInfo("cloud server ca file: ", caFilePath)
-	pfxFilePath := s.cfg.Cloud.Cert.Server.File
-	s.LogInfo("cloud server pfx file: ", pfxFilePath)
-	pfx := &gcrt.Pfx{}
-	err := pfx.FromFile(pfxFilePath, s.cfg.Cloud.Cert.Server.Password)
+	crt := gcert.NewStore(s.GetLog(), "cloud server", func() *gcfg.Crt {
+		crt := &gcfg.Crt{}
+		gcfg.Read(func() {
+			*crt = s.cfg.Cloud.Cert
+		})
+		return crt
+	})
+	err := crt.Load()
 	if err != nil {
-		return fmt.Errorf("load pfx file fail: %v", err)
+		return err
+	}
+
+	clientAuth := tls.NoClientCert
+	if s.cfg.Cloud.RequestClientCert {
+		clientAuth = tls.RequireAndVerifyClientCert
+	} else if s.cfg.Cloud.AcceptClientCert {
+		clientAuth = tls.VerifyClientCertIfGiven
 	}
 
 	serverHandler := &protocol{
-		handler:   handler,
-		serverCrt: pfx,
+		handler: handler,
+		crt:     crt,
 	}
 	addr := fmt.Sprintf("%s:%d", s.cfg.Cloud.Address, s.cfg.Cloud.Port)
-	s.cloudServer = &http.Server{
-		Addr:    addr,
-		Handler: serverHandler,
-		TLSConfig: &tls.Config{
-			Certificates: pfx.TlsCertificates(),
-			ClientAuth:   tls.NoClientCert,
-		},
-	}
-	if s.cfg.Cloud.BehindProxy {
-		s.cloudServer.ProxyRemoteAddr = s.getRemoteAddr
-	}
-	if s.cfg.Cloud.RequestClientCert {
-		s.cloudServer.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
-	} else if s.cfg.Cloud.AcceptClientCert {
-		s.httpsServer.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   serverHandler,
+		TLSConfig: crt.ServerTlsConfig(clientAuth),
 	}
-	if len(caFilePath) > 0 {
-		crt := &gcrt.Crt{}
-		err = crt.FromFile(caFilePath)
-		if err != nil {
-			return fmt.Errorf("load ca file fail: %v", err)
-		}
-		serverHandler.caCrt = crt
-		s.cloudServer.TLSConfig.ClientCAs = crt.Pool()
+	ln, err := s.listen(addr, s.cfg.Cloud.BehindProxy)
+	if err != nil {
+		return err
 	}
 
 	s.LogInfo("cloud server running on \"", addr, "\"")
-	err = s.cloudServer.ListenAndServeTLS("", "")
-	s.cloudServer = nil
+	if !s.setServer(&s.cloudServer, server) {
+		ln.Close()
+		return http.ErrServerClosed
+	}
+	err = server.ServeTLS(ln, "", "")
+	s.setServer(&s.cloudServer, nil)
 
 	return err
 }
 
-func (s *host) getRemoteAddr(conn net.Conn) string {
-	if len(s.cfg.Proxy) > 0 {
-		addr := fmt.Sprint(conn.RemoteAddr())
-		ip, _, _ := net.SplitHostPort(addr)
-		if len(ip) > 0 {
-			if ip != s.cfg.Proxy {
-				return addr
-			}
-		}
-	}
+// setServer 记录运行中的服务, 已开始关闭时不再记录新的服务并返回false
+func (s *host) setServer(field **http.Server, server *http.Server) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	rawConn := conn
-	if tlsConn, ok := conn.(*tls.Conn); ok {
-		rawConn = tlsConn.RawConn()
+	if server != nil && s.closing {
+		return false
 	}
+	*field = server
 
-	buf := make([]byte, 1)
-	sb := &strings.Builder{}
-	for {
-		_, e := rawConn.Read(buf)
-		if e != nil {
-			return ""
-		}
-
-		if buf[0] == '\n' {
-			break
-		}
-		if buf[0] == '\r' {
-			continue
-		}
+	return true
+}
 
-		sb.Write(buf)
+// listen 监听地址, 位于代理服务器之后时解析来自可信代理服务器的PROXY协议头部以获取客户端的真实地址
+func (s *host) listen(addr string, behindProxy bool) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if !behindProxy {
+		return ln, nil
 	}
 
-	// PROXY family srcIP srcPort targetIP targetPort
-	// PROXY TCP4 192.168.123.254 12955 192.168.123.81 8088
-	proxy := sb.String()
-	vs := strings.Split(proxy, " ")
-	if len(vs) > 3 {
-		return fmt.Sprintf("%s:%s", vs[2], vs[3])
-	} else {
-		return ""
+	nets, err := s.trusted.parse()
+	if err != nil {
+		s.LogError("server on \"", addr, "\" is behind proxy, but proxy address is invalid: PROXY protocol header is ignored: ", err)
+	} else if len(nets) < 1 {
+		s.LogWarning("server on \"", addr, "\" is behind proxy, but proxy address is empty: PROXY protocol header is ignored")
 	}
+
+	return &proxyListener{
+		Listener: ln,
+		trusted:  s.trusted,
+	}, nil
 }
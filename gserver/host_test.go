@@ -0,0 +1,37 @@
+package gserver
+
+import (
+	gocontext "context"
+	"github.com/csby/gwsf/gcfg"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHost_RunAfterShutdown(t *testing.T) {
+	cfg := &gcfg.Config{}
+	cfg.Http.Address = "127.0.0.1"
+	s := &host{cfg: cfg, trusted: &proxyTrusted{}}
+	s.stopping = make(chan struct{})
+	s.stopped = make(chan struct{})
+
+	if err := s.Shutdown(gocontext.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- s.runHttp(nil)
+	}()
+	select {
+	case err := <-result:
+		if err != http.ErrServerClosed {
+			t.Fatal("server should not start after shutdown:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server started after shutdown")
+	}
+	if s.httpServer != nil {
+		t.Fatal("server should not be recorded after shutdown")
+	}
+}
@@ -0,0 +1,70 @@
+package gserver
+
+import (
+	"github.com/csby/gwsf/gproxy"
+	"net"
+	"strings"
+	"sync"
+)
+
+// proxyListener 位于代理服务器之后时使用，来自可信代理服务器的连接解析PROXY协议头部(v1或v2)，
+// 连接的RemoteAddr为头部中客户端的原始地址；来自其他地址的连接不解析头部
+type proxyListener struct {
+	net.Listener
+
+	trusted *proxyTrusted
+}
+
+func (s *proxyListener) Accept() (net.Conn, error) {
+	conn, err := s.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.trusted.contains(conn.RemoteAddr()) {
+		return conn, nil
+	}
+
+	return gproxy.NewProxyProtocolConn(conn, 0), nil
+}
+
+// proxyTrusted 可信的代理服务器地址(IP或CIDR, 多个时用逗号分隔), 配置改变时重新解析
+type proxyTrusted struct {
+	mutex  sync.Mutex
+	source func() string
+	parsed bool
+	value  string
+	nets   []*net.IPNet
+	err    error
+}
+
+// contains 地址是否为可信的代理服务器, 未配置或配置无效时不信任任何地址
+func (s *proxyTrusted) contains(addr net.Addr) bool {
+	nets, err := s.parse()
+	if err != nil || len(nets) < 1 {
+		return false
+	}
+
+	return gproxy.ContainsIP(nets, addr)
+}
+
+// parse 返回解析后的代理服务器地址, 配置无效时返回错误
+func (s *proxyTrusted) parse() ([]*net.IPNet, error) {
+	value := ""
+	if s.source != nil {
+		value = strings.TrimSpace(s.source())
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.parsed || value != s.value {
+		s.parsed = true
+		s.value = value
+		s.nets, s.err = gproxy.ParseCIDRList(strings.Split(value, ","))
+		if s.err != nil {
+			s.nets = nil
+		}
+	}
+
+	return s.nets, s.err
+}
@@ -0,0 +1,104 @@
+package gserver
+
+import (
+	"io"
+	"net"
+	"testing"
+)
+
+type testConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (s *testConn) RemoteAddr() net.Addr {
+	return s.remote
+}
+
+type testListener struct {
+	net.Listener
+	conns chan net.Conn
+}
+
+func (s *testListener) Accept() (net.Conn, error) {
+	conn, ok := <-s.conns
+	if !ok {
+		return nil, io.EOF
+	}
+	return conn, nil
+}
+
+// acceptFrom 模拟来自peer的连接, 发送header后返回监听接收到的连接的远程地址
+func acceptFrom(t *testing.T, proxy string, peer string, header string) string {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		io.WriteString(client, header+"hello")
+	}()
+
+	ln := &proxyListener{
+		Listener: &testListener{conns: make(chan net.Conn, 1)},
+		trusted: &proxyTrusted{source: func() string {
+			return proxy
+		}},
+	}
+	ln.Listener.(*testListener).conns <- &testConn{
+		Conn:   server,
+		remote: &net.TCPAddr{IP: net.ParseIP(peer), Port: 5000},
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	return conn.RemoteAddr().String()
+}
+
+func TestProxyListener(t *testing.T) {
+	header := "PROXY TCP4 1.2.3.4 192.168.1.6 25312 443\r\n"
+	tests := []struct {
+		name   string
+		proxy  string
+		peer   string
+		remote string
+	}{
+		{"trusted ip", "10.0.0.1", "10.0.0.1", "1.2.3.4:25312"},
+		{"trusted cidr", "192.168.1.10, 10.0.0.0/8", "10.2.3.4", "1.2.3.4:25312"},
+		{"untrusted", "10.0.0.0/8", "172.16.0.1", "172.16.0.1:5000"},
+		{"empty", "", "10.0.0.1", "10.0.0.1:5000"},
+		{"blank", " , ", "10.0.0.1", "10.0.0.1:5000"},
+		{"invalid cidr", "10.0.0.0/8,10.0.0.300/33", "10.0.0.1", "10.0.0.1:5000"},
+		{"invalid ip", "proxy.local", "10.0.0.1", "10.0.0.1:5000"},
+	}
+
+	for _, test := range tests {
+		remote := acceptFrom(t, test.proxy, test.peer, header)
+		if remote != test.remote {
+			t.Errorf("%s: remote address = %s, want %s", test.name, remote, test.remote)
+		}
+	}
+}
+
+func TestProxyTrusted_Reload(t *testing.T) {
+	proxy := "10.0.0.0/8"
+	trusted := &proxyTrusted{source: func() string {
+		return proxy
+	}}
+	peer := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000}
+
+	if !trusted.contains(peer) {
+		t.Fatal("peer should be trusted")
+	}
+	proxy = "bad"
+	if trusted.contains(peer) {
+		t.Fatal("peer should not be trusted after invalid proxy configured")
+	}
+	if _, err := trusted.parse(); err == nil {
+		t.Fatal("error expected for invalid proxy")
+	}
+	proxy = ""
+	if trusted.contains(peer) {
+		t.Fatal("peer should not be trusted after proxy cleared")
+	}
+}
@@ -20,6 +20,12 @@ func (s *program) Start(svc service.Service) error {
 }
 
 func (s *program) Stop(svc service.Service) error {
+	if s.host != nil {
+		err := s.host.Close()
+		if err != nil {
+			s.LogWarning("service '", svc.String(), "' shutdown error: ", err)
+		}
+	}
 	s.LogInfo("service '", svc.String(), "' stopped")
 
 	return nil
@@ -0,0 +1,109 @@
+package gserver
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var aLongTimeAgo = time.Unix(1, 0)
+
+// response 记录被接管(Hijack)的连接(如WebSocket), 以便关闭服务时结束这些连接
+type response struct {
+	http.ResponseWriter
+
+	conns *hijackedConns
+}
+
+// Unwrap 返回原始的ResponseWriter, 供http.ResponseController使用
+func (s *response) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func (s *response) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not implement http.Hijacker")
+	}
+
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s.conns.add(conn), rw, nil
+}
+
+type hijackedConns struct {
+	sync.Mutex
+
+	items map[*hijackedConn]bool
+}
+
+func (s *hijackedConns) add(conn net.Conn) net.Conn {
+	s.Lock()
+	defer s.Unlock()
+
+	item := &hijackedConn{Conn: conn, container: s}
+	s.items[item] = true
+
+	return item
+}
+
+func (s *hijackedConns) remove(conn *hijackedConn) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.items, conn)
+}
+
+func (s *hijackedConns) count() int {
+	s.Lock()
+	defer s.Unlock()
+
+	return len(s.items)
+}
+
+// interrupt 中断连接的读取, 使WebSocket等处理函数结束并关闭连接
+func (s *hijackedConns) interrupt() {
+	s.Lock()
+	defer s.Unlock()
+
+	for item := range s.items {
+		item.SetReadDeadline(aLongTimeAgo)
+	}
+}
+
+func (s *hijackedConns) closeAll() int {
+	s.Lock()
+	defer s.Unlock()
+
+	count := len(s.items)
+	for item := range s.items {
+		item.Conn.Close()
+	}
+	s.items = make(map[*hijackedConn]bool)
+
+	return count
+}
+
+type hijackedConn struct {
+	net.Conn
+
+	container *hijackedConns
+}
+
+func (s *hijackedConn) Close() error {
+	s.container.remove(s)
+
+	return s.Conn.Close()
+}
@@ -17,6 +17,13 @@ func NewServer(log gtype.Log, cfg *gcfg.Config, handler gtype.Handler) (gtype.Se
 
 	instance.program.SetLog(log)
 	instance.program.host = &host{cfg: cfg, httpHandler: handler}
+	instance.program.host.trusted = &proxyTrusted{source: func() string {
+		proxy := ""
+		gcfg.Read(func() {
+			proxy = cfg.Proxy
+		})
+		return proxy
+	}}
 	instance.program.host.SetLog(log)
 
 	svcCfg := &service.Config{
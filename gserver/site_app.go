@@ -0,0 +1,202 @@
+package gserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/csby/gwsf/gcfg"
+	"github.com/csby/gwsf/gtype"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+var siteAppPrecompressed = []struct {
+	encoding string
+	ext      string
+}{
+	{gtype.EncodingBrotli, ".br"},
+	{gtype.EncodingGzip, ".gz"},
+}
+
+// siteApp 应用网站: 回退页面(单页应用)、缓存策略、预压缩文件、强ETag及Range请求
+type siteApp struct {
+	cfg  *gcfg.SiteApp
+	root http.FileSystem
+
+	etagMutex sync.Mutex
+	etags     map[string]*siteAppETag
+}
+
+type siteAppETag struct {
+	size    int64
+	modTime time.Time
+	value   string
+}
+
+func newSiteApp(cfg *gcfg.SiteApp) *siteApp {
+	return &siteApp{
+		cfg:   cfg,
+		root:  http.Dir(cfg.Path),
+		etags: make(map[string]*siteAppETag),
+	}
+}
+
+func (s *siteApp) serve(ctx gtype.Context, ps gtype.Params) {
+	w := ctx.Response()
+	r := ctx.Request()
+	name := path.Clean("/" + ps.ByName("filepath"))
+
+	file, info, isDir := s.open(name)
+	if isDir && !strings.HasSuffix(r.URL.Path, "/") {
+		// 目录以/结尾, 保证页面中的相对路径正确
+		http.Redirect(w, r, path.Base(r.URL.Path)+"/", http.StatusMovedPermanently)
+		return
+	}
+	if isDir {
+		name = path.Join(name, "index.html")
+	}
+	if file == nil && len(s.cfg.Fallback) > 0 && len(path.Ext(name)) < 1 {
+		name = path.Clean("/" + s.cfg.Fallback)
+		file, info, _ = s.open(name)
+	}
+	if file == nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	header := w.Header()
+	control := s.cacheControl(name)
+	if len(control) > 0 {
+		header.Set("Cache-Control", control)
+	}
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if len(contentType) > 0 {
+		header.Set("Content-Type", contentType)
+	}
+
+	servedName := name
+	if s.cfg.Precompressed {
+		header.Add("Vary", "Accept-Encoding")
+		// 仅在存在预压缩文件的编码中选择, 首选编码的文件不存在时使用次选编码
+		encodings := make([]string, 0, len(siteAppPrecompressed))
+		for _, item := range siteAppPrecompressed {
+			compressedFile, _, _ := s.open(name + item.ext)
+			if compressedFile == nil {
+				continue
+			}
+			compressedFile.Close()
+			encodings = append(encodings, item.encoding)
+		}
+		encoding := gtype.NegotiateEncoding(r.Header.Get("Accept-Encoding"), encodings)
+		for _, item := range siteAppPrecompressed {
+			if item.encoding != encoding {
+				continue
+			}
+			compressedFile, compressedInfo, _ := s.open(name + item.ext)
+			if compressedFile == nil {
+				break
+			}
+			file.Close()
+			file, info = compressedFile, compressedInfo
+			servedName = name + item.ext
+			header.Set("Content-Encoding", item.encoding)
+			if len(contentType) < 1 {
+				header.Set("Content-Type", "application/octet-stream")
+			}
+			break
+		}
+	}
+
+	if s.cfg.ETag {
+		etag, err := s.etag(servedName, file, info)
+		if err == nil {
+			header.Set("ETag", etag)
+		}
+	}
+
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+// open 打开文件, 目录时打开其中的index.html, 不存在时返回nil
+func (s *siteApp) open(name string) (http.File, os.FileInfo, bool) {
+	file, err := s.root.Open(name)
+	if err != nil {
+		return nil, nil, false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, false
+	}
+	if !info.IsDir() {
+		return file, info, false
+	}
+	file.Close()
+
+	index, info, _ := s.open(path.Join(name, "index.html"))
+	if index == nil || info.IsDir() {
+		return nil, nil, false
+	}
+
+	return index, info, true
+}
+
+func (s *siteApp) cacheControl(name string) string {
+	for _, item := range s.cfg.Caches {
+		if item == nil {
+			continue
+		}
+
+		pattern := item.Pattern
+		matched := false
+		if strings.HasSuffix(pattern, "/") {
+			matched = strings.HasPrefix(name, pattern)
+		} else if strings.Contains(pattern, "/") {
+			matched, _ = path.Match(pattern, name)
+		} else {
+			matched, _ = path.Match(pattern, path.Base(name))
+		}
+		if matched {
+			return item.Control
+		}
+	}
+
+	return ""
+}
+
+// etag 返回文件内容的SHA-256作为强ETag, 文件大小及修改时间不变时使用缓存
+func (s *siteApp) etag(name string, file http.File, info os.FileInfo) (string, error) {
+	s.etagMutex.Lock()
+	item, ok := s.etags[name]
+	s.etagMutex.Unlock()
+	if ok && item.size == info.Size() && item.modTime.Equal(info.ModTime()) {
+		return item.value, nil
+	}
+
+	h := sha256.New()
+	_, err := io.Copy(h, file)
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+
+	item = &siteAppETag{
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		value:   `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`,
+	}
+	s.etagMutex.Lock()
+	s.etags[name] = item
+	s.etagMutex.Unlock()
+
+	return item.value, nil
+}
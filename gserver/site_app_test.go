@@ -0,0 +1,200 @@
+package gserver
+
+import (
+	"github.com/csby/gwsf/gcfg"
+	"github.com/csby/gwsf/gtype"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestSiteApp(t *testing.T, cfg *gcfg.SiteApp) *siteApp {
+	root, err := ioutil.TempDir("", "site-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(root)
+	})
+
+	files := map[string]string{
+		"index.html":          "index",
+		"assets/app.js":       "app",
+		"assets/app.js.br":    "app-br",
+		"assets/app.js.gz":    "app-gz",
+		"assets/style.css":    "style",
+		"assets/style.css.gz": "style-gz",
+		"docs/index.html":     "docs",
+		"assets/logo.png":     "logo",
+	}
+	for name, content := range files {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg.Path = root
+	cfg.Uri = "/app"
+
+	return newSiteApp(cfg)
+}
+
+func serveSiteApp(s *siteApp, name string, headers map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/app"+name, nil)
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	s.serve(&context{response: w, request: r}, gtype.Params{{Key: "filepath", Value: name}})
+
+	return w
+}
+
+func TestSiteApp_Fallback(t *testing.T) {
+	s := newTestSiteApp(t, &gcfg.SiteApp{Fallback: "index.html"})
+
+	tests := []struct {
+		name string
+		code int
+		body string
+	}{
+		{"/", http.StatusOK, "index"},
+		{"/user/list", http.StatusOK, "index"},
+		{"/docs/", http.StatusOK, "docs"},
+		{"/assets/app.js", http.StatusOK, "app"},
+		{"/assets/missing.js", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		w := serveSiteApp(s, test.name, nil)
+		if w.Code != test.code {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.code)
+			continue
+		}
+		if test.code == http.StatusOK && w.Body.String() != test.body {
+			t.Errorf("%s: body = %q, want %q", test.name, w.Body.String(), test.body)
+		}
+	}
+
+	w := serveSiteApp(s, "/docs", nil)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/app/docs/" {
+		t.Error("directory redirect:", w.Code, w.Header().Get("Location"))
+	}
+
+	s = newTestSiteApp(t, &gcfg.SiteApp{})
+	if w := serveSiteApp(s, "/user/list", nil); w.Code != http.StatusNotFound {
+		t.Error("status without fallback:", w.Code)
+	}
+}
+
+func TestSiteApp_Cache(t *testing.T) {
+	s := newTestSiteApp(t, &gcfg.SiteApp{
+		Fallback: "index.html",
+		Caches: []*gcfg.SiteAppCache{
+			{Pattern: "*.html", Control: "no-cache"},
+			{Pattern: "/assets/*.js", Control: "public, max-age=31536000, immutable"},
+			{Pattern: "/assets/", Control: "max-age=3600"},
+		},
+	})
+
+	tests := map[string]string{
+		"/":                 "no-cache",
+		"/user/list":        "no-cache",
+		"/docs/":            "no-cache",
+		"/assets/app.js":    "public, max-age=31536000, immutable",
+		"/assets/logo.png":  "max-age=3600",
+		"/assets/style.css": "max-age=3600",
+	}
+	for name, want := range tests {
+		w := serveSiteApp(s, name, nil)
+		if v := w.Header().Get("Cache-Control"); v != want {
+			t.Errorf("%s: cache control = %q, want %q", name, v, want)
+		}
+	}
+
+	s = newTestSiteApp(t, &gcfg.SiteApp{})
+	if v := serveSiteApp(s, "/", nil).Header().Get("Cache-Control"); v != "" {
+		t.Error("cache control without rules:", v)
+	}
+}
+
+func TestSiteApp_Precompressed(t *testing.T) {
+	s := newTestSiteApp(t, &gcfg.SiteApp{Precompressed: true})
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		encoding       string
+		body           string
+	}{
+		{"/assets/app.js", "", "", "app"},
+		{"/assets/app.js", "gzip", "gzip", "app-gz"},
+		{"/assets/app.js", "gzip, deflate, br", "br", "app-br"},
+		{"/assets/app.js", "br;q=0.5, gzip", "gzip", "app-gz"},
+		{"/assets/app.js", "br;q=0, gzip;q=0", "", "app"},
+		{"/assets/style.css", "br", "", "style"},
+		{"/assets/style.css", "br, gzip", "gzip", "style-gz"},
+		{"/assets/logo.png", "br, gzip", "", "logo"},
+	}
+	for _, test := range tests {
+		w := serveSiteApp(s, test.name, map[string]string{"Accept-Encoding": test.acceptEncoding})
+		if v := w.Header().Get("Content-Encoding"); v != test.encoding {
+			t.Errorf("%s (%s): content encoding = %q, want %q", test.name, test.acceptEncoding, v, test.encoding)
+		}
+		if w.Body.String() != test.body {
+			t.Errorf("%s (%s): body = %q, want %q", test.name, test.acceptEncoding, w.Body.String(), test.body)
+		}
+		if v := w.Header().Get("Vary"); v != "Accept-Encoding" {
+			t.Errorf("%s (%s): vary = %q", test.name, test.acceptEncoding, v)
+		}
+	}
+
+	w := serveSiteApp(s, "/assets/app.js", map[string]string{"Accept-Encoding": "br"})
+	if v := w.Header().Get("Content-Type"); v != "text/javascript; charset=utf-8" && v != "application/javascript" {
+		t.Error("content type of precompressed file:", v)
+	}
+
+	s = newTestSiteApp(t, &gcfg.SiteApp{})
+	w = serveSiteApp(s, "/assets/app.js", map[string]string{"Accept-Encoding": "br"})
+	if v := w.Header().Get("Content-Encoding"); v != "" || w.Body.String() != "app" {
+		t.Error("precompressed disabled:", v, w.Body.String())
+	}
+}
+
+func TestSiteApp_ETag(t *testing.T) {
+	s := newTestSiteApp(t, &gcfg.SiteApp{ETag: true, Precompressed: true})
+
+	w := serveSiteApp(s, "/assets/app.js", nil)
+	etag := w.Header().Get("ETag")
+	if len(etag) < 3 || etag[0] != '"' {
+		t.Fatal("etag:", etag)
+	}
+	gzETag := serveSiteApp(s, "/assets/app.js", map[string]string{"Accept-Encoding": "gzip"}).Header().Get("ETag")
+	if len(gzETag) < 3 || gzETag == etag {
+		t.Error("etag of precompressed file should differ:", gzETag)
+	}
+
+	w = serveSiteApp(s, "/assets/app.js", map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusNotModified {
+		t.Error("status with matched etag:", w.Code)
+	}
+	if w.Body.Len() > 0 {
+		t.Error("body with matched etag:", w.Body.String())
+	}
+
+	w = serveSiteApp(s, "/assets/app.js", map[string]string{"If-None-Match": `"other"`})
+	if w.Code != http.StatusOK || w.Body.String() != "app" {
+		t.Error("status with other etag:", w.Code)
+	}
+
+	s = newTestSiteApp(t, &gcfg.SiteApp{})
+	if v := serveSiteApp(s, "/assets/app.js", nil).Header().Get("ETag"); v != "" {
+		t.Error("etag disabled:", v)
+	}
+}
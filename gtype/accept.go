@@ -0,0 +1,126 @@
+package gtype
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+	EncodingBrotli  = "br"
+)
+
+// Accept 请求头部Accept、Accept-Encoding中的一项
+type Accept struct {
+	Value   string  // 小写的值(不含参数), 如: application/json, gzip
+	Quality float64 // 权重(q), 0-1, 未指定时为1
+}
+
+// ParseAccept 解析Accept、Accept-Encoding头部, 按权重从高到低排序(权重相同时保持原有顺序)
+func ParseAccept(header string) []Accept {
+	items := make([]Accept, 0)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(fields[0]))
+		if len(value) < 1 {
+			continue
+		}
+
+		item := Accept{Value: value, Quality: 1}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			q, err := strconv.ParseFloat(param[2:], 64)
+			if err == nil && q >= 0 && q <= 1 {
+				item.Quality = q
+			}
+		}
+		items = append(items, item)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Quality > items[j].Quality
+	})
+
+	return items
+}
+
+// NegotiateFormat 根据Accept头部选择输出格式: ArgsFmtJson(默认)、ArgsFmtXml或ArgsFmtMsgPack;
+// 明确接受JSON时, 仅当XML或MessagePack的权重高于JSON时才使用; 否则仅当XML或MessagePack为客户端的首选时才使用,
+// 如浏览器默认的 text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8 输出JSON
+func NegotiateFormat(accept string) int {
+	items := ParseAccept(accept)
+	if len(items) < 1 {
+		return ArgsFmtJson
+	}
+
+	top := items[0].Quality
+	jsonListed := false
+	jsonQuality := float64(0)
+	format := ArgsFmtJson
+	best := float64(0)
+	for _, item := range items {
+		switch item.Value {
+		case ContentTypeJson, "text/json":
+			if !jsonListed {
+				jsonListed = true
+				jsonQuality = item.Quality
+			}
+		case ContentTypeXml, "text/xml":
+			if item.Quality > best {
+				format, best = ArgsFmtXml, item.Quality
+			}
+		case ContentTypeMsgPack, "application/x-msgpack", "application/vnd.msgpack":
+			if item.Quality > best {
+				format, best = ArgsFmtMsgPack, item.Quality
+			}
+		}
+	}
+
+	if best <= 0 {
+		return ArgsFmtJson
+	}
+	if jsonListed && jsonQuality > 0 {
+		if best > jsonQuality {
+			return format
+		}
+		return ArgsFmtJson
+	}
+	if best >= top {
+		return format
+	}
+
+	return ArgsFmtJson
+}
+
+// NegotiateEncoding 根据Accept-Encoding头部从服务端支持的编码(按优先顺序)中选择压缩编码, 不压缩时返回空
+func NegotiateEncoding(acceptEncoding string, encodings []string) string {
+	items := ParseAccept(acceptEncoding)
+	quality := func(encoding string) float64 {
+		any := float64(0)
+		for _, item := range items {
+			if item.Value == encoding {
+				return item.Quality
+			} else if item.Value == "*" {
+				any = item.Quality
+			}
+		}
+		return any
+	}
+
+	encoding := ""
+	best := float64(0)
+	for _, item := range encodings {
+		q := quality(strings.ToLower(item))
+		if q > best {
+			encoding = strings.ToLower(item)
+			best = q
+		}
+	}
+
+	return encoding
+}
@@ -0,0 +1,62 @@
+package gtype
+
+import "testing"
+
+func TestParseAccept(t *testing.T) {
+	items := ParseAccept("text/html, application/XML;q=0.9, */*;q=0.8, application/json")
+	expects := []Accept{
+		{"text/html", 1},
+		{"application/json", 1},
+		{"application/xml", 0.9},
+		{"*/*", 0.8},
+	}
+	if len(items) != len(expects) {
+		t.Fatal("items:", items)
+	}
+	for i, expect := range expects {
+		if items[i] != expect {
+			t.Error(i, ": expect", expect, "but", items[i])
+		}
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := map[string]int{
+		"":                          ArgsFmtJson,
+		"*/*":                       ArgsFmtJson,
+		"application/xml":           ArgsFmtXml,
+		"text/html, text/xml;q=0.9": ArgsFmtJson,
+		"application/json;q=0.5, application/msgpack":                                                      ArgsFmtMsgPack,
+		"application/x-msgpack;q=0, */*":                                                                   ArgsFmtJson,
+		"application/xml, */*;q=0.8":                                                                       ArgsFmtXml,
+		"application/json, application/xml":                                                                ArgsFmtJson,
+		"application/xml;q=0.9, application/json":                                                          ArgsFmtJson,
+		"application/json;q=0.5, application/xml;q=0.8, */*":                                               ArgsFmtXml,
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8":                                  ArgsFmtJson,
+		"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8": ArgsFmtJson,
+	}
+	for accept, expect := range tests {
+		if v := NegotiateFormat(accept); v != expect {
+			t.Error(accept, ": expect", expect, "but", v)
+		}
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	encodings := []string{EncodingBrotli, EncodingGzip, EncodingDeflate}
+	tests := map[string]string{
+		"":                              "",
+		"identity":                      "",
+		"gzip, deflate, br":             EncodingBrotli,
+		"gzip, deflate":                 EncodingGzip,
+		"deflate, gzip;q=0.5":           EncodingDeflate,
+		"*":                             EncodingBrotli,
+		"*, br;q=0":                     EncodingGzip,
+		"br;q=0, gzip;q=0, deflate;q=0": "",
+	}
+	for accept, expect := range tests {
+		if v := NegotiateEncoding(accept, encodings); v != expect {
+			t.Error(accept, ": expect", expect, "but", v)
+		}
+	}
+}
@@ -8,9 +8,10 @@ import (
 )
 
 const (
-	ArgsFmtText = 0
-	ArgsFmtJson = 1
-	ArgsFmtXml  = 2
+	ArgsFmtText    = 0
+	ArgsFmtJson    = 1
+	ArgsFmtXml     = 2
+	ArgsFmtMsgPack = 3
 )
 
 type ArgsParser interface {
@@ -7,6 +7,8 @@ import (
 
 const (
 	CtxUserAccount = "ctx_user_account"
+	CtxCompression = "ctx_compression" // 接口的压缩阈值(int), 见CompressionMiddleware
+	CtxStatusCode  = "ctx_status_code" // 响应状态码(int), 输出内容时设置, 默认200
 )
 
 type Context interface {
@@ -20,6 +22,7 @@ type Context interface {
 	OutputJson(v interface{})
 	OutputXml(v interface{})
 	OutputSoap(v interface{})
+	OutputMsgPack(v interface{})
 	Success(data interface{})
 	Error(err Error, detail ...interface{})
 	ErrorWithData(data interface{}, err Error, detail ...interface{})
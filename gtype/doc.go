@@ -7,6 +7,7 @@ const (
 	ContentTypeFormData = "multipart/form-data"
 	ContentTypeXml      = "application/xml"
 	ContentTypeSoap     = "application/soap+xml"
+	ContentTypeMsgPack  = "application/msgpack"
 )
 const (
 	FormValueKindText = 0
@@ -68,4 +69,9 @@ type Doc interface {
 	TokenCreate(id string, items []TokenAuth, ctx Context) (string, Error)
 	Log(handle DocHandle, method string, uri Uri)
 	Regenerate()
+
+	// 设置接口适用的中间件(分组及接口)
+	SetMiddlewares(method string, uri Uri, middlewares []Middleware)
+	// 添加全局中间件，适用于所有接口
+	UseMiddlewares(middlewares ...Middleware)
 }
@@ -14,6 +14,7 @@ var (
 	ErrExist      = newError(5, "已存在")
 	ErrNotExist   = newError(6, "不存在")
 	ErrInput      = newError(7, "输入错误")
+	ErrTooMany    = newError(8, "请求过于频繁")
 
 	ErrTokenEmpty   = newError(101, "缺少凭证")
 	ErrTokenInvalid = newError(101, "凭证无效")
@@ -1,5 +1,7 @@
 package gtype
 
+import "context"
+
 type Handler interface {
 	InitRouting(router Router)
 	BeforeRouting(ctx Context)
@@ -9,3 +11,14 @@ type Handler interface {
 	ExtendOptSetup(opt Option)
 	ExtendOptApi(router Router, path *Path, preHandle HttpHandle, opt Opt)
 }
+
+// ShutdownHandler 可选接口, Handler实现时在服务关闭时调用,
+// 用于停止在ExtendOptApi等处创建的组件(如gcluster、gnode), ctx在关闭超时时结束
+type ShutdownHandler interface {
+	Shutdown(ctx context.Context)
+}
+
+// ReloadHandler 可选接口, Handler实现时在收到SIGHUP信号并重新加载配置(gcfg.Config.Reload)后调用
+type ReloadHandler interface {
+	Reload()
+}
@@ -0,0 +1,66 @@
+package gtype
+
+import "fmt"
+
+// Middleware 中间件，包装下一个处理函数(后续的中间件、preHandle及接口处理函数)，
+// 不调用next即中断后续处理，next返回后可通过ctx获取处理结果(如IsHandled、IsError、GetOutputCode)；
+// 执行顺序: 全局 > 分组 > 接口，同一级别按添加顺序，先添加的在外层
+type Middleware struct {
+	// 名称，显示在接口文档中
+	Name string
+	// 说明，显示在接口文档中
+	Note string
+	Wrap func(next HttpHandle) HttpHandle
+}
+
+// NewMiddleware 创建中间件
+func NewMiddleware(name, note string, wrap func(next HttpHandle) HttpHandle) Middleware {
+	return Middleware{
+		Name: name,
+		Note: note,
+		Wrap: wrap,
+	}
+}
+
+// PreHandleMiddleware 将preHandle(如凭证验证)转换为中间件: 先调用handle，未处理(IsHandled)时再调用next
+func PreHandleMiddleware(name, note string, handle HttpHandle) Middleware {
+	return NewMiddleware(name, note, func(next HttpHandle) HttpHandle {
+		return func(ctx Context, ps Params) {
+			if handle != nil {
+				handle(ctx, ps)
+				if ctx.IsHandled() {
+					return
+				}
+			}
+			next(ctx, ps)
+		}
+	})
+}
+
+// ChainMiddlewares 按顺序包装handle，第一个中间件在最外层
+func ChainMiddlewares(handle HttpHandle, middlewares ...Middleware) HttpHandle {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		wrap := middlewares[i].Wrap
+		if wrap == nil {
+			continue
+		}
+		handle = wrap(handle)
+	}
+
+	return handle
+}
+
+// CompressionMiddleware 设置接口响应的压缩阈值(字节), 覆盖全局配置: 小于0表示不压缩, 0表示总是压缩
+func CompressionMiddleware(threshold int) Middleware {
+	note := "不压缩"
+	if threshold >= 0 {
+		note = fmt.Sprintf("响应内容不小于%d字节时, 根据Accept-Encoding压缩(br、gzip、deflate)", threshold)
+	}
+
+	return NewMiddleware("压缩", note, func(next HttpHandle) HttpHandle {
+		return func(ctx Context, ps Params) {
+			ctx.Set(CtxCompression, threshold)
+			next(ctx, ps)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package gtype
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChainMiddlewares(t *testing.T) {
+	calls := make([]string, 0)
+	trace := func(name string, stop bool) Middleware {
+		return NewMiddleware(name, "", func(next HttpHandle) HttpHandle {
+			return func(ctx Context, ps Params) {
+				calls = append(calls, name+">")
+				if !stop {
+					next(ctx, ps)
+				}
+				calls = append(calls, "<"+name)
+			}
+		})
+	}
+	handle := func(ctx Context, ps Params) {
+		calls = append(calls, "handle")
+	}
+
+	ChainMiddlewares(handle, trace("a", false), Middleware{Name: "empty"}, trace("b", false))(nil, nil)
+	if v := strings.Join(calls, " "); v != "a> b> handle <b <a" {
+		t.Fatal("calls:", v)
+	}
+
+	// 不调用next时中断后续处理
+	calls = calls[:0]
+	ChainMiddlewares(handle, trace("a", true), trace("b", false))(nil, nil)
+	if v := strings.Join(calls, " "); v != "a> <a" {
+		t.Fatal("calls:", v)
+	}
+}
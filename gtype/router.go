@@ -2,13 +2,27 @@ package gtype
 
 import "net/http"
 
+// Router 路由，middlewares为仅对该接口生效的中间件，在全局及分组的中间件之后、preHandle之前执行
 type Router interface {
-	GET(uri Uri, preHandle, httpHandle HttpHandle, docHandle DocHandle)
-	POST(uri Uri, preHandle, httpHandle HttpHandle, docHandle DocHandle)
+	GET(uri Uri, preHandle, httpHandle HttpHandle, docHandle DocHandle, middlewares ...Middleware)
+	POST(uri Uri, preHandle, httpHandle HttpHandle, docHandle DocHandle, middlewares ...Middleware)
+	PUT(uri Uri, preHandle, httpHandle HttpHandle, docHandle DocHandle, middlewares ...Middleware)
+	PATCH(uri Uri, preHandle, httpHandle HttpHandle, docHandle DocHandle, middlewares ...Middleware)
+	DELETE(uri Uri, preHandle, httpHandle HttpHandle, docHandle DocHandle, middlewares ...Middleware)
+	HEAD(uri Uri, preHandle, httpHandle HttpHandle, docHandle DocHandle, middlewares ...Middleware)
+	OPTIONS(uri Uri, preHandle, httpHandle HttpHandle, docHandle DocHandle, middlewares ...Middleware)
 
 	// path of uri must be end with "/*filepath",
 	// example: ServeFiles("/src/*filepath", http.Dir("/var/www"), nil)
-	ServeFiles(uri Uri, preHandle HttpHandle, root http.FileSystem, docHandle DocHandle)
+	ServeFiles(uri Uri, preHandle HttpHandle, root http.FileSystem, docHandle DocHandle, middlewares ...Middleware)
+
+	// sub-router, the routes of which share the path prefix, the document and the middlewares,
+	// example: api := router.Group("/api/v1", logMiddleware, authMiddleware)
+	Group(prefix string, middlewares ...Middleware) Router
+
+	// add middlewares: global for the root router, applying to all routes;
+	// for a group, applying to the routes registered after
+	Use(middlewares ...Middleware)
 
 	// document
 	Document() Doc
@@ -8,6 +8,7 @@ import (
 
 const (
 	WSClusterNodeStatusChanged = 11 // 集群节点状态改变
+	WSClusterRateLimitConsumed = 12 // 集群限流令牌消耗
 
 	WSHeartbeatConnected    = 21 // 心跳检测已连接
 	WSHeartbeatDisconnected = 22 // 心跳检测断开连接